@@ -1,11 +1,18 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"net/http"
+	"time"
+	"log"
 
 	"github.com/Somvaded/assessment/config"
 	"github.com/Somvaded/assessment/db"
+	"github.com/Somvaded/assessment/middlewares"
+	"github.com/Somvaded/assessment/repositories"
 	"github.com/Somvaded/assessment/routes"
+	"github.com/Somvaded/assessment/utils"
 	"github.com/gin-gonic/gin"
 )
 
@@ -13,8 +20,47 @@ func main() {
 	conn := config.LoadConfig()
 	gin.SetMode(gin.ReleaseMode)
 	r := gin.Default();
+	if err := middlewares.TrustProxies(r, conn.TrustedProxies); err != nil {
+		log.Fatalf("Invalid TRUSTED_PROXIES: %v", err)
+	}
 	db := db.ConnectDatabase(conn.DBUrl);
-	routes.RegisterRoutes(r,db)
+	utils.AccessTokenTTL = conn.AccessTokenTTL
+
+	legacyUntil := conn.JWTLegacyHS256Until
+	if legacyUntil.IsZero() {
+		legacyUntil = time.Now().Add(conn.AccessTokenTTL)
+	}
+	keys, err := utils.NewKeyManager(utils.KeyManagerOptions{
+		Algorithm:    conn.JWTSigningAlg,
+		LegacySecret: []byte(conn.JWTSecret),
+		LegacyUntil:  legacyUntil,
+		Dir:          conn.JWTKeysDir,
+		Retention:    conn.AccessTokenTTL + utils.MFATokenTTL + time.Minute,
+	})
+	if err != nil {
+		log.Fatalf("Could not set up JWT signing keys: %v", err)
+	}
+	keys.StartRotation(context.Background(), conn.JWTKeyRotation)
+	utils.SetKeyManager(keys)
+
+	if conn.PasswordHasher == "bcrypt" {
+		utils.SetPasswordHasher(utils.NewBcryptHasher(conn.BcryptCost))
+	} else {
+		utils.SetPasswordHasher(utils.NewArgon2idHasher(conn.Argon2Memory, conn.Argon2Iterations, conn.Argon2Threads))
+	}
+
+	cookies := utils.CookieOptions{
+		Secure:   conn.CookieSecure,
+		SameSite: utils.ParseSameSite(conn.CookieSameSite),
+		Domain:   conn.CookieDomain,
+	}
+	if cookies.SameSite == http.SameSiteNoneMode && !cookies.Secure {
+		log.Println("COOKIE_SAMESITE=none without COOKIE_SECURE=true; browsers will reject the auth cookies")
+	}
+	utils.SetCookieOptions(cookies)
+
+	routes.RegisterRoutes(r,db,conn)
+	repositories.StartPatientPurge(context.Background(), db, conn.PatientRetention, conn.PatientPurgeInterval)
 
 	if conn.Port == "" {
 		conn.Port = "8080"
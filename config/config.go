@@ -3,6 +3,9 @@ package config
 import (
 	"log"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -11,6 +14,122 @@ type Config struct {
 	DBUrl     string
 	JWTSecret string
 	Port      string
+
+	AccessTokenTTL  time.Duration
+	RefreshTokenTTL time.Duration
+
+	// JWTSigningAlg is "HS256" (JWTSecret only), "RS256" or "EdDSA".
+	// Asymmetric keys are loaded from JWTKeysDir, or generated in memory
+	// when it is empty, and rotated every JWTKeyRotation if non-zero.
+	JWTSigningAlg  string
+	JWTKeysDir     string
+	JWTKeyRotation time.Duration
+	// JWTLegacyHS256Until keeps HS256 tokens valid after switching to an
+	// asymmetric algorithm. When unset they are accepted for one access
+	// token lifetime after startup.
+	JWTLegacyHS256Until time.Time
+
+	// TokenRevocationStore selects where revoked access tokens are kept:
+	// "postgres" (default) or "memory" for single-instance deployments.
+	TokenRevocationStore string
+
+	// AuthTokenSources is the precedence order in which Protect looks for
+	// the access token: "cookie" and/or "header" (Authorization: Bearer).
+	AuthTokenSources []string
+
+	// MailDriver is "smtp" or "outbox"; the outbox driver writes .eml files
+	// to MailOutboxDir instead of sending them.
+	MailDriver    string
+	MailFrom      string
+	MailOutboxDir string
+	SMTPHost      string
+	SMTPPort      string
+	SMTPUsername  string
+	SMTPPassword  string
+
+	// PasswordResetURL is the front-end page that receives the reset token
+	// as a "token" query parameter.
+	PasswordResetURL string
+	PasswordResetTTL time.Duration
+
+	// Password policy for new passwords. PasswordRequiredClasses lists
+	// "upper", "lower", "digit" and/or "symbol". The last PasswordHistory
+	// passwords cannot be reused, and a non-zero PasswordMaxAge forces a
+	// change once a password is that old.
+	PasswordMinLength       int
+	PasswordRequiredClasses []string
+	PasswordHistory         int
+	PasswordMaxAge          time.Duration
+
+	// PasswordHasher is "argon2id" (default) or "bcrypt". Hashes made with
+	// the other algorithm, or with weaker parameters, still verify and are
+	// replaced on the user's next login.
+	PasswordHasher   string
+	Argon2Memory     uint32 // KiB
+	Argon2Iterations uint32
+	Argon2Threads    uint8
+	BcryptCost       int
+
+	// MFAIssuer is the account issuer shown in authenticator apps.
+	MFAIssuer string
+
+	// LoginAttemptStore selects where failed login counters are kept:
+	// "postgres" (default) or "memory".
+	LoginAttemptStore    string
+	LoginFreeAttempts    int
+	LoginBackoffBase     time.Duration
+	LoginBackoffMax      time.Duration
+	LoginMaxFailures     int
+	LoginIPMaxFailures   int
+	LoginLockoutDuration time.Duration
+	LoginFailureWindow   time.Duration
+
+	// PermissionCacheTTL is how long role permissions are cached before
+	// changes made on another instance are picked up.
+	PermissionCacheTTL time.Duration
+
+	// EmergencyAccessDefault is how long a break-the-glass grant lasts when
+	// the doctor does not ask for a duration; EmergencyAccessMax caps it.
+	EmergencyAccessDefault time.Duration
+	EmergencyAccessMax     time.Duration
+
+	// PatientRetention is how long soft-deleted patients can be restored
+	// before the purge job, run every PatientPurgeInterval, removes them.
+	// Zero keeps deleted patients forever.
+	PatientRetention     time.Duration
+	PatientPurgeInterval time.Duration
+
+	// AccessPolicyFile is a JSON file restricting roles to network ranges
+	// and working hours, evaluated in ClinicTimezone (an IANA name such as
+	// "Asia/Kolkata"). Unset means no restrictions.
+	AccessPolicyFile string
+	ClinicTimezone   string
+
+	// DelegationMax is the longest a doctor may share a patient with
+	// another doctor for a consult.
+	DelegationMax time.Duration
+
+	// OIDCIssuer enables single sign-on at /api/auth/oidc when set.
+	// OIDCRedirectURL must point at /api/auth/oidc/callback and be
+	// registered with the IdP.
+	OIDCIssuer       string
+	OIDCClientID     string
+	OIDCClientSecret string
+	OIDCRedirectURL  string
+	OIDCScopes       []string
+
+	// Cookie attributes for auth_token, refresh_token and csrf_token.
+	// CookieSameSite is "lax" (default), "strict" or "none"; "none"
+	// requires CookieSecure. Set CookieSecure in any HTTPS deployment.
+	CookieSecure   bool
+	CookieSameSite string
+	CookieDomain   string
+
+	// TrustedProxies lists the proxy addresses or CIDRs whose
+	// X-Forwarded-For header is believed when resolving the client IP.
+	// When empty no proxy is trusted and the peer address is used; set it
+	// when running behind a load balancer or reverse proxy.
+	TrustedProxies []string
 }
 
  
@@ -23,12 +142,161 @@ func LoadConfig() *Config {
 
 	appConfig := &Config{
 		DBUrl:     getEnv("DBUrl"),
-		JWTSecret: getEnv("JWTSecret"),
+		JWTSecret: getEnvDefault("JWTSecret", getEnv("JWT_SECRET")),
 		Port:      getEnv("PORT"),
+
+		AccessTokenTTL:  getDuration("ACCESS_TOKEN_TTL", 15*time.Minute),
+		RefreshTokenTTL: getDuration("REFRESH_TOKEN_TTL", 7*24*time.Hour),
+
+		JWTSigningAlg:       getEnvDefault("JWT_SIGNING_ALG", "HS256"),
+		JWTKeysDir:          getEnv("JWT_KEYS_DIR"),
+		JWTKeyRotation:      getDuration("JWT_KEY_ROTATION_INTERVAL", 0),
+		JWTLegacyHS256Until: getTime("JWT_LEGACY_HS256_UNTIL"),
+
+		TokenRevocationStore: getEnvDefault("TOKEN_REVOCATION_STORE", "postgres"),
+		AuthTokenSources:     getListDefault("AUTH_TOKEN_SOURCES", []string{"cookie", "header"}),
+
+		MailDriver:    getEnvDefault("MAIL_DRIVER", "outbox"),
+		MailFrom:      getEnvDefault("MAIL_FROM", "no-reply@localhost"),
+		MailOutboxDir: getEnvDefault("MAIL_OUTBOX_DIR", "outbox"),
+		SMTPHost:      getEnv("SMTP_HOST"),
+		SMTPPort:      getEnvDefault("SMTP_PORT", "587"),
+		SMTPUsername:  getEnv("SMTP_USERNAME"),
+		SMTPPassword:  getEnv("SMTP_PASSWORD"),
+
+		PasswordResetURL: getEnvDefault("PASSWORD_RESET_URL", "http://localhost:3000/reset-password"),
+		PasswordResetTTL: getDuration("PASSWORD_RESET_TTL", 30*time.Minute),
+
+		PasswordMinLength:       getInt("PASSWORD_MIN_LENGTH", 12),
+		PasswordRequiredClasses: getListDefault("PASSWORD_REQUIRED_CLASSES", []string{"upper", "lower", "digit"}),
+		PasswordHistory:         getInt("PASSWORD_HISTORY", 5),
+		PasswordMaxAge:          time.Duration(getInt("PASSWORD_MAX_AGE_DAYS", 0)) * 24 * time.Hour,
+
+		PasswordHasher:   getEnvDefault("PASSWORD_HASHER", "argon2id"),
+		Argon2Memory:     uint32(getInt("ARGON2_MEMORY_KIB", 64*1024)),
+		Argon2Iterations: uint32(getInt("ARGON2_ITERATIONS", 3)),
+		Argon2Threads:    uint8(getInt("ARGON2_THREADS", 2)),
+		BcryptCost:       getInt("BCRYPT_COST", 10),
+
+		MFAIssuer: getEnvDefault("MFA_ISSUER", "Patient Management System"),
+
+		LoginAttemptStore:    getEnvDefault("LOGIN_ATTEMPT_STORE", "postgres"),
+		LoginFreeAttempts:    getInt("LOGIN_FREE_ATTEMPTS", 3),
+		LoginBackoffBase:     getDuration("LOGIN_BACKOFF_BASE", time.Second),
+		LoginBackoffMax:      getDuration("LOGIN_BACKOFF_MAX", 5*time.Minute),
+		LoginMaxFailures:     getInt("LOGIN_MAX_FAILURES", 10),
+		LoginIPMaxFailures:   getInt("LOGIN_IP_MAX_FAILURES", 50),
+		LoginLockoutDuration: getDuration("LOGIN_LOCKOUT_DURATION", 15*time.Minute),
+		LoginFailureWindow:   getDuration("LOGIN_FAILURE_WINDOW", 15*time.Minute),
+
+		PermissionCacheTTL: getDuration("PERMISSION_CACHE_TTL", 30*time.Second),
+
+		EmergencyAccessDefault: getDuration("EMERGENCY_ACCESS_DEFAULT", time.Hour),
+		EmergencyAccessMax:     getDuration("EMERGENCY_ACCESS_MAX", 4*time.Hour),
+		DelegationMax:          getDuration("DELEGATION_MAX", 30*24*time.Hour),
+
+		PatientRetention:     getDuration("PATIENT_RETENTION", 30*24*time.Hour),
+		PatientPurgeInterval: getDuration("PATIENT_PURGE_INTERVAL", time.Hour),
+
+		AccessPolicyFile: getEnv("ACCESS_POLICY_FILE"),
+		ClinicTimezone:   getEnvDefault("CLINIC_TIMEZONE", "UTC"),
+
+		OIDCIssuer:       getEnv("OIDC_ISSUER"),
+		OIDCClientID:     getEnv("OIDC_CLIENT_ID"),
+		OIDCClientSecret: getEnv("OIDC_CLIENT_SECRET"),
+		OIDCRedirectURL:  getEnv("OIDC_REDIRECT_URL"),
+		OIDCScopes:       getListDefault("OIDC_SCOPES", []string{"openid", "email", "profile"}),
+
+		CookieSecure:   getBool("COOKIE_SECURE", false),
+		CookieSameSite: getEnvDefault("COOKIE_SAMESITE", "lax"),
+		CookieDomain:   getEnv("COOKIE_DOMAIN"),
+
+		TrustedProxies: getList("TRUSTED_PROXIES"),
 	}
     return appConfig
 }
 
 func getEnv(key string) string {
 	return os.Getenv(key)
-}
\ No newline at end of file
+}
+
+func getEnvDefault(key string, def string) string {
+	if val := os.Getenv(key); val != "" {
+		return val
+	}
+	return def
+}
+
+// getDuration parses a Go duration string such as "15m" or "168h",
+// falling back to def when the variable is unset or malformed.
+func getDuration(key string, def time.Duration) time.Duration {
+	val := os.Getenv(key)
+	if val == "" {
+		return def
+	}
+	d, err := time.ParseDuration(val)
+	if err != nil {
+		log.Printf("Invalid duration for %s (%q), using %s", key, val, def)
+		return def
+	}
+	return d
+}
+
+// getTime parses an RFC 3339 timestamp, returning the zero time when the
+// variable is unset or malformed.
+func getTime(key string) time.Time {
+	val := os.Getenv(key)
+	if val == "" {
+		return time.Time{}
+	}
+	t, err := time.Parse(time.RFC3339, val)
+	if err != nil {
+		log.Printf("Invalid timestamp for %s (%q), ignoring", key, val)
+		return time.Time{}
+	}
+	return t
+}
+
+func getInt(key string, def int) int {
+	val := os.Getenv(key)
+	if val == "" {
+		return def
+	}
+	n, err := strconv.Atoi(val)
+	if err != nil {
+		log.Printf("Invalid integer for %s (%q), using %d", key, val, def)
+		return def
+	}
+	return n
+}
+
+func getBool(key string, def bool) bool {
+	val := os.Getenv(key)
+	if val == "" {
+		return def
+	}
+	b, err := strconv.ParseBool(val)
+	if err != nil {
+		log.Printf("Invalid boolean for %s (%q), using %t", key, val, def)
+		return def
+	}
+	return b
+}
+
+// getList splits a comma separated variable, dropping empty entries.
+func getList(key string) []string {
+	var list []string
+	for _, item := range strings.Split(os.Getenv(key), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+func getListDefault(key string, def []string) []string {
+	if list := getList(key); len(list) > 0 {
+		return list
+	}
+	return def
+}
@@ -0,0 +1,9 @@
+-- Denylist of access tokens revoked before expiry (e.g. on logout), keyed by
+-- the JWT jti claim. Rows can be dropped once expires_at has passed.
+CREATE TABLE IF NOT EXISTS revoked_tokens (
+    jti         TEXT PRIMARY KEY,
+    expires_at  TIMESTAMPTZ NOT NULL,
+    revoked_at  TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_revoked_tokens_expires_at ON revoked_tokens (expires_at);
@@ -0,0 +1,6 @@
+-- Accounts are deactivated rather than deleted so that patients.doctor_id and
+-- other history keep pointing at a real user.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS status TEXT NOT NULL DEFAULT 'active';
+
+-- The admin role has no profile table; create the first admin by hand, e.g.
+-- INSERT INTO users (email, role, password_hash) VALUES ('admin@clinic', 'admin', '<hash>');
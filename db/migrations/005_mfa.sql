@@ -0,0 +1,22 @@
+-- TOTP enrolment. A row with enabled = false is a pending enrolment that has
+-- not been confirmed with a valid code yet. last_used_step stops a code from
+-- being replayed within its validity window.
+CREATE TABLE IF NOT EXISTS user_mfa (
+    user_id         INTEGER PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    secret          TEXT        NOT NULL,
+    enabled         BOOLEAN     NOT NULL DEFAULT FALSE,
+    last_used_step  BIGINT,
+    confirmed_at    TIMESTAMPTZ,
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- Single-use recovery codes, stored as SHA-256 hashes.
+CREATE TABLE IF NOT EXISTS mfa_recovery_codes (
+    id          SERIAL PRIMARY KEY,
+    user_id     INTEGER     NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    code_hash   TEXT        NOT NULL,
+    used_at     TIMESTAMPTZ,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_mfa_recovery_codes_user_id ON mfa_recovery_codes (user_id);
@@ -0,0 +1,9 @@
+-- Consecutive failed login counters used for backoff and temporary lockout.
+-- Keys are prefixed with their type, e.g. 'email:doc@example.com' or
+-- 'ip:203.0.113.7'.
+CREATE TABLE IF NOT EXISTS login_attempts (
+    key              TEXT PRIMARY KEY,
+    failures         INTEGER     NOT NULL DEFAULT 0,
+    last_failure_at  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    blocked_until    TIMESTAMPTZ
+);
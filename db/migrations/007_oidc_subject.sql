@@ -0,0 +1,6 @@
+-- Links a user to their identity at the OIDC provider. The subject is set
+-- the first time the user signs in through SSO with a verified email that
+-- matches users.email, and is used for every later SSO login.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS oidc_subject TEXT;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_oidc_subject ON users (oidc_subject);
@@ -0,0 +1,15 @@
+-- Admin-issued keys for machine integrations such as lab analyzers and
+-- billing. Only a SHA-256 hash of the key is stored; prefix holds the first
+-- characters so admins can tell keys apart. scopes is a comma separated list.
+CREATE TABLE IF NOT EXISTS api_keys (
+    id            SERIAL PRIMARY KEY,
+    name          TEXT        NOT NULL,
+    prefix        TEXT        NOT NULL,
+    key_hash      TEXT        NOT NULL UNIQUE,
+    scopes        TEXT        NOT NULL,
+    created_by    INTEGER     NOT NULL REFERENCES users(id),
+    expires_at    TIMESTAMPTZ,
+    last_used_at  TIMESTAMPTZ,
+    revoked_at    TIMESTAMPTZ,
+    created_at    TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1,62 @@
+-- Role based permissions. A user can hold several roles; users.role stays
+-- the primary role that decides which profile (doctor or receptionist) the
+-- account has.
+CREATE TABLE IF NOT EXISTS roles (
+    name         TEXT PRIMARY KEY,
+    description  TEXT NOT NULL DEFAULT ''
+);
+
+CREATE TABLE IF NOT EXISTS permissions (
+    name         TEXT PRIMARY KEY,
+    description  TEXT NOT NULL DEFAULT ''
+);
+
+CREATE TABLE IF NOT EXISTS role_permissions (
+    role        TEXT NOT NULL REFERENCES roles(name) ON DELETE CASCADE,
+    permission  TEXT NOT NULL REFERENCES permissions(name) ON DELETE CASCADE,
+    PRIMARY KEY (role, permission)
+);
+
+CREATE TABLE IF NOT EXISTS user_roles (
+    user_id  INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    role     TEXT    NOT NULL REFERENCES roles(name) ON DELETE CASCADE,
+    PRIMARY KEY (user_id, role)
+);
+
+INSERT INTO roles (name, description) VALUES
+    ('admin', 'Manages staff accounts, roles and integrations'),
+    ('doctor', 'Reads and updates medical information of patients'),
+    ('receptionist', 'Registers and manages patient records')
+ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO permissions (name, description) VALUES
+    ('patient:create', 'Register patients'),
+    ('patient:read', 'Look up patient records'),
+    ('patient:update', 'Edit patient records'),
+    ('patient:delete', 'Delete patient records'),
+    ('medical:read', 'List assigned patients'),
+    ('medical:update', 'Update medical information'),
+    ('mfa:manage', 'Enrol in and disable multi-factor authentication'),
+    ('staff:manage', 'Create, edit and deactivate staff accounts'),
+    ('apikey:manage', 'Issue and revoke API keys'),
+    ('role:manage', 'Change role permissions and user roles'),
+    ('lockout:manage', 'Clear login lockouts')
+ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO role_permissions (role, permission) VALUES
+    ('receptionist', 'patient:create'),
+    ('receptionist', 'patient:read'),
+    ('receptionist', 'patient:update'),
+    ('receptionist', 'patient:delete'),
+    ('doctor', 'medical:read'),
+    ('doctor', 'medical:update'),
+    ('doctor', 'mfa:manage'),
+    ('admin', 'staff:manage'),
+    ('admin', 'apikey:manage'),
+    ('admin', 'role:manage'),
+    ('admin', 'lockout:manage')
+ON CONFLICT DO NOTHING;
+
+INSERT INTO user_roles (user_id, role)
+SELECT id, role FROM users
+ON CONFLICT DO NOTHING;
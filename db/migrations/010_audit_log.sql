@@ -0,0 +1,19 @@
+-- Append-only record of security relevant events such as denied access to
+-- patient records. user_id and api_key_id identify the caller, whichever
+-- applies.
+CREATE TABLE IF NOT EXISTS audit_log (
+    id             BIGSERIAL PRIMARY KEY,
+    user_id        INTEGER REFERENCES users(id),
+    api_key_id     INTEGER REFERENCES api_keys(id),
+    action         TEXT        NOT NULL,
+    resource_type  TEXT        NOT NULL,
+    resource_id    TEXT        NOT NULL DEFAULT '',
+    outcome        TEXT        NOT NULL,
+    severity       TEXT        NOT NULL DEFAULT 'info',
+    details        JSONB       NOT NULL DEFAULT '{}',
+    ip             TEXT        NOT NULL DEFAULT '',
+    created_at     TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_audit_log_created_at ON audit_log (created_at);
+CREATE INDEX IF NOT EXISTS idx_audit_log_resource ON audit_log (resource_type, resource_id);
@@ -0,0 +1,24 @@
+-- Break-the-glass grants: a doctor may open a patient they are not
+-- assigned to for a limited time after recording a justification. Every
+-- grant is also written to audit_log with high severity.
+CREATE TABLE IF NOT EXISTS emergency_access_grants (
+    id             SERIAL PRIMARY KEY,
+    doctor_id      INTEGER     NOT NULL REFERENCES users(id),
+    patient_id     INTEGER     NOT NULL REFERENCES patients(id) ON DELETE CASCADE,
+    justification  TEXT        NOT NULL,
+    granted_at     TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    expires_at     TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_emergency_access_doctor_patient
+    ON emergency_access_grants (doctor_id, patient_id, expires_at);
+
+INSERT INTO permissions (name, description) VALUES
+    ('emergency:access', 'Open unassigned patients in an emergency'),
+    ('audit:read', 'Review the audit log and emergency access grants')
+ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO role_permissions (role, permission) VALUES
+    ('doctor', 'emergency:access'),
+    ('admin', 'audit:read')
+ON CONFLICT DO NOTHING;
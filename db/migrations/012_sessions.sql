@@ -0,0 +1,16 @@
+-- One row per login. The id is the family_id of the session's refresh
+-- tokens and is carried in access tokens as the sid claim, so revoking a
+-- session here ends both its refresh chain and its outstanding access tokens.
+CREATE TABLE IF NOT EXISTS sessions (
+    id            TEXT        PRIMARY KEY,
+    user_id       INTEGER     NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    device        TEXT        NOT NULL DEFAULT '',
+    ip            TEXT        NOT NULL DEFAULT '',
+    user_agent    TEXT        NOT NULL DEFAULT '',
+    created_at    TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    last_seen_at  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    expires_at    TIMESTAMPTZ NOT NULL,
+    revoked_at    TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_sessions_user_id ON sessions (user_id);
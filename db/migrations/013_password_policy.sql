@@ -0,0 +1,14 @@
+-- password_changed_at drives the optional maximum password age. Existing
+-- accounts start counting from when this migration runs.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS password_changed_at TIMESTAMPTZ NOT NULL DEFAULT NOW();
+
+-- Hashes of the passwords each user has set, newest last, trimmed to the
+-- configured history length. Used to stop users from reusing passwords.
+CREATE TABLE IF NOT EXISTS password_history (
+    id             SERIAL PRIMARY KEY,
+    user_id        INTEGER     NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    password_hash  TEXT        NOT NULL,
+    created_at     TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_password_history_user_id ON password_history (user_id, id);
@@ -0,0 +1,26 @@
+-- Consult delegations: the doctor a patient is assigned to lets another
+-- doctor read ('read') or also update ('write') the patient's medical record
+-- until expires_at, or until the grant is revoked.
+CREATE TABLE IF NOT EXISTS patient_delegations (
+    id              SERIAL PRIMARY KEY,
+    patient_id      INTEGER     NOT NULL REFERENCES patients(id) ON DELETE CASCADE,
+    from_doctor_id  INTEGER     NOT NULL REFERENCES users(id),
+    to_doctor_id    INTEGER     NOT NULL REFERENCES users(id),
+    access          TEXT        NOT NULL CHECK (access IN ('read', 'write')),
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    expires_at      TIMESTAMPTZ NOT NULL,
+    revoked_at      TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_patient_delegations_to_doctor
+    ON patient_delegations (to_doctor_id, patient_id, expires_at);
+CREATE INDEX IF NOT EXISTS idx_patient_delegations_from_doctor
+    ON patient_delegations (from_doctor_id);
+
+INSERT INTO permissions (name, description) VALUES
+    ('delegation:manage', 'Share own patients with other doctors for a consult')
+ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO role_permissions (role, permission) VALUES
+    ('doctor', 'delegation:manage')
+ON CONFLICT DO NOTHING;
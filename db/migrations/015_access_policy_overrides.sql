@@ -0,0 +1,23 @@
+-- Temporary exemptions from the role network and working hours policy
+-- (ACCESS_POLICY_FILE), e.g. for a receptionist covering a night shift or
+-- working from home during an outage.
+CREATE TABLE IF NOT EXISTS access_policy_overrides (
+    id          SERIAL PRIMARY KEY,
+    user_id     INTEGER     NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    reason      TEXT        NOT NULL,
+    created_by  INTEGER     NOT NULL REFERENCES users(id),
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    expires_at  TIMESTAMPTZ NOT NULL,
+    revoked_at  TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_access_policy_overrides_user
+    ON access_policy_overrides (user_id, expires_at);
+
+INSERT INTO permissions (name, description) VALUES
+    ('access_policy:override', 'Exempt staff from network and working hours restrictions')
+ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO role_permissions (role, permission) VALUES
+    ('admin', 'access_policy:override')
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,14 @@
+-- Indexes for GET /api/receptionist/patients. Partial name and phone
+-- matches (ILIKE '%...%') use trigram indexes; the sort columns get B-tree
+-- indexes ending in id to match the keyset pagination order.
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+CREATE INDEX IF NOT EXISTS idx_patients_name_trgm
+    ON patients USING GIN (name gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS idx_patients_phone_trgm
+    ON patients USING GIN (phone gin_trgm_ops);
+
+CREATE INDEX IF NOT EXISTS idx_patients_doctor_id ON patients (doctor_id);
+CREATE INDEX IF NOT EXISTS idx_patients_created_at_id ON patients (created_at, id);
+CREATE INDEX IF NOT EXISTS idx_patients_name_id ON patients (name, id);
+CREATE INDEX IF NOT EXISTS idx_patients_age_id ON patients (age, id);
@@ -0,0 +1,6 @@
+-- Keyset pagination of GET /api/doctor/myPatients on (updated_at, id),
+-- newest first, and the "since" filter.
+CREATE INDEX IF NOT EXISTS idx_patients_doctor_updated_at_id
+    ON patients (doctor_id, updated_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS idx_patients_updated_at_id
+    ON patients (updated_at DESC, id DESC);
@@ -0,0 +1,9 @@
+-- Patients are soft-deleted: reads skip rows with deleted_at set, a
+-- receptionist can restore them, and rows are only removed for good once
+-- they have been deleted for longer than PATIENT_RETENTION. deleted_by is
+-- NULL when an API key deleted the patient.
+ALTER TABLE patients ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+ALTER TABLE patients ADD COLUMN IF NOT EXISTS deleted_by INTEGER REFERENCES users(id);
+
+CREATE INDEX IF NOT EXISTS idx_patients_deleted_at
+    ON patients (deleted_at) WHERE deleted_at IS NOT NULL;
@@ -0,0 +1,37 @@
+-- Immutable history of patient records. Every insert, update, soft delete
+-- and restore appends a revision in the same transaction as the change,
+-- holding the full row as JSON and the columns that differ from the
+-- previous revision. changed_by and api_key_id identify the caller,
+-- whichever applies. Revisions go when the purge job removes the patient.
+CREATE TABLE IF NOT EXISTS patient_revisions (
+    id             BIGSERIAL   PRIMARY KEY,
+    patient_id     INTEGER     NOT NULL REFERENCES patients(id) ON DELETE CASCADE,
+    revision       INTEGER     NOT NULL,
+    action         TEXT        NOT NULL CHECK (action IN ('baseline', 'create', 'update', 'delete', 'restore')),
+    snapshot       JSONB       NOT NULL,
+    changed_fields JSONB       NOT NULL DEFAULT '[]',
+    changed_by     INTEGER     REFERENCES users(id),
+    api_key_id     INTEGER     REFERENCES api_keys(id),
+    created_at     TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (patient_id, revision)
+);
+
+CREATE OR REPLACE FUNCTION patient_revisions_immutable() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'patient revisions cannot be modified';
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS patient_revisions_immutable ON patient_revisions;
+CREATE TRIGGER patient_revisions_immutable
+    BEFORE UPDATE ON patient_revisions
+    FOR EACH ROW EXECUTE FUNCTION patient_revisions_immutable();
+
+-- Existing patients start their history with a baseline of their current
+-- state, so that the first real change has something to diff against.
+INSERT INTO patient_revisions (patient_id, revision, action, snapshot, changed_fields, created_at)
+SELECT p.id, 1, 'baseline', to_jsonb(p),
+    (SELECT jsonb_agg(key ORDER BY key) FROM jsonb_object_keys(to_jsonb(p) - 'updated_at') AS key),
+    p.updated_at
+FROM patients p
+ON CONFLICT (patient_id, revision) DO NOTHING;
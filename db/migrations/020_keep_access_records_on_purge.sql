@@ -0,0 +1,6 @@
+-- Emergency access grants and consult delegations must outlive the patient
+-- they were for: admins review them after the fact, including after the
+-- purge job has removed a soft-deleted patient for good. patient_id keeps
+-- the ID of the removed patient, which is never reused.
+ALTER TABLE emergency_access_grants DROP CONSTRAINT IF EXISTS emergency_access_grants_patient_id_fkey;
+ALTER TABLE patient_delegations DROP CONSTRAINT IF EXISTS patient_delegations_patient_id_fkey;
@@ -0,0 +1,18 @@
+-- Patient history outlives the patient: the purge job removes the patient
+-- row but keeps its revisions and appends a final 'purge' revision, made by
+-- no user or API key. Revisions can be neither changed nor removed.
+ALTER TABLE patient_revisions DROP CONSTRAINT IF EXISTS patient_revisions_patient_id_fkey;
+
+ALTER TABLE patient_revisions DROP CONSTRAINT IF EXISTS patient_revisions_action_check;
+ALTER TABLE patient_revisions ADD CONSTRAINT patient_revisions_action_check
+    CHECK (action IN ('baseline', 'create', 'update', 'delete', 'restore', 'purge'));
+
+DROP TRIGGER IF EXISTS patient_revisions_immutable ON patient_revisions;
+CREATE TRIGGER patient_revisions_immutable
+    BEFORE UPDATE OR DELETE ON patient_revisions
+    FOR EACH ROW EXECUTE FUNCTION patient_revisions_immutable();
+
+DROP TRIGGER IF EXISTS patient_revisions_no_truncate ON patient_revisions;
+CREATE TRIGGER patient_revisions_no_truncate
+    BEFORE TRUNCATE ON patient_revisions
+    FOR EACH STATEMENT EXECUTE FUNCTION patient_revisions_immutable();
@@ -0,0 +1,673 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/Somvaded/assessment/models"
+	"github.com/Somvaded/assessment/repositories"
+	"github.com/Somvaded/assessment/utils"
+	"github.com/gin-gonic/gin"
+)
+
+type AdminHandler struct {
+	DB             *sql.DB
+	Throttle       *LoginThrottle
+	Permissions    *repositories.PermissionResolver
+	PasswordPolicy utils.PasswordPolicy
+}
+
+func NewAdminHandler(db *sql.DB, throttle *LoginThrottle, permissions *repositories.PermissionResolver, policy utils.PasswordPolicy) *AdminHandler {
+	return &AdminHandler{
+		DB:             db,
+		Throttle:       throttle,
+		Permissions:    permissions,
+		PasswordPolicy: policy,
+	}
+}
+
+// staffProfileRequest carries the profile fields shared by the create and
+// update endpoints. Doctor-only and receptionist-only fields are ignored for
+// the other role.
+type staffProfileRequest struct {
+	Name             string `json:"name" binding:"required"`
+	Phone            string `json:"phone"`
+	Specialty        string `json:"specialty"`
+	EmergencyContact string `json:"emergency_contact"`
+	LicenseNumber    string `json:"license_number"`
+	ExperienceYears  int    `json:"experience_years"`
+}
+
+func (p staffProfileRequest) profiles(role string) (*models.Doctor, *models.Receptionist) {
+	if role == "doctor" {
+		return &models.Doctor{
+			Name:             p.Name,
+			Specialty:        p.Specialty,
+			EmergencyContact: p.EmergencyContact,
+			LicenseNumber:    p.LicenseNumber,
+			ExperienceYears:  p.ExperienceYears,
+		}, nil
+	}
+	return nil, &models.Receptionist{
+		Name:  p.Name,
+		Phone: p.Phone,
+	}
+}
+
+func (a *AdminHandler) CreateStaff(c *gin.Context) {
+	var Request struct {
+		Email    string `json:"email" binding:"required,email"`
+		Password string `json:"password" binding:"required"`
+		Role     string `json:"role" binding:"required,oneof=doctor receptionist"`
+		staffProfileRequest
+	}
+	if err := c.ShouldBindJSON(&Request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if Request.Role == "doctor" && Request.LicenseNumber == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "license_number is required for doctors"})
+		return
+	}
+	if err := a.PasswordPolicy.Validate(Request.Password); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	hash, err := utils.HashPassword(Request.Password)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not hash password"})
+		return
+	}
+
+	user := models.User{
+		Email:        Request.Email,
+		Role:         Request.Role,
+		PasswordHash: hash,
+	}
+	doctor, receptionist := Request.profiles(Request.Role)
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+	account, err := repositories.CreateStaff(ctx, a.DB, user, doctor, receptionist)
+	if err != nil {
+		if errors.Is(err, repositories.ErrEmailTaken) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, account)
+}
+
+func (a *AdminHandler) ListStaff(c *gin.Context) {
+	var Request struct {
+		Role   string `form:"role" binding:"omitempty,oneof=doctor receptionist"`
+		Status string `form:"status"`
+	}
+	if err := c.ShouldBindQuery(&Request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+	accounts, err := repositories.ListStaff(ctx, a.DB, Request.Role, Request.Status)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, accounts)
+}
+
+func (a *AdminHandler) GetStaff(c *gin.Context) {
+	Request := struct {
+		UserID int `uri:"userid"`
+	}{}
+	if err := c.ShouldBindUri(&Request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+	account, err := repositories.FindStaffByID(ctx, a.DB, Request.UserID)
+	if err != nil {
+		if errors.Is(err, repositories.ErrStaffNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, account)
+}
+
+func (a *AdminHandler) UpdateStaff(c *gin.Context) {
+	Request := struct {
+		UserID int `uri:"userid"`
+	}{}
+	if err := c.ShouldBindUri(&Request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var StaffRequest struct {
+		Email    string `json:"email" binding:"required,email"`
+		Password string `json:"password"`
+		staffProfileRequest
+	}
+	if err := c.ShouldBindJSON(&StaffRequest); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	existing, err := repositories.FindStaffByID(ctx, a.DB, Request.UserID)
+	if err != nil {
+		if errors.Is(err, repositories.ErrStaffNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if existing.Role == "doctor" && StaffRequest.LicenseNumber == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "license_number is required for doctors"})
+		return
+	}
+
+	var hash string
+	if StaffRequest.Password != "" {
+		if err := a.PasswordPolicy.Validate(StaffRequest.Password); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		hash, err = utils.HashPassword(StaffRequest.Password)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "could not hash password"})
+			return
+		}
+	}
+
+	doctor, receptionist := StaffRequest.profiles(existing.Role)
+	account, err := repositories.UpdateStaff(ctx, a.DB, Request.UserID, StaffRequest.Email, hash, doctor, receptionist)
+	if err != nil {
+		switch {
+		case errors.Is(err, repositories.ErrStaffNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		case errors.Is(err, repositories.ErrEmailTaken):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, account)
+}
+
+// DeactivateStaff disables an account without deleting it, so patient
+// records that reference the user stay intact. A doctor's patients must be
+// moved with ?reassign_to=<doctor id> or left unassigned with
+// ?unassign_patients=true.
+func (a *AdminHandler) DeactivateStaff(c *gin.Context) {
+	Request := struct {
+		UserID int `uri:"userid"`
+	}{}
+	if err := c.ShouldBindUri(&Request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+	var reassign models.PatientReassignment
+	if err := c.ShouldBindQuery(&reassign); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	a.setStaffStatus(c, Request.UserID, models.StatusDeactivated, reassign)
+}
+
+// SetStaffStatus activates, suspends or deactivates an account. Suspended
+// and deactivated users are signed out everywhere and rejected on their
+// next request.
+func (a *AdminHandler) SetStaffStatus(c *gin.Context) {
+	Request := struct {
+		UserID int `uri:"userid"`
+	}{}
+	if err := c.ShouldBindUri(&Request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+	var Body struct {
+		Status string `json:"status" binding:"required,oneof=active suspended deactivated"`
+		models.PatientReassignment
+	}
+	if err := c.ShouldBindJSON(&Body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	a.setStaffStatus(c, Request.UserID, Body.Status, Body.PatientReassignment)
+}
+
+func (a *AdminHandler) setStaffStatus(c *gin.Context, userID int, status string, reassign models.PatientReassignment) {
+	if reassign.ReassignTo != nil && reassign.UnassignPatients {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "choose either reassign_to or unassign_patients"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+	reassigned, err := repositories.SetUserStatus(ctx, a.DB, userID, status, reassign, c.GetInt("user_id"))
+	if err != nil {
+		switch {
+		case errors.Is(err, repositories.ErrStaffNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		case errors.Is(err, repositories.ErrReassignmentRequired):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		case errors.Is(err, repositories.ErrReassignTargetInvalid):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "staff account " + status, "status": status, "patients_reassigned": reassigned})
+}
+
+// UnlockStaff clears the login and MFA failure counters of an account so a
+// locked-out user can sign in again before the lockout expires.
+func (a *AdminHandler) UnlockStaff(c *gin.Context) {
+	Request := struct {
+		UserID int `uri:"userid"`
+	}{}
+	if err := c.ShouldBindUri(&Request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+	account, err := repositories.FindStaffByID(ctx, a.DB, Request.UserID)
+	if err != nil {
+		if errors.Is(err, repositories.ErrStaffNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := a.Throttle.Reset(ctx, emailThrottleKey(account.Email), mfaThrottleKey(account.ID), passwordThrottleKey(account.ID)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "account unlocked"})
+}
+
+// RevokeStaffSessions signs a user out everywhere, for example when their
+// account is suspected to be compromised.
+func (a *AdminHandler) RevokeStaffSessions(c *gin.Context) {
+	Request := struct {
+		UserID int `uri:"userid"`
+	}{}
+	if err := c.ShouldBindUri(&Request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+	if _, err := repositories.FindStaffByID(ctx, a.DB, Request.UserID); err != nil {
+		if errors.Is(err, repositories.ErrStaffNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	revoked, err := repositories.RevokeUserSessions(ctx, a.DB, Request.UserID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "sessions revoked", "revoked": revoked})
+}
+
+func (a *AdminHandler) UnlockIP(c *gin.Context) {
+	Request := struct {
+		IP string `uri:"ip" binding:"required,ip"`
+	}{}
+	if err := c.ShouldBindUri(&Request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid IP address"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+	if err := a.Throttle.Reset(ctx, ipThrottleKey(Request.IP)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "IP address unlocked"})
+}
+
+// apiKeyPrefix marks keys issued by this service so they are easy to spot
+// in logs and secret scanners.
+const apiKeyPrefix = "pms_"
+
+// CreateAPIKey issues a key for a machine integration. The plaintext key is
+// returned only in this response; afterwards only its prefix is shown.
+func (a *AdminHandler) CreateAPIKey(c *gin.Context) {
+	var Request struct {
+		Name      string     `json:"name" binding:"required"`
+		Scopes    []string   `json:"scopes" binding:"required,min=1,dive,oneof=patients:read patients:write medical:read medical:write"`
+		ExpiresAt *time.Time `json:"expires_at"`
+	}
+	if err := c.ShouldBindJSON(&Request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if Request.ExpiresAt != nil && !Request.ExpiresAt.After(time.Now()) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "expires_at must be in the future"})
+		return
+	}
+
+	secret, err := utils.GenerateOpaqueToken(32)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not generate API key"})
+		return
+	}
+	plaintext := apiKeyPrefix + secret
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+	key, err := repositories.CreateAPIKey(ctx, a.DB, models.APIKey{
+		Name:      Request.Name,
+		Prefix:    plaintext[:len(apiKeyPrefix)+8],
+		KeyHash:   utils.HashToken(plaintext),
+		Scopes:    Request.Scopes,
+		CreatedBy: c.GetInt("user_id"),
+		ExpiresAt: Request.ExpiresAt,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{
+		"api_key": key,
+		"key":     plaintext,
+	})
+}
+
+func (a *AdminHandler) ListAPIKeys(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+	keys, err := repositories.ListAPIKeys(ctx, a.DB)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, keys)
+}
+
+func (a *AdminHandler) RevokeAPIKey(c *gin.Context) {
+	Request := struct {
+		KeyID int `uri:"keyid"`
+	}{}
+	if err := c.ShouldBindUri(&Request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid API key ID"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+	if err := repositories.RevokeAPIKey(ctx, a.DB, Request.KeyID); err != nil {
+		if errors.Is(err, repositories.ErrAPIKeyNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "API key revoked"})
+}
+
+func (a *AdminHandler) ListRoles(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+	roles, err := repositories.ListRoles(ctx, a.DB)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, roles)
+}
+
+func (a *AdminHandler) ListPermissions(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+	permissions, err := repositories.ListPermissions(ctx, a.DB)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, permissions)
+}
+
+// SetRolePermissions creates a role or replaces its permissions. Changes
+// apply to existing sessions once the permission cache expires.
+func (a *AdminHandler) SetRolePermissions(c *gin.Context) {
+	role := c.Param("role")
+	var Request struct {
+		Description string   `json:"description"`
+		Permissions []string `json:"permissions" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&Request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+	err := repositories.SetRolePermissions(ctx, a.DB, role, Request.Description, Request.Permissions)
+	if err != nil {
+		if errors.Is(err, repositories.ErrUnknownPermission) || errors.Is(err, repositories.ErrProtectedRole) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	a.Permissions.Invalidate()
+	c.JSON(http.StatusOK, gin.H{"role": role, "permissions": Request.Permissions})
+}
+
+func (a *AdminHandler) GetUserRoles(c *gin.Context) {
+	Request := struct {
+		UserID int `uri:"userid"`
+	}{}
+	if err := c.ShouldBindUri(&Request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+	roles, err := repositories.FindUserRoles(ctx, a.DB, Request.UserID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"user_id": Request.UserID, "roles": roles})
+}
+
+// SetUserRoles replaces the roles a user holds. The user's primary role and
+// profile are unchanged. The user is signed out everywhere and gets the new
+// roles on their next login.
+func (a *AdminHandler) SetUserRoles(c *gin.Context) {
+	Request := struct {
+		UserID int `uri:"userid"`
+	}{}
+	if err := c.ShouldBindUri(&Request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var RolesRequest struct {
+		Roles []string `json:"roles" binding:"required,min=1"`
+	}
+	if err := c.ShouldBindJSON(&RolesRequest); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+	err := repositories.SetUserRoles(ctx, a.DB, Request.UserID, RolesRequest.Roles)
+	if err != nil {
+		switch {
+		case errors.Is(err, repositories.ErrStaffNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		case errors.Is(err, repositories.ErrUnknownRole):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"user_id": Request.UserID, "roles": RolesRequest.Roles})
+}
+
+// ListAuditLog returns recent audit entries, newest first. Pass
+// severity=high to review emergency access.
+func (a *AdminHandler) ListAuditLog(c *gin.Context) {
+	var Request struct {
+		Severity string `form:"severity" binding:"omitempty,oneof=info warning high"`
+		Limit    int    `form:"limit" binding:"omitempty,min=1,max=500"`
+	}
+	if err := c.ShouldBindQuery(&Request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if Request.Limit == 0 {
+		Request.Limit = 100
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+	entries, err := repositories.ListAuditLog(ctx, a.DB, Request.Severity, Request.Limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, entries)
+}
+
+func (a *AdminHandler) ListEmergencyGrants(c *gin.Context) {
+	var Request struct {
+		Active bool `form:"active"`
+		Limit  int  `form:"limit" binding:"omitempty,min=1,max=500"`
+	}
+	if err := c.ShouldBindQuery(&Request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if Request.Limit == 0 {
+		Request.Limit = 100
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+	grants, err := repositories.ListEmergencyGrants(ctx, a.DB, Request.Active, Request.Limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, grants)
+}
+
+// CreateAccessOverride exempts a staff account from the network and working
+// hours restrictions of the access policy until expires_at.
+func (a *AdminHandler) CreateAccessOverride(c *gin.Context) {
+	var Request struct {
+		UserID    int       `json:"user_id" binding:"required"`
+		Reason    string    `json:"reason" binding:"required,min=10"`
+		ExpiresAt time.Time `json:"expires_at" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&Request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !Request.ExpiresAt.After(time.Now()) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "expires_at must be in the future"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+	override, err := repositories.CreateAccessOverride(ctx, a.DB, models.AccessOverride{
+		UserID:    Request.UserID,
+		Reason:    Request.Reason,
+		CreatedBy: c.GetInt("user_id"),
+		ExpiresAt: Request.ExpiresAt,
+	}, c.ClientIP())
+	if err != nil {
+		if errors.Is(err, repositories.ErrStaffNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, override)
+}
+
+// ListAccessOverrides returns access policy overrides, only the current ones
+// with ?active=true.
+func (a *AdminHandler) ListAccessOverrides(c *gin.Context) {
+	var Request struct {
+		Active bool `form:"active"`
+	}
+	if err := c.ShouldBindQuery(&Request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+	overrides, err := repositories.ListAccessOverrides(ctx, a.DB, Request.Active)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, overrides)
+}
+
+// RevokeAccessOverride ends an access policy override early.
+func (a *AdminHandler) RevokeAccessOverride(c *gin.Context) {
+	var Request struct {
+		OverrideID int `uri:"overrideid" binding:"required"`
+	}
+	if err := c.ShouldBindUri(&Request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid override ID"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+	if err := repositories.RevokeAccessOverride(ctx, a.DB, Request.OverrideID); err != nil {
+		if errors.Is(err, repositories.ErrAccessOverrideNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "access override revoked"})
+}
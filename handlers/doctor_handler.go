@@ -3,24 +3,39 @@ package handlers
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"fmt"
+	"log"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/Somvaded/assessment/config"
+	"github.com/Somvaded/assessment/mailer"
 	"github.com/Somvaded/assessment/models"
 	"github.com/Somvaded/assessment/repositories"
 	"github.com/gin-gonic/gin"
 )
 
 type DoctorHandler struct {
-	DB *sql.DB
+	DB     *sql.DB
+	Mailer mailer.Mailer
+	Config *config.Config
 }
 
-func NewDoctorHandler(db *sql.DB) *DoctorHandler {
+func NewDoctorHandler(db *sql.DB, m mailer.Mailer, cfg *config.Config) *DoctorHandler {
 	return &DoctorHandler{
-		DB: db,
+		DB:     db,
+		Mailer: m,
+		Config: cfg,
 	}
 }
 
+// GetAllPatientsAssigned pages through the doctor's assigned and delegated
+// patients, most recently updated first. since returns only patients
+// updated after that time and name filters on part of the name; pass the
+// next_cursor of a page as cursor to fetch the following one.
 func (d *DoctorHandler) GetAllPatientsAssigned(c *gin.Context) {
 	doctor_id ,exists := c.Get("user_id")
 	if doctor_id == nil || !exists {
@@ -29,17 +44,36 @@ func (d *DoctorHandler) GetAllPatientsAssigned(c *gin.Context) {
 		})
 		return
 	}
+	var Request struct {
+		Name   string     `form:"name"`
+		Since  *time.Time `form:"since"`
+		Limit  int        `form:"limit" binding:"omitempty,min=1,max=100"`
+		Cursor string     `form:"cursor"`
+	}
+	if err := c.ShouldBindQuery(&Request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 	ctx , cancel := context.WithTimeout(c.Request.Context(),10*time.Second)
 	defer cancel()
 
-	patients, err := repositories.FindPatientsByDoctorID(ctx, d.DB, doctor_id.(int))
+	page, err := repositories.FindPatientsByDoctorID(ctx, d.DB, doctor_id.(int), models.DocPatientQuery{
+		Name:   strings.TrimSpace(Request.Name),
+		Since:  Request.Since,
+		Limit:  Request.Limit,
+		Cursor: Request.Cursor,
+	})
 	if err != nil {
+		if errors.Is(err, repositories.ErrInvalidCursor) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": err.Error(),
 		})
 		return
 	}
-	c.JSON(http.StatusOK, patients)
+	c.JSON(http.StatusOK, page)
 }
 
 func (d *DoctorHandler) UpdatePatientDetail(c *gin.Context)  {
@@ -65,13 +99,306 @@ func (d *DoctorHandler) UpdatePatientDetail(c *gin.Context)  {
 	}
 	ctx , cancel := context.WithTimeout(c.Request.Context(),10*time.Second)
 	defer cancel()
-	updatedPatient,err := repositories.UpdateMedicalInfo(ctx, d.DB, Request.PatientId, updateData)
+	doctorID := c.GetInt("user_id")
+	updatedPatient,err := repositories.UpdateMedicalInfo(ctx, d.DB, Request.PatientId, doctorID, updateData)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": err.Error(),
-		})
+		switch {
+		case errors.Is(err, repositories.ErrPatientNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		case errors.Is(err, repositories.ErrPatientNotAssigned):
+			d.auditDenied(ctx, c, "patient.medical.update", Request.PatientId)
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": err.Error(),
+			})
+		}
 		return
 	}
 
 	c.JSON(http.StatusOK,updatedPatient)
-}
\ No newline at end of file
+}
+
+// GetPatient returns one patient the doctor is assigned to, holds an
+// emergency access grant for or has been delegated.
+func (d *DoctorHandler) GetPatient(c *gin.Context) {
+	var Request struct {
+		PatientId int `uri:"patientid"`
+	}
+	if err := c.ShouldBindUri(&Request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid patient ID"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+	patient, err := repositories.FindPatientForDoctor(ctx, d.DB, Request.PatientId, c.GetInt("user_id"))
+	if err != nil {
+		switch {
+		case errors.Is(err, repositories.ErrPatientNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		case errors.Is(err, repositories.ErrPatientNotAssigned):
+			d.auditDenied(ctx, c, "patient.read", Request.PatientId)
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, patient)
+}
+
+// PatientHistory lists the revisions of a patient the doctor may access,
+// newest first, limited to the fields doctors see.
+func (d *DoctorHandler) PatientHistory(c *gin.Context) {
+	var Request struct {
+		PatientID int `uri:"patientid" binding:"required"`
+	}
+	if err := c.ShouldBindUri(&Request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid patient ID"})
+		return
+	}
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+	if !d.canReadPatient(ctx, c, Request.PatientID) {
+		return
+	}
+	revisions, err := repositories.ListPatientRevisions(ctx, d.DB, Request.PatientID, repositories.DoctorPatientFields)
+	if err != nil {
+		if errors.Is(err, repositories.ErrPatientNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"revisions": revisions})
+}
+
+// PatientRevisionDiff shows the fields doctors see that one revision of a
+// patient changed.
+func (d *DoctorHandler) PatientRevisionDiff(c *gin.Context) {
+	var Request struct {
+		PatientID int `uri:"patientid" binding:"required"`
+		Revision  int `uri:"rev" binding:"required"`
+	}
+	if err := c.ShouldBindUri(&Request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid patient ID or revision"})
+		return
+	}
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+	if !d.canReadPatient(ctx, c, Request.PatientID) {
+		return
+	}
+	diff, err := repositories.DiffPatientRevision(ctx, d.DB, Request.PatientID, Request.Revision, repositories.DoctorPatientFields)
+	if err != nil {
+		if errors.Is(err, repositories.ErrRevisionNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, diff)
+}
+
+// canReadPatient writes the error response and returns false unless the
+// doctor may read the patient, as for GetPatient.
+func (d *DoctorHandler) canReadPatient(ctx context.Context, c *gin.Context, patientID int) bool {
+	_, err := repositories.FindPatientForDoctor(ctx, d.DB, patientID, c.GetInt("user_id"))
+	if err != nil {
+		switch {
+		case errors.Is(err, repositories.ErrPatientNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		case errors.Is(err, repositories.ErrPatientNotAssigned):
+			d.auditDenied(ctx, c, "patient.history.read", patientID)
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return false
+	}
+	return true
+}
+
+// RequestEmergencyAccess is the break-the-glass endpoint: it grants the
+// calling doctor time-boxed read and write access to a patient they are not
+// assigned to. The justification is stored with a high-severity audit entry
+// and the assigned doctor is notified by email.
+func (d *DoctorHandler) RequestEmergencyAccess(c *gin.Context) {
+	var Request struct {
+		PatientID       int    `json:"patient_id" binding:"required"`
+		Justification   string `json:"justification" binding:"required,min=20"`
+		DurationMinutes int    `json:"duration_minutes" binding:"omitempty,min=1"`
+	}
+	if err := c.ShouldBindJSON(&Request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	duration := d.Config.EmergencyAccessDefault
+	if Request.DurationMinutes > 0 {
+		duration = time.Duration(Request.DurationMinutes) * time.Minute
+	}
+	if duration > d.Config.EmergencyAccessMax {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("emergency access is limited to %s", d.Config.EmergencyAccessMax)})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+	grant, assigned, err := repositories.CreateEmergencyGrant(ctx, d.DB, models.EmergencyAccessGrant{
+		DoctorID:      c.GetInt("user_id"),
+		PatientID:     Request.PatientID,
+		Justification: Request.Justification,
+		ExpiresAt:     time.Now().Add(duration),
+	}, c.ClientIP())
+	if err != nil {
+		switch {
+		case errors.Is(err, repositories.ErrPatientNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		case errors.Is(err, repositories.ErrPatientAlreadyAssigned):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	if assigned != nil {
+		go d.notifyEmergencyAccess(*grant, *assigned)
+	}
+	c.JSON(http.StatusCreated, grant)
+}
+
+func (d *DoctorHandler) notifyEmergencyAccess(grant models.EmergencyAccessGrant, assigned models.Doctor) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	err := d.Mailer.Send(ctx, mailer.Message{
+		To:      assigned.Email,
+		Subject: "Emergency access to your patient",
+		Body: fmt.Sprintf(
+			"Dear %s,\n\nDoctor #%d used emergency access to open the record of your patient #%d until %s.\n\nJustification given:\n%s\n\nThis access has been recorded for review.",
+			assigned.Name,
+			grant.DoctorID,
+			grant.PatientID,
+			grant.ExpiresAt.Format(time.RFC1123),
+			grant.Justification,
+		),
+	})
+	if err != nil {
+		log.Println("Error sending emergency access notification:", err)
+	}
+}
+
+// CreateDelegation lets the doctor a patient is assigned to share the
+// record with another doctor, read-only or read-write, until expires_at.
+func (d *DoctorHandler) CreateDelegation(c *gin.Context) {
+	var Request struct {
+		PatientID int       `json:"patient_id" binding:"required"`
+		DoctorID  int       `json:"doctor_id" binding:"required"`
+		Access    string    `json:"access" binding:"required,oneof=read write"`
+		ExpiresAt time.Time `json:"expires_at" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&Request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !Request.ExpiresAt.After(time.Now()) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "expires_at must be in the future"})
+		return
+	}
+	if time.Until(Request.ExpiresAt) > d.Config.DelegationMax {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("delegations are limited to %s", d.Config.DelegationMax)})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+	delegation, err := repositories.CreateDelegation(ctx, d.DB, models.PatientDelegation{
+		PatientID:    Request.PatientID,
+		FromDoctorID: c.GetInt("user_id"),
+		ToDoctorID:   Request.DoctorID,
+		Access:       Request.Access,
+		ExpiresAt:    Request.ExpiresAt,
+	}, c.ClientIP())
+	if err != nil {
+		switch {
+		case errors.Is(err, repositories.ErrPatientNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		case errors.Is(err, repositories.ErrPatientNotAssigned):
+			d.auditDenied(ctx, c, "patient.delegate", Request.PatientID)
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		case errors.Is(err, repositories.ErrDelegationTargetInvalid):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+	c.JSON(http.StatusCreated, delegation)
+}
+
+// ListDelegations returns the active delegations the doctor has given or
+// received.
+func (d *DoctorHandler) ListDelegations(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+	delegations, err := repositories.ListDelegations(ctx, d.DB, c.GetInt("user_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, delegations)
+}
+
+// RevokeDelegation ends a delegation the doctor gave.
+func (d *DoctorHandler) RevokeDelegation(c *gin.Context) {
+	var Request struct {
+		DelegationID int `uri:"delegationid" binding:"required"`
+	}
+	if err := c.ShouldBindUri(&Request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid delegation ID"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+	err := repositories.RevokeDelegation(ctx, d.DB, Request.DelegationID, c.GetInt("user_id"), c.ClientIP())
+	if err != nil {
+		if errors.Is(err, repositories.ErrDelegationNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Delegation revoked"})
+}
+
+// auditDenied records an attempt to act on a patient the caller is not
+// assigned to.
+func (d *DoctorHandler) auditDenied(ctx context.Context, c *gin.Context, action string, patientID int) {
+	entry := models.AuditEntry{
+		Action:       action,
+		ResourceType: "patient",
+		ResourceID:   strconv.Itoa(patientID),
+		Outcome:      models.AuditOutcomeDenied,
+		Severity:     models.AuditSeverityWarning,
+		Details:      gin.H{"reason": repositories.ErrPatientNotAssigned.Error()},
+		IP:           c.ClientIP(),
+	}
+	if userID, ok := c.Get("user_id"); ok {
+		id := userID.(int)
+		entry.UserID = &id
+	}
+	if keyID, ok := c.Get("api_key_id"); ok {
+		id := keyID.(int)
+		entry.APIKeyID = &id
+	}
+	if err := repositories.InsertAuditLog(ctx, d.DB, entry); err != nil {
+		log.Println("Error writing audit log:", err)
+	}
+}
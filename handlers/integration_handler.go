@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/Somvaded/assessment/models"
+	"github.com/Somvaded/assessment/repositories"
+	"github.com/gin-gonic/gin"
+)
+
+// IntegrationHandler serves machine integrations authenticated with an API
+// key, such as lab analyzers, which act on patients without a signed-in
+// doctor.
+type IntegrationHandler struct {
+	DB *sql.DB
+}
+
+func NewIntegrationHandler(db *sql.DB) *IntegrationHandler {
+	return &IntegrationHandler{
+		DB: db,
+	}
+}
+
+// GetPatient returns the fields doctors see of a patient.
+func (h *IntegrationHandler) GetPatient(c *gin.Context) {
+	Request := struct {
+		PatientID int `uri:"patientid" binding:"required"`
+	}{}
+	if err := c.ShouldBindUri(&Request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid patient ID"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+	patient, err := repositories.FindPatientMedicalInfo(ctx, h.DB, Request.PatientID)
+	if err != nil {
+		if errors.Is(err, repositories.ErrPatientNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, patient)
+}
+
+// PushMedicalInfo replaces a patient's medical fields, as a doctor's
+// update does. The patient's history records the API key as the author.
+func (h *IntegrationHandler) PushMedicalInfo(c *gin.Context) {
+	Request := struct {
+		PatientID int `uri:"patientid" binding:"required"`
+	}{}
+	if err := c.ShouldBindUri(&Request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid patient ID"})
+		return
+	}
+	var updateData models.DocPatientUpdate
+	if err := c.ShouldBindJSON(&updateData); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+	patient, err := repositories.PushMedicalInfo(ctx, h.DB, Request.PatientID, c.GetInt("api_key_id"), updateData)
+	if err != nil {
+		if errors.Is(err, repositories.ErrPatientNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, patient)
+}
@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Somvaded/assessment/repositories"
+	"github.com/Somvaded/assessment/utils"
+)
+
+// LoginThrottle applies backoff and lockout to login attempts, counted both
+// per account and per client IP so that neither guessing one password nor
+// spraying many accounts from one address is cheap.
+type LoginThrottle struct {
+	Store repositories.LoginAttemptStore
+	// Account applies to email addresses and to MFA attempts per user.
+	Account utils.ThrottlePolicy
+	IP      utils.ThrottlePolicy
+}
+
+func emailThrottleKey(email string) string {
+	return "email:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func ipThrottleKey(ip string) string {
+	return "ip:" + ip
+}
+
+// resetThrottleKey counts password reset requests for an email or IP key
+// apart from login failures, so requesting resets cannot lock anyone out.
+func resetThrottleKey(key string) string {
+	return "reset:" + key
+}
+
+func mfaThrottleKey(userID int) string {
+	return "mfa:" + strconv.Itoa(userID)
+}
+
+// passwordThrottleKey counts wrong current passwords on password change, so
+// a stolen session cannot be used to guess the password.
+func passwordThrottleKey(userID int) string {
+	return "password:" + strconv.Itoa(userID)
+}
+
+// RetryAfter returns how long the caller has to wait before another attempt
+// for any of keys is allowed, or zero if none of them is blocked.
+func (t *LoginThrottle) RetryAfter(ctx context.Context, keys ...string) (time.Duration, error) {
+	var wait time.Duration
+	now := time.Now()
+	for _, key := range keys {
+		attempt, err := t.Store.Get(ctx, key)
+		if err != nil {
+			return 0, err
+		}
+		if attempt != nil && attempt.BlockedUntil.After(now) {
+			if remaining := attempt.BlockedUntil.Sub(now); remaining > wait {
+				wait = remaining
+			}
+		}
+	}
+	return wait, nil
+}
+
+// Fail records a failed attempt for key under policy and blocks the key for
+// as long as the policy requires.
+func (t *LoginThrottle) Fail(ctx context.Context, key string, policy utils.ThrottlePolicy) error {
+	attempt, err := t.Store.RecordFailure(ctx, key, policy.Window)
+	if err != nil {
+		return err
+	}
+	if block := policy.BlockDuration(attempt.Failures); block > 0 {
+		return t.Store.Block(ctx, key, attempt.LastFailureAt.Add(block))
+	}
+	return nil
+}
+
+func (t *LoginThrottle) Reset(ctx context.Context, keys ...string) error {
+	for _, key := range keys {
+		if err := t.Store.Reset(ctx, key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
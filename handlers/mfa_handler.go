@@ -0,0 +1,172 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"time"
+
+	"github.com/Somvaded/assessment/config"
+	"github.com/Somvaded/assessment/repositories"
+	"github.com/Somvaded/assessment/utils"
+	"github.com/gin-gonic/gin"
+)
+
+const recoveryCodeCount = 10
+
+type MFAHandler struct {
+	DB     *sql.DB
+	Config *config.Config
+}
+
+func NewMFAHandler(db *sql.DB, cfg *config.Config) *MFAHandler {
+	return &MFAHandler{
+		DB:     db,
+		Config: cfg,
+	}
+}
+
+// Enroll starts TOTP enrolment by generating a secret. MFA is not enforced
+// until the secret is confirmed with a valid code.
+func (m *MFAHandler) Enroll(c *gin.Context) {
+	userID := c.GetInt("user_id")
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	existing, err := repositories.FindMFA(ctx, m.DB, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if existing != nil && existing.Enabled {
+		c.JSON(http.StatusConflict, gin.H{"error": "MFA is already enabled"})
+		return
+	}
+
+	account, err := repositories.FindStaffByID(ctx, m.DB, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not generate secret"})
+		return
+	}
+	if err := repositories.SavePendingMFA(ctx, m.DB, userID, secret); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"secret":      secret,
+		"otpauth_url": utils.TOTPProvisioningURI(m.Config.MFAIssuer, account.Email, secret),
+	})
+}
+
+// Confirm enables MFA once the user proves their authenticator produces
+// valid codes, and returns the recovery codes. They are shown only once.
+func (m *MFAHandler) Confirm(c *gin.Context) {
+	var Request struct {
+		Code string `json:"code" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&Request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	userID := c.GetInt("user_id")
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	pending, err := repositories.FindMFA(ctx, m.DB, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if pending == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "MFA enrolment has not been started"})
+		return
+	}
+	if pending.Enabled {
+		c.JSON(http.StatusConflict, gin.H{"error": "MFA is already enabled"})
+		return
+	}
+
+	step, ok := utils.ValidateTOTP(pending.Secret, Request.Code, time.Now())
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid authentication code"})
+		return
+	}
+
+	codes, err := utils.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not generate recovery codes"})
+		return
+	}
+	hashes := make([]string, len(codes))
+	for i, code := range codes {
+		hashes[i] = utils.HashToken(code)
+	}
+
+	if err := repositories.EnableMFA(ctx, m.DB, userID, step, hashes); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message":        "MFA enabled",
+		"recovery_codes": codes,
+	})
+}
+
+// Disable turns MFA off. A current TOTP code or an unused recovery code is
+// required so a hijacked session alone cannot remove the second factor.
+func (m *MFAHandler) Disable(c *gin.Context) {
+	var Request struct {
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+	if err := c.ShouldBindJSON(&Request); err != nil || (Request.Code == "" && Request.RecoveryCode == "") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "code or recovery_code is required"})
+		return
+	}
+	userID := c.GetInt("user_id")
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	mfa, err := repositories.FindMFA(ctx, m.DB, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if mfa == nil || !mfa.Enabled {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "MFA is not enabled"})
+		return
+	}
+
+	var verified bool
+	if Request.Code != "" {
+		if step, ok := utils.ValidateTOTP(mfa.Secret, Request.Code, time.Now()); ok {
+			verified, err = repositories.ConsumeTOTPStep(ctx, m.DB, userID, step)
+		}
+	} else {
+		verified, err = repositories.ConsumeRecoveryCode(ctx, m.DB, userID, utils.HashToken(utils.NormalizeRecoveryCode(Request.RecoveryCode)))
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !verified {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid authentication code"})
+		return
+	}
+
+	if err := repositories.DisableMFA(ctx, m.DB, userID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "MFA disabled"})
+}
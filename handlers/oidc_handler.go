@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Somvaded/assessment/models"
+	"github.com/Somvaded/assessment/oidc"
+	"github.com/Somvaded/assessment/repositories"
+	"github.com/Somvaded/assessment/utils"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	oidcFlowCookie = "oidc_flow"
+	oidcFlowPath   = "/api/auth/oidc"
+	oidcFlowTTL    = 10 * time.Minute
+)
+
+// OIDCHandler signs staff in through the hospital group's IdP and then
+// starts the same session a password login would.
+type OIDCHandler struct {
+	*UserHandler
+	Provider *oidc.Provider
+}
+
+func NewOIDCHandler(users *UserHandler, provider *oidc.Provider) *OIDCHandler {
+	return &OIDCHandler{
+		UserHandler: users,
+		Provider:    provider,
+	}
+}
+
+// Login redirects the browser to the IdP. The state, nonce and PKCE verifier
+// are kept in a short-lived HttpOnly cookie scoped to the callback.
+func (h *OIDCHandler) Login(ctx *gin.Context) {
+	state, err1 := oidc.NewState()
+	nonce, err2 := oidc.NewState()
+	verifier, err3 := oidc.NewVerifier()
+	if err1 != nil || err2 != nil || err3 != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Login failed"})
+		return
+	}
+
+	c, cancel := context.WithTimeout(ctx.Request.Context(), 10*time.Second)
+	defer cancel()
+	target, err := h.Provider.AuthCodeURL(c, state, nonce, verifier)
+	if err != nil {
+		log.Println("Error starting OIDC login:", err)
+		ctx.JSON(http.StatusBadGateway, gin.H{"error": "Identity provider unavailable"})
+		return
+	}
+
+	// The IdP redirects back with a cross-site navigation, which drops
+	// SameSite=Strict cookies.
+	cookies := utils.Cookies()
+	if cookies.SameSite == http.SameSiteStrictMode {
+		cookies.SameSite = http.SameSiteLaxMode
+	}
+	cookies.Set(ctx.Writer, oidcFlowCookie, strings.Join([]string{state, nonce, verifier}, "."), int(oidcFlowTTL.Seconds()), oidcFlowPath, true)
+	ctx.Redirect(http.StatusFound, target)
+}
+
+// Callback completes the flow: it checks state, redeems the code, verifies
+// the ID token and maps the identity to an existing account by subject or
+// verified email. Unknown identities are not provisioned. Accounts with MFA
+// enabled get an mfa_token to complete at /api/login/mfa, as with a
+// password login.
+func (h *OIDCHandler) Callback(ctx *gin.Context) {
+	flow, _ := ctx.Cookie(oidcFlowCookie)
+	utils.SetCookie(ctx.Writer, oidcFlowCookie, "", -1, oidcFlowPath, true)
+
+	if idpErr := ctx.Query("error"); idpErr != "" {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Identity provider returned " + idpErr})
+		return
+	}
+
+	parts := strings.Split(flow, ".")
+	state := ctx.Query("state")
+	code := ctx.Query("code")
+	if len(parts) != 3 || code == "" || subtle.ConstantTimeCompare([]byte(parts[0]), []byte(state)) != 1 {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired login attempt"})
+		return
+	}
+
+	c, cancel := context.WithTimeout(ctx.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	claims, err := h.Provider.Exchange(c, code, parts[2], parts[1])
+	if err != nil {
+		log.Println("Error completing OIDC login:", err)
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Single sign-on failed"})
+		return
+	}
+
+	email := ""
+	if claims.EmailVerified {
+		email = claims.Email
+	}
+	account, err := repositories.FindStaffByOIDC(c, h.DB, claims.Subject, email)
+	if err != nil {
+		if errors.Is(err, repositories.ErrOIDCUserNotFound) {
+			ctx.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Login failed"})
+		return
+	}
+	if account.Status != models.StatusActive {
+		ctx.JSON(http.StatusForbidden, gin.H{"error": repositories.ErrAccountInactive.Error()})
+		return
+	}
+
+	user := &models.User{ID: account.ID, Email: account.Email, Role: account.Role, Status: account.Status}
+	if h.requireMFA(ctx, c, user) {
+		return
+	}
+	var profile any = user
+	switch account.Role {
+	case "doctor":
+		profile = account.Doctor
+	case "receptionist":
+		profile = account.Receptionist
+	}
+	h.startSession(ctx, c, user, profile)
+}
@@ -0,0 +1,118 @@
+package handlers_test
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/Somvaded/assessment/config"
+	"github.com/Somvaded/assessment/handlers"
+	"github.com/Somvaded/assessment/models"
+	"github.com/Somvaded/assessment/oidc"
+	"github.com/Somvaded/assessment/utils"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+// newStubIdP serves discovery, JWKS and a token endpoint that redeems any
+// code for an ID token for sub-123 carrying nonce.
+func newStubIdP(t *testing.T, nonce string) *httptest.Server {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+
+	var server *httptest.Server
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 server.URL,
+			"authorization_endpoint": server.URL + "/authorize",
+			"token_endpoint":         server.URL + "/token",
+			"jwks_uri":               server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "idp-key",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+			"iss":            server.URL,
+			"sub":            "sub-123",
+			"aud":            "client-1",
+			"exp":            time.Now().Add(time.Minute).Unix(),
+			"iat":            time.Now().Unix(),
+			"nonce":          nonce,
+			"email":          "doc@example.com",
+			"email_verified": true,
+		})
+		token.Header["kid"] = "idp-key"
+		signed, _ := token.SignedString(key)
+		json.NewEncoder(w).Encode(map[string]string{"id_token": signed, "token_type": "Bearer"})
+	})
+	server = httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestOIDCCallback_RequiresMFA(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	idp := newStubIdP(t, "nonce-1")
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectQuery("SELECT (.+) FROM users u (.+) WHERE u.oidc_subject = \\$1").
+		WithArgs("sub-123").
+		WillReturnRows(sqlmock.NewRows([]string{
+			"id", "email", "role", "status",
+			"d_name", "specialty", "d_emergency_contact", "license_number", "experience_years", "d_created_at", "d_updated_at",
+			"r_name", "r_phone", "r_created_at", "r_updated_at",
+		}).AddRow(
+			5, "doc@example.com", "doctor", models.StatusActive,
+			"Dr. Who", "ENT", "", "LIC9", 0, time.Now(), time.Now(),
+			nil, nil, nil, nil,
+		))
+	mock.ExpectQuery("FROM user_mfa WHERE user_id = \\$1").
+		WithArgs(5).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "secret", "enabled", "last_used_step", "confirmed_at", "created_at"}).
+			AddRow(5, "SECRET", true, nil, time.Now(), time.Now()))
+
+	users := handlers.NewUserHandler(db, &config.Config{}, nil, nil, utils.PasswordPolicy{})
+	h := handlers.NewOIDCHandler(users, oidc.NewProvider(oidc.Config{
+		Issuer:       idp.URL,
+		ClientID:     "client-1",
+		ClientSecret: "s3cret",
+		RedirectURL:  "http://localhost:8080/api/auth/oidc/callback",
+	}))
+	router := gin.New()
+	router.GET("/api/auth/oidc/callback", h.Callback)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/auth/oidc/callback?state=state-1&code=the-code", nil)
+	req.AddCookie(&http.Cookie{Name: "oidc_flow", Value: "state-1.nonce-1.verifier-1"})
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var body map[string]any
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	assert.Equal(t, true, body["mfa_required"])
+	assert.NotEmpty(t, body["mfa_token"])
+	assert.NotContains(t, body, "access_token")
+	for _, cookie := range rec.Result().Cookies() {
+		assert.NotEqual(t, "auth_token", cookie.Name, "No session before the second factor")
+	}
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
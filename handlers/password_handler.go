@@ -0,0 +1,211 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/Somvaded/assessment/config"
+	"github.com/Somvaded/assessment/mailer"
+	"github.com/Somvaded/assessment/repositories"
+	"github.com/Somvaded/assessment/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// resetQueueSize bounds the password reset emails waiting to be sent.
+// Requests arriving while the queue is full are dropped.
+const resetQueueSize = 100
+
+type PasswordHandler struct {
+	DB       *sql.DB
+	Mailer   mailer.Mailer
+	Config   *config.Config
+	Policy   utils.PasswordPolicy
+	Throttle *LoginThrottle
+	resets   chan string
+}
+
+func NewPasswordHandler(db *sql.DB, m mailer.Mailer, cfg *config.Config, policy utils.PasswordPolicy, throttle *LoginThrottle) *PasswordHandler {
+	p := &PasswordHandler{
+		DB:       db,
+		Mailer:   m,
+		Config:   cfg,
+		Policy:   policy,
+		Throttle: throttle,
+		resets:   make(chan string, resetQueueSize),
+	}
+	go p.sendResetEmails()
+	return p
+}
+
+// ForgotPassword always answers with the same status and message. The user
+// lookup and email delivery happen in the background, one at a time, so
+// neither the body nor the response time reveals whether the address is
+// registered. Requests are throttled per client IP, which gets 429, and per
+// email, where requests over the limit are accepted but no email is sent.
+func (p *PasswordHandler) ForgotPassword(c *gin.Context) {
+	var Request struct {
+		Email string `json:"email" binding:"required,email"`
+	}
+	if err := c.ShouldBindJSON(&Request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "a valid email is required"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	emailKey := resetThrottleKey(emailThrottleKey(Request.Email))
+	ipKey := resetThrottleKey(ipThrottleKey(c.ClientIP()))
+	wait, err := p.Throttle.RetryAfter(ctx, ipKey)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not request password reset"})
+		return
+	}
+	if wait > 0 {
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many password reset requests, try again later"})
+		return
+	}
+	if err := p.Throttle.Fail(ctx, ipKey, p.Throttle.IP); err != nil {
+		log.Println("Error recording password reset request:", err)
+	}
+
+	wait, err = p.Throttle.RetryAfter(ctx, emailKey)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not request password reset"})
+		return
+	}
+	if wait <= 0 {
+		if err := p.Throttle.Fail(ctx, emailKey, p.Throttle.Account); err != nil {
+			log.Println("Error recording password reset request:", err)
+		}
+		select {
+		case p.resets <- Request.Email:
+		default:
+			log.Println("Password reset queue is full, dropping request")
+		}
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message": "If an account exists for this email, a password reset link has been sent",
+	})
+}
+
+// sendResetEmails delivers queued password reset requests until the queue
+// is closed.
+func (p *PasswordHandler) sendResetEmails() {
+	for email := range p.resets {
+		p.sendResetEmail(email)
+	}
+}
+
+func (p *PasswordHandler) sendResetEmail(email string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	user, err := repositories.FindActiveUserByEmail(ctx, p.DB, email)
+	if err != nil {
+		log.Println("Error looking up user for password reset:", err)
+		return
+	}
+	if user == nil {
+		return
+	}
+
+	token, err := utils.GenerateOpaqueToken(32)
+	if err != nil {
+		log.Println("Error generating password reset token:", err)
+		return
+	}
+	err = repositories.CreatePasswordResetToken(ctx, p.DB, user.ID, utils.HashToken(token), time.Now().Add(p.Config.PasswordResetTTL))
+	if err != nil {
+		log.Println("Error storing password reset token:", err)
+		return
+	}
+
+	link, err := url.Parse(p.Config.PasswordResetURL)
+	if err != nil {
+		log.Println("Invalid PASSWORD_RESET_URL:", err)
+		return
+	}
+	query := link.Query()
+	query.Set("token", token)
+	link.RawQuery = query.Encode()
+
+	err = p.Mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf(
+			"A password reset was requested for your account.\n\nUse the link below within %s to choose a new password:\n%s\n\nIf you did not request this, you can ignore this email.",
+			p.Config.PasswordResetTTL,
+			link.String(),
+		),
+	})
+	if err != nil {
+		log.Println("Error sending password reset email:", err)
+	}
+}
+
+func (p *PasswordHandler) ResetPassword(c *gin.Context) {
+	var Request struct {
+		Token       string `json:"token" binding:"required"`
+		NewPassword string `json:"new_password" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&Request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := p.Policy.Validate(Request.NewPassword); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	tokenHash := utils.HashToken(Request.Token)
+	if p.Policy.History > 0 {
+		userID, err := repositories.FindResetTokenUser(ctx, p.DB, tokenHash)
+		if err != nil {
+			if errors.Is(err, repositories.ErrInvalidResetToken) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "could not reset password"})
+			return
+		}
+		hashes, _, err := repositories.FindPasswordHashes(ctx, p.DB, userID, p.Policy.History)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "could not reset password"})
+			return
+		}
+		if utils.PasswordReused(Request.NewPassword, hashes) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "password was used recently, choose a different one"})
+			return
+		}
+	}
+
+	hash, err := utils.HashPassword(Request.NewPassword)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not hash password"})
+		return
+	}
+	err = repositories.ResetPassword(ctx, p.DB, tokenHash, hash, p.Policy.History)
+	if err != nil {
+		if errors.Is(err, repositories.ErrInvalidResetToken) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not reset password"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "password has been reset"})
+}
@@ -3,7 +3,13 @@ package handlers
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
 	"net/http"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/Somvaded/assessment/models"
@@ -21,6 +27,20 @@ func NewReceptionistHandler(db *sql.DB) *ReceptionistHandler {
 	}
 }
 
+// patientActor identifies the caller for a patient's history.
+func patientActor(c *gin.Context) models.PatientActor {
+	var actor models.PatientActor
+	if userID, ok := c.Get("user_id"); ok {
+		id := userID.(int)
+		actor.UserID = &id
+	}
+	if keyID, ok := c.Get("api_key_id"); ok {
+		id := keyID.(int)
+		actor.APIKeyID = &id
+	}
+	return actor
+}
+
 func (r *ReceptionistHandler) FindPatient(c *gin.Context){
 
 	Request := struct {
@@ -36,7 +56,12 @@ func (r *ReceptionistHandler) FindPatient(c *gin.Context){
 	defer cancel()
 	patient , err := repositories.FindPatients(ctx, r.DB , Request.AadharID)
 	if err != nil {
+		if errors.Is(err, repositories.ErrPatientNotFound) {
+			c.JSON(http.StatusNotFound,gin.H{"error":err.Error()})
+			return
+		}
 		c.JSON(http.StatusBadRequest,gin.H{"error":err.Error()})
+		return
 	}
 	c.JSON(http.StatusOK,patient)
 }
@@ -89,7 +114,7 @@ func (r *ReceptionistHandler) InsertPatient(c *gin.Context){
 
 	ctx , cancel := context.WithTimeout(c.Request.Context(),10*time.Second)
 	defer cancel()
-	patient_id ,err := repositories.InsertPatient(ctx,r.DB,patient)
+	patient_id ,err := repositories.InsertPatient(ctx,r.DB,patient,patientActor(c))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError,gin.H{"error":err.Error()})
 		return
@@ -159,9 +184,13 @@ func (r *ReceptionistHandler) UpdatePatient(c *gin.Context){
 	ctx , cancel := context.WithTimeout(c.Request.Context(),10*time.Second)
 	defer cancel()
 
-	res ,err := repositories.UpdatePatient(ctx,r.DB,patient)
+	res ,err := repositories.UpdatePatient(ctx,r.DB,patient,patientActor(c))
 
 	if err != nil {
+		if errors.Is(err, repositories.ErrPatientNotFound) {
+			c.JSON(http.StatusNotFound,gin.H{"error":err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError,gin.H{"error":err.Error()})
 		return
 	}
@@ -169,6 +198,178 @@ func (r *ReceptionistHandler) UpdatePatient(c *gin.Context){
 }
 
 
+// patientPatchDecoders decode and validate the value a merge patch sets
+// for the columns in repositories.PatientPatchColumns that take more than
+// any string; the other columns use patchString.
+var patientPatchDecoders = map[string]func(json.RawMessage) (any, error){
+	"name":   patchRequiredString,
+	"phone":  patchRequiredString,
+	"gender": patchRequiredString,
+	"aadhar": patchRequiredString,
+	"age": func(raw json.RawMessage) (any, error) {
+		var age int
+		if err := json.Unmarshal(raw, &age); err != nil || age < 0 {
+			return nil, errors.New("must be a non-negative integer")
+		}
+		return age, nil
+	},
+	"dob": func(raw json.RawMessage) (any, error) {
+		var dob string
+		if err := json.Unmarshal(raw, &dob); err != nil {
+			return nil, errors.New("must be a date in YYYY-MM-DD format")
+		}
+		parsed, err := time.Parse("2006-01-02", dob)
+		if err != nil {
+			return nil, errors.New("must be a date in YYYY-MM-DD format")
+		}
+		return parsed, nil
+	},
+	"doctor_id": func(raw json.RawMessage) (any, error) {
+		var doctorID int
+		if err := json.Unmarshal(raw, &doctorID); err != nil || doctorID <= 0 {
+			return nil, errors.New("must be a doctor ID or null")
+		}
+		return doctorID, nil
+	},
+	"consent": func(raw json.RawMessage) (any, error) {
+		var consent bool
+		if err := json.Unmarshal(raw, &consent); err != nil {
+			return nil, errors.New("must be a boolean")
+		}
+		return consent, nil
+	},
+}
+
+func patchString(raw json.RawMessage) (any, error) {
+	var value string
+	if err := json.Unmarshal(raw, &value); err != nil {
+		return nil, errors.New("must be a string")
+	}
+	return value, nil
+}
+
+// patchRequiredString is patchString for the fields that identify a
+// patient, which cannot be blank.
+func patchRequiredString(raw json.RawMessage) (any, error) {
+	value, err := patchString(raw)
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(value.(string)) == "" {
+		return nil, errors.New("must not be empty")
+	}
+	return value, nil
+}
+
+// patientPatchRemovals are the values null stores for the fields a merge
+// patch may remove, as RFC 7396 patches do: the doctor is unassigned and
+// optional text is cleared. The fields that identify a patient have no
+// empty value, so null on those is rejected instead.
+var patientPatchRemovals = map[string]any{
+	"doctor_id":           nil,
+	"emergency_contact":   "",
+	"payment_info":        "",
+	"known_allergies":     "",
+	"medications":         "",
+	"other_health_issues": "",
+	"doctor_notes":        "",
+}
+
+// decodePatientMergePatch turns an RFC 7396 merge patch of a patient into
+// the columns to change. The patch must be an object; fields it leaves out
+// stay as they are.
+func decodePatientMergePatch(body []byte) (map[string]any, error) {
+	var patch map[string]json.RawMessage
+	if err := json.Unmarshal(body, &patch); err != nil || patch == nil {
+		return nil, errors.New("merge patch must be a JSON object")
+	}
+	fields := make([]string, 0, len(patch))
+	for field := range patch {
+		fields = append(fields, field)
+	}
+	slices.Sort(fields)
+
+	changes := map[string]any{}
+	for _, field := range fields {
+		if !slices.Contains(repositories.PatientPatchColumns, field) {
+			switch field {
+			case "id", "created_at", "updated_at":
+				return nil, fmt.Errorf("%s cannot be changed", field)
+			}
+			return nil, fmt.Errorf("unknown field %s", field)
+		}
+		raw := patch[field]
+		if string(raw) == "null" {
+			value, ok := patientPatchRemovals[field]
+			if !ok {
+				return nil, fmt.Errorf("%s cannot be removed", field)
+			}
+			changes[field] = value
+			continue
+		}
+		decode, ok := patientPatchDecoders[field]
+		if !ok {
+			decode = patchString
+		}
+		value, err := decode(raw)
+		if err != nil {
+			return nil, fmt.Errorf("%s %w", field, err)
+		}
+		changes[field] = value
+	}
+	return changes, nil
+}
+
+// PatchPatient applies an RFC 7396 JSON merge patch to a patient: only the
+// fields present in the body change. null unassigns the patient or clears
+// optional text; unlike RFC 7396, null on name, phone, age, dob, gender,
+// aadhar or consent is rejected because those fields cannot be empty, as is
+// a blank name, phone, gender or aadhar. The request must be sent as application/merge-patch+json or application/json.
+func (r *ReceptionistHandler) PatchPatient(c *gin.Context) {
+	Request := struct {
+		PatientId int `uri:"patientid"`
+	}{}
+	if err := c.ShouldBindUri(&Request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	mediaType, _, err := mime.ParseMediaType(c.GetHeader("Content-Type"))
+	if err != nil || (mediaType != "application/merge-patch+json" && mediaType != "application/json") {
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": "content type must be application/merge-patch+json"})
+		return
+	}
+	body, err := c.GetRawData()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	changes, err := decodePatientMergePatch(body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+	patient, err := repositories.PatchPatient(ctx, r.DB, Request.PatientId, changes, patientActor(c))
+	if err != nil {
+		switch {
+		case errors.Is(err, repositories.ErrPatientNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		case errors.Is(err, repositories.ErrPatientDoctorInvalid):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, repositories.ErrAadharTaken):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, patient)
+}
+
+// DeletePatient soft-deletes a patient; RestorePatient brings the record
+// back until it is purged.
 func (r *ReceptionistHandler) DeletePatient(c *gin.Context){
 	Request := struct {
 		PatientId int `uri:"patientid"`
@@ -180,10 +381,140 @@ func (r *ReceptionistHandler) DeletePatient(c *gin.Context){
 	}
 	ctx , cancel := context.WithTimeout(c.Request.Context(),10*time.Second)
 	defer cancel()
-	err = repositories.DeletePatient(ctx,r.DB,Request.PatientId)
+	err = repositories.DeletePatient(ctx,r.DB,Request.PatientId,patientActor(c))
 	if err != nil {
+		if errors.Is(err, repositories.ErrPatientNotFound) {
+			c.JSON(http.StatusNotFound,gin.H{"error":err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError,gin.H{"error":err.Error()})
 		return
 	}
 	c.JSON(http.StatusOK,gin.H{"message":"patient deleted successfully"})
-}
\ No newline at end of file
+}
+
+// RestorePatient undoes a delete that has not been purged yet.
+func (r *ReceptionistHandler) RestorePatient(c *gin.Context) {
+	Request := struct {
+		PatientId int `uri:"patientid"`
+	}{}
+	if err := c.ShouldBindUri(&Request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+	patient, err := repositories.RestorePatient(ctx, r.DB, Request.PatientId, patientActor(c))
+	if err != nil {
+		if errors.Is(err, repositories.ErrPatientNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "no deleted patient with this ID"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, patient)
+}
+
+// SearchPatients lists patients matching optional name, phone, doctor,
+// gender, age and registration date filters, one page at a time. Pass the
+// next_cursor of a page as cursor to fetch the following one.
+func (r *ReceptionistHandler) SearchPatients(c *gin.Context) {
+	var Request struct {
+		Name        string     `form:"name"`
+		Phone       string     `form:"phone"`
+		DoctorID    *int       `form:"doctor_id"`
+		Gender      string     `form:"gender"`
+		MinAge      *int       `form:"min_age" binding:"omitempty,min=0"`
+		MaxAge      *int       `form:"max_age" binding:"omitempty,min=0"`
+		CreatedFrom *time.Time `form:"created_from"`
+		CreatedTo   *time.Time `form:"created_to"`
+		Sort        string     `form:"sort" binding:"omitempty,oneof=name age created_at updated_at"`
+		Order       string     `form:"order" binding:"omitempty,oneof=asc desc"`
+		Limit       int        `form:"limit" binding:"omitempty,min=1,max=100"`
+		Cursor      string     `form:"cursor"`
+	}
+	if err := c.ShouldBindQuery(&Request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if Request.MinAge != nil && Request.MaxAge != nil && *Request.MinAge > *Request.MaxAge {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "min_age must not be greater than max_age"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+	page, err := repositories.SearchPatients(ctx, r.DB, models.PatientSearch{
+		Name:        strings.TrimSpace(Request.Name),
+		Phone:       strings.TrimSpace(Request.Phone),
+		DoctorID:    Request.DoctorID,
+		Gender:      Request.Gender,
+		MinAge:      Request.MinAge,
+		MaxAge:      Request.MaxAge,
+		CreatedFrom: Request.CreatedFrom,
+		CreatedTo:   Request.CreatedTo,
+		Sort:        Request.Sort,
+		Order:       Request.Order,
+		Limit:       Request.Limit,
+		Cursor:      Request.Cursor,
+	})
+	if err != nil {
+		if errors.Is(err, repositories.ErrInvalidCursor) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, page)
+}
+
+// PatientHistory lists every revision of a patient, newest first, including
+// those of a deleted patient that has not been purged yet.
+func (r *ReceptionistHandler) PatientHistory(c *gin.Context) {
+	var Request struct {
+		PatientID int `uri:"patientid" binding:"required"`
+	}
+	if err := c.ShouldBindUri(&Request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid patient ID"})
+		return
+	}
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+	revisions, err := repositories.ListPatientRevisions(ctx, r.DB, Request.PatientID, nil)
+	if err != nil {
+		if errors.Is(err, repositories.ErrPatientNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"revisions": revisions})
+}
+
+// PatientRevisionDiff shows the fields one revision changed, with their
+// values before and after.
+func (r *ReceptionistHandler) PatientRevisionDiff(c *gin.Context) {
+	var Request struct {
+		PatientID int `uri:"patientid" binding:"required"`
+		Revision  int `uri:"rev" binding:"required"`
+	}
+	if err := c.ShouldBindUri(&Request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid patient ID or revision"})
+		return
+	}
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+	diff, err := repositories.DiffPatientRevision(ctx, r.DB, Request.PatientID, Request.Revision, nil)
+	if err != nil {
+		if errors.Is(err, repositories.ErrRevisionNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, diff)
+}
@@ -0,0 +1,55 @@
+package handlers_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/Somvaded/assessment/handlers"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPatchPatient_NullRemovesOptionalFields(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.PATCH("/patients/:patientid", func(c *gin.Context) {
+		c.Set("user_id", 4)
+	}, handlers.NewReceptionistHandler(db).PatchPatient)
+
+	call := func(body string) int {
+		req := httptest.NewRequest(http.MethodPatch, "/patients/1", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/merge-patch+json")
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("UPDATE patients SET doctor_id = \\$2, known_allergies = \\$3, updated_at = NOW\\(\\) WHERE id = \\$1").
+		WithArgs(1, nil, "").
+		WillReturnRows(sqlmock.NewRows([]string{
+			"id", "name", "phone", "age", "dob", "gender", "emergency_contact", "aadhar",
+			"doctor_id", "payment_info", "known_allergies", "medications", "other_health_issues",
+			"doctor_notes", "consent", "created_at", "updated_at",
+		}).AddRow(1, "John Doe", "9876543210", 30, time.Now(), "male", "1234567890", "1234-5678-9012",
+			nil, "Paid", "", "", "", "", true, time.Now(), time.Now()))
+	mock.ExpectExec("INSERT INTO patient_revisions").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	assert.Equal(t, http.StatusOK, call(`{"doctor_id": null, "known_allergies": null}`))
+	assert.Equal(t, http.StatusBadRequest, call(`{"phone": null}`), "Required fields cannot be removed")
+	assert.Equal(t, http.StatusBadRequest, call(`{"created_at": "2026-01-01"}`))
+	for _, field := range []string{"name", "phone", "gender", "aadhar"} {
+		assert.Equal(t, http.StatusBadRequest, call(`{"`+field+`": ""}`), field+" cannot be blanked")
+		assert.Equal(t, http.StatusBadRequest, call(`{"`+field+`": "  "}`), field+" cannot be blanked")
+	}
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
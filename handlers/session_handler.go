@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/Somvaded/assessment/repositories"
+	"github.com/gin-gonic/gin"
+)
+
+// SessionHandler lets signed-in users see and end their own sessions.
+type SessionHandler struct {
+	DB *sql.DB
+}
+
+func NewSessionHandler(db *sql.DB) *SessionHandler {
+	return &SessionHandler{
+		DB: db,
+	}
+}
+
+// ListSessions returns the caller's active sessions, marking the one the
+// request was made from as current.
+func (h *SessionHandler) ListSessions(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	sessions, err := repositories.ListSessions(ctx, h.DB, c.GetInt("user_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	current := c.GetString("session_id")
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID == current
+	}
+	c.JSON(http.StatusOK, sessions)
+}
+
+// RevokeSession ends one of the caller's sessions. Access tokens issued to
+// it are rejected from the next request on, and its refresh token can no
+// longer be used.
+func (h *SessionHandler) RevokeSession(c *gin.Context) {
+	Request := struct {
+		SessionID string `uri:"id" binding:"required"`
+	}{}
+	if err := c.ShouldBindUri(&Request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid session ID"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+	err := repositories.RevokeSession(ctx, h.DB, c.GetInt("user_id"), Request.SessionID)
+	if err != nil {
+		if errors.Is(err, repositories.ErrSessionNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "session revoked"})
+}
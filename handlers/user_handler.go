@@ -3,9 +3,16 @@ package handlers
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"log"
+	"math"
 	"net/http"
+	"strconv"
 	"time"
 
+	"github.com/Somvaded/assessment/config"
+	"github.com/Somvaded/assessment/middlewares"
+	"github.com/Somvaded/assessment/models"
 	"github.com/Somvaded/assessment/repositories"
 	"github.com/Somvaded/assessment/utils"
 	"github.com/gin-gonic/gin"
@@ -13,13 +20,21 @@ import (
 
 
 type UserHandler struct {
-	DB *sql.DB
+	DB             *sql.DB
+	Config         *config.Config
+	Revocations    repositories.TokenRevocationStore
+	Throttle       *LoginThrottle
+	PasswordPolicy utils.PasswordPolicy
 }
 
 
-func NewUserHandler (db *sql.DB) *UserHandler {
+func NewUserHandler (db *sql.DB, cfg *config.Config, revocations repositories.TokenRevocationStore, throttle *LoginThrottle, policy utils.PasswordPolicy) *UserHandler {
 	return &UserHandler{
 		DB: db,
+		Config: cfg,
+		Revocations: revocations,
+		Throttle: throttle,
+		PasswordPolicy: policy,
 	}
 }
 
@@ -33,30 +48,485 @@ func(h *UserHandler) Login( ctx *gin.Context){
 		ctx.JSON(http.StatusBadRequest, gin.H{
 			"error": "bad request",
 		})
-		return 
+		return
 	}
 	c, cancel := context.WithTimeout(ctx.Request.Context(), 10* time.Second)
 	defer cancel()
+
+	emailKey := emailThrottleKey(Request.Email)
+	ipKey := ipThrottleKey(ctx.ClientIP())
+	if h.rejectThrottled(ctx, c, emailKey, ipKey) {
+		return
+	}
+
 	user , doctor, receptionist, err := repositories.FindUserByEmail(c,h.DB,Request.Email,Request.Password)
 
 	if err != nil {
+		if errors.Is(err, repositories.ErrAccountInactive) {
+			ctx.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+		if !errors.Is(err, repositories.ErrInvalidCredentials) {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Login failed"})
+			return
+		}
+		if err := h.Throttle.Fail(c, emailKey, h.Throttle.Account); err != nil {
+			log.Println("Error recording login failure:", err)
+		}
+		if err := h.Throttle.Fail(c, ipKey, h.Throttle.IP); err != nil {
+			log.Println("Error recording login failure:", err)
+		}
 		ctx.JSON(http.StatusUnauthorized, gin.H{
 			"error": err.Error(),
 		})
-		return 
+		return
+	}
+	if err := h.Throttle.Reset(c, emailKey); err != nil {
+		log.Println("Error resetting login failures:", err)
+	}
+
+	if h.requireMFA(ctx, c, user) {
+		return
+	}
+
+	var profile any = user
+	switch user.Role {
+	case "doctor":
+		profile = doctor
+	case "receptionist":
+		profile = receptionist
+	}
+	h.startSession(ctx, c, user, profile)
+}
+
+// requireMFA answers with an mfa_token instead of a session when user has
+// MFA enabled, so that the second factor is checked by LoginMFA whichever
+// way the first one was given. It returns true once it has responded.
+func (h *UserHandler) requireMFA(ctx *gin.Context, c context.Context, user *models.User) bool {
+	mfa, err := repositories.FindMFA(c, h.DB, user.ID)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Login failed"})
+		return true
+	}
+	if mfa == nil || !mfa.Enabled {
+		return false
+	}
+	mfaToken, err := utils.GenerateMFAToken(user.ID, user.Role)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Token generation failed"})
+		return true
+	}
+	ctx.JSON(http.StatusOK, gin.H{
+		"mfa_required": true,
+		"mfa_token":    mfaToken,
+		"expires_in":   int(utils.MFATokenTTL.Seconds()),
+	})
+	return true
+}
+
+// LoginMFA completes a login for an account with MFA enabled by exchanging
+// the mfa_token from the password step plus a TOTP or recovery code for the
+// usual session tokens.
+func (h *UserHandler) LoginMFA(ctx *gin.Context) {
+	var Request struct {
+		MFAToken     string `json:"mfa_token" binding:"required"`
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+	if err := ctx.ShouldBindJSON(&Request); err != nil || (Request.Code == "" && Request.RecoveryCode == "") {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "mfa_token and either code or recovery_code are required"})
+		return
+	}
+
+	claims, err := utils.VerifyJWT(Request.MFAToken)
+	if err != nil || claims.Purpose != models.PurposeMFA {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired mfa_token"})
+		return
+	}
+
+	c, cancel := context.WithTimeout(ctx.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	revoked, err := h.Revocations.IsRevoked(c, claims.ID)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Login failed"})
+		return
+	}
+	if revoked {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired mfa_token"})
+		return
+	}
+
+	mfaKey := mfaThrottleKey(claims.UserID)
+	if h.rejectThrottled(ctx, c, mfaKey) {
+		return
+	}
+
+	mfa, err := repositories.FindMFA(c, h.DB, claims.UserID)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Login failed"})
+		return
+	}
+	if mfa == nil || !mfa.Enabled {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired mfa_token"})
+		return
+	}
+
+	var verified bool
+	if Request.Code != "" {
+		if step, ok := utils.ValidateTOTP(mfa.Secret, Request.Code, time.Now()); ok {
+			verified, err = repositories.ConsumeTOTPStep(c, h.DB, mfa.UserID, step)
+		}
+	} else {
+		verified, err = repositories.ConsumeRecoveryCode(c, h.DB, mfa.UserID, utils.HashToken(utils.NormalizeRecoveryCode(Request.RecoveryCode)))
+	}
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Login failed"})
+		return
+	}
+	if !verified {
+		if err := h.Throttle.Fail(c, mfaKey, h.Throttle.Account); err != nil {
+			log.Println("Error recording MFA failure:", err)
+		}
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid authentication code"})
+		return
+	}
+	if err := h.Throttle.Reset(c, mfaKey); err != nil {
+		log.Println("Error resetting MFA failures:", err)
+	}
+
+	// The mfa_token is single use once it has produced a session.
+	if err := h.Revocations.Revoke(c, claims.ID, claims.ExpiresAt.Time); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Login failed"})
+		return
+	}
+
+	account, err := repositories.FindStaffByID(c, h.DB, claims.UserID)
+	if err != nil {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired mfa_token"})
+		return
+	}
+	if account.Status != models.StatusActive {
+		ctx.JSON(http.StatusForbidden, gin.H{"error": repositories.ErrAccountInactive.Error()})
+		return
+	}
+
+	user := &models.User{ID: account.ID, Email: account.Email, Role: account.Role, Status: account.Status}
+	var profile any = user
+	switch account.Role {
+	case "doctor":
+		profile = account.Doctor
+	case "receptionist":
+		profile = account.Receptionist
+	}
+	h.startSession(ctx, c, user, profile)
+}
+
+// rejectThrottled answers 429 with a Retry-After header and returns true when
+// any of keys is currently blocked.
+func (h *UserHandler) rejectThrottled(ctx *gin.Context, c context.Context, keys ...string) bool {
+	wait, err := h.Throttle.RetryAfter(c, keys...)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Login failed"})
+		return true
+	}
+	if wait <= 0 {
+		return false
+	}
+	ctx.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	ctx.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many failed login attempts, try again later"})
+	return true
+}
+
+// tokenDeliveryBody is the token_delivery query value that makes login and
+// refresh return tokens in the JSON body instead of setting cookies, for
+// mobile apps and scripts that send Authorization: Bearer headers.
+const tokenDeliveryBody = "body"
+
+// startSession records a session for the requesting device, issues an
+// access token bound to it and a new refresh token family, and delivers
+// them together with profile.
+func (h *UserHandler) startSession(ctx *gin.Context, c context.Context, user *models.User, profile any) {
+	familyID, err := utils.GenerateOpaqueToken(16)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Token generation failed"})
+		return
+	}
+	refreshToken, err := utils.GenerateOpaqueToken(32)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Token generation failed"})
+		return
+	}
+	expiresAt := time.Now().Add(h.Config.RefreshTokenTTL)
+	err = repositories.CreateSession(c, h.DB, models.Session{
+		ID:        familyID,
+		UserID:    user.ID,
+		Device:    utils.DeviceName(ctx.Request.UserAgent()),
+		IP:        ctx.ClientIP(),
+		UserAgent: ctx.Request.UserAgent(),
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Token generation failed"})
+		return
+	}
+	err = repositories.CreateRefreshToken(c, h.DB, user.ID, familyID, utils.HashToken(refreshToken), expiresAt)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Token generation failed"})
+		return
+	}
+
+	token, err := h.issueAccessToken(c, user, familyID)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Token generation failed"})
+		return
+	}
+
+	h.deliverTokens(ctx, ctx.Query("token_delivery") == tokenDeliveryBody, token, refreshToken, profile)
+}
+
+// issueAccessToken signs an access token for sessionID carrying every role
+// user holds and whether their password has passed its maximum age.
+func (h *UserHandler) issueAccessToken(c context.Context, user *models.User, sessionID string) (string, error) {
+	roles, err := repositories.FindUserRoles(c, h.DB, user.ID)
+	if err != nil {
+		return "", err
+	}
+	changedAt, err := repositories.FindPasswordChangedAt(c, h.DB, user.ID)
+	if err != nil {
+		return "", err
+	}
+	return utils.GenerateSessionJWT(models.Claims{
+		UserID:          user.ID,
+		Role:            user.Role,
+		Roles:           roles,
+		SessionID:       sessionID,
+		PasswordExpired: h.PasswordPolicy.Expired(changedAt),
+	})
+}
+
+// deliverTokens either returns the tokens in the response body or sets them
+// as HttpOnly cookies and writes profile as the body, the browser default.
+func (h *UserHandler) deliverTokens(ctx *gin.Context, inBody bool, accessToken string, refreshToken string, profile any) {
+	if !inBody {
+		if err := h.setAuthCookies(ctx, accessToken, refreshToken); err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Token generation failed"})
+			return
+		}
+		ctx.JSON(http.StatusOK, profile)
+		return
+	}
+	ctx.Header("Cache-Control", "no-store")
+	ctx.JSON(http.StatusOK, gin.H{
+		"access_token":  accessToken,
+		"token_type":    "Bearer",
+		"expires_in":    int(utils.AccessTokenTTL.Seconds()),
+		"refresh_token": refreshToken,
+		"user":          profile,
+	})
+}
+
+// Refresh exchanges a refresh token for a new access token and a new
+// refresh token. The presented refresh token cannot be used again. Browser
+// clients send it as the refresh_token cookie; body-mode clients post it as
+// JSON and get the new tokens back in the body.
+func (h *UserHandler) Refresh(ctx *gin.Context) {
+	refreshToken, err := ctx.Cookie("refresh_token")
+	inBody := false
+	if err != nil || refreshToken == "" {
+		var Request struct {
+			RefreshToken string `json:"refresh_token"`
+		}
+		if err := ctx.ShouldBindJSON(&Request); err != nil || Request.RefreshToken == "" {
+			ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Missing refresh token"})
+			return
+		}
+		refreshToken = Request.RefreshToken
+		inBody = true
+	}
+
+	newRefreshToken, err := utils.GenerateOpaqueToken(32)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Token generation failed"})
+		return
+	}
+
+	c, cancel := context.WithTimeout(ctx.Request.Context(), 10*time.Second)
+	defer cancel()
+	user, sessionID, err := repositories.RotateRefreshToken(c, h.DB, utils.HashToken(refreshToken), utils.HashToken(newRefreshToken), time.Now().Add(h.Config.RefreshTokenTTL))
+	if err != nil {
+		if !inBody {
+			h.clearAuthCookies(ctx)
+		}
+		if errors.Is(err, repositories.ErrInvalidRefreshToken) || errors.Is(err, repositories.ErrRefreshTokenReused) {
+			ctx.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Token refresh failed"})
+		return
+	}
+
+	token, err := h.issueAccessToken(c, user, sessionID)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Token generation failed"})
+		return
+	}
+
+	h.deliverTokens(ctx, inBody, token, newRefreshToken, gin.H{"id": user.ID, "email": user.Email, "role": user.Role})
+}
+
+// Logout revokes the caller's access token, session and refresh token
+// family and clears the auth cookies. Tokens are taken from the cookies,
+// the Authorization header and a refresh_token JSON field, whichever are
+// present. It succeeds even when the access token has already expired so
+// that a shared workstation always ends up logged out.
+func (h *UserHandler) Logout(ctx *gin.Context) {
+	c, cancel := context.WithTimeout(ctx.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	var Request struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	_ = ctx.ShouldBindJSON(&Request)
+
+	accessTokens := []string{utils.BearerToken(ctx.GetHeader("Authorization"))}
+	if tokenString, err := ctx.Cookie("auth_token"); err == nil {
+		accessTokens = append(accessTokens, tokenString)
+	}
+	for _, tokenString := range accessTokens {
+		if tokenString == "" {
+			continue
+		}
+		if claims, err := utils.VerifyJWT(tokenString); err == nil && claims.ID != "" {
+			if err := h.Revocations.Revoke(c, claims.ID, claims.ExpiresAt.Time); err != nil {
+				ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Logout failed"})
+				return
+			}
+			if claims.SessionID != "" {
+				if err := repositories.RevokeRefreshTokenFamily(c, h.DB, claims.SessionID); err != nil {
+					ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Logout failed"})
+					return
+				}
+			}
+		}
+	}
+
+	refreshTokens := []string{Request.RefreshToken}
+	if refreshToken, err := ctx.Cookie("refresh_token"); err == nil {
+		refreshTokens = append(refreshTokens, refreshToken)
+	}
+	for _, refreshToken := range refreshTokens {
+		if refreshToken == "" {
+			continue
+		}
+		if err := repositories.RevokeRefreshToken(c, h.DB, utils.HashToken(refreshToken)); err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Logout failed"})
+			return
+		}
+	}
+
+	h.clearAuthCookies(ctx)
+	ctx.JSON(http.StatusOK, gin.H{"message": "logged out successfully"})
+}
+
+// ChangePassword replaces the caller's password after checking the current
+// one and the password policy. Every other session of the user is ended;
+// the calling session gets a new access token, as a cookie or in the body
+// depending on how the old one was sent.
+func (h *UserHandler) ChangePassword(ctx *gin.Context) {
+	var Request struct {
+		CurrentPassword string `json:"current_password" binding:"required"`
+		NewPassword     string `json:"new_password" binding:"required"`
+	}
+	if err := ctx.ShouldBindJSON(&Request); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
-	
-	token, err := utils.GenerateJWT(user.ID, user.Role)
+
+	c, cancel := context.WithTimeout(ctx.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	userID := ctx.GetInt("user_id")
+	passwordKey := passwordThrottleKey(userID)
+	if h.rejectThrottled(ctx, c, passwordKey) {
+		return
+	}
+
+	hashes, _, err := repositories.FindPasswordHashes(c, h.DB, userID, h.PasswordPolicy.History)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "could not change password"})
+		return
+	}
+	if utils.ComparePassword(hashes[0], Request.CurrentPassword) != nil {
+		if err := h.Throttle.Fail(c, passwordKey, h.Throttle.Account); err != nil {
+			log.Println("Error recording password change failure:", err)
+		}
+		ctx.JSON(http.StatusForbidden, gin.H{"error": "current password is incorrect"})
+		return
+	}
+	if err := h.Throttle.Reset(c, passwordKey); err != nil {
+		log.Println("Error resetting password change failures:", err)
+	}
+
+	if err := h.PasswordPolicy.Validate(Request.NewPassword); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if h.PasswordPolicy.History > 0 && utils.PasswordReused(Request.NewPassword, hashes) {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "password was used recently, choose a different one"})
+		return
+	}
+
+	hash, err := utils.HashPassword(Request.NewPassword)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "could not hash password"})
+		return
+	}
+	sessionID := ctx.GetString("session_id")
+	if err := repositories.ChangePassword(c, h.DB, userID, hash, h.PasswordPolicy.History, sessionID); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "could not change password"})
+		return
+	}
+
+	// The caller's token may carry pwd_exp; replace it so they can carry on.
+	token, err := h.issueAccessToken(c, &models.User{ID: userID, Role: ctx.GetString("role")}, sessionID)
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Token generation failed"})
 		return
 	}
+	if err := h.Revocations.Revoke(c, ctx.GetString("jti"), time.Now().Add(utils.AccessTokenTTL)); err != nil {
+		log.Println("Error revoking replaced access token:", err)
+	}
+	if ctx.GetString("auth_source") == middlewares.TokenSourceCookie {
+		utils.SetCookie(ctx.Writer, "auth_token", token, int(utils.AccessTokenTTL.Seconds()), "/", true)
+		ctx.JSON(http.StatusOK, gin.H{"message": "password changed"})
+		return
+	}
+	ctx.Header("Cache-Control", "no-store")
+	ctx.JSON(http.StatusOK, gin.H{
+		"message":      "password changed",
+		"access_token": token,
+		"token_type":   "Bearer",
+		"expires_in":   int(utils.AccessTokenTTL.Seconds()),
+	})
+}
 
-	if user.Role == "doctor"{
-		ctx.SetCookie("auth_token",token,3600*24,"/","",false,true)
-		ctx.JSON(http.StatusOK,doctor)
-	} else{
-		ctx.SetCookie("auth_token",token,3600*24,"/","",false,true)
-		ctx.JSON(http.StatusOK,receptionist)
+// setAuthCookies sets the session cookies and a fresh CSRF token that the
+// front-end must echo in the X-CSRF-Token header on state-changing requests.
+// No cookie is set if the CSRF token cannot be generated.
+func (h *UserHandler) setAuthCookies(ctx *gin.Context, accessToken string, refreshToken string) error {
+	csrfToken, err := utils.GenerateOpaqueToken(32)
+	if err != nil {
+		return err
 	}
-}
\ No newline at end of file
+	utils.SetCookie(ctx.Writer, "auth_token", accessToken, int(utils.AccessTokenTTL.Seconds()), "/", true)
+	utils.SetCookie(ctx.Writer, "refresh_token", refreshToken, int(h.Config.RefreshTokenTTL.Seconds()), "/api", true)
+	utils.SetCookie(ctx.Writer, middlewares.CSRFCookie, csrfToken, int(h.Config.RefreshTokenTTL.Seconds()), "/", false)
+	return nil
+}
+
+func (h *UserHandler) clearAuthCookies(ctx *gin.Context) {
+	utils.SetCookie(ctx.Writer, "auth_token", "", -1, "/", true)
+	utils.SetCookie(ctx.Writer, "refresh_token", "", -1, "/api", true)
+	utils.SetCookie(ctx.Writer, middlewares.CSRFCookie, "", -1, "/", false)
+}
@@ -0,0 +1,33 @@
+package mailer_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Somvaded/assessment/mailer"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOutboxMailer_WritesMessage(t *testing.T) {
+	dir := t.TempDir()
+	m := mailer.NewOutboxMailer(dir, "noreply@clinic.test")
+
+	err := m.Send(context.Background(), mailer.Message{
+		To:      "doc@example.com",
+		Subject: "Reset your password",
+		Body:    "line one\nline two",
+	})
+	assert.NoError(t, err)
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.eml"))
+	assert.NoError(t, err)
+	assert.Len(t, files, 1)
+
+	content, err := os.ReadFile(files[0])
+	assert.NoError(t, err)
+	assert.Contains(t, string(content), "To: doc@example.com\r\n")
+	assert.Contains(t, string(content), "Subject: Reset your password\r\n")
+	assert.Contains(t, string(content), "line one\r\nline two")
+}
@@ -1,51 +1,311 @@
 package middlewares
 
 import (
+	"errors"
+	"log"
+	"net"
 	"net/http"
+	"slices"
+	"time"
 
+	"github.com/Somvaded/assessment/models"
+	"github.com/Somvaded/assessment/repositories"
 	"github.com/Somvaded/assessment/utils"
 	"github.com/gin-gonic/gin"
 )
 
-func Protect() gin.HandlerFunc{
+// ProtectOptions holds the stores Protect consults once a token's signature
+// and expiry have been verified. A nil field skips that check.
+type ProtectOptions struct {
+	Revocations repositories.TokenRevocationStore
+	// TokenSources lists where to look for the access token, in order of
+	// precedence: TokenSourceCookie and/or TokenSourceHeader. Empty means
+	// cookie first, then header.
+	TokenSources []string
+	// APIKeys authenticates requests carrying an X-API-Key header. When nil
+	// the header is ignored.
+	APIKeys repositories.APIKeyStore
+	// Permissions resolves the caller's roles to the permissions checked by
+	// RequirePermission. When nil users are granted no permissions.
+	Permissions *repositories.PermissionResolver
+	// Sessions rejects tokens whose session has been revoked and records
+	// when each session was last used. Tokens without a sid claim are not
+	// checked.
+	Sessions repositories.SessionStore
+	// Users rejects tokens of accounts that have been suspended or
+	// deactivated since the token was issued.
+	Users repositories.UserStatusStore
+	// AccessPolicy restricts roles to network ranges and working hours.
+	// Roles it does not allow for the request are dropped before
+	// permissions are resolved; when none remain the request is rejected
+	// unless AccessOverrides exempts the user. Nil allows everything.
+	AccessPolicy    *utils.AccessPolicy
+	AccessOverrides repositories.AccessOverrideStore
+	// Audit records access policy denials, which are logged either way.
+	Audit repositories.AuditRecorder
+}
+
+const (
+	TokenSourceCookie = "cookie"
+	TokenSourceHeader = "header"
+	// AuthSourceAPIKey is the auth_source of requests authenticated with an
+	// API key. Such requests carry "scopes" instead of a user and role.
+	AuthSourceAPIKey = "api_key"
+)
+
+// extractToken returns the first access token found in sources and the
+// source it came from.
+func extractToken(c *gin.Context, sources []string) (string, string) {
+	if len(sources) == 0 {
+		sources = []string{TokenSourceCookie, TokenSourceHeader}
+	}
+	for _, source := range sources {
+		switch source {
+		case TokenSourceCookie:
+			if token, err := c.Cookie("auth_token"); err == nil && token != "" {
+				return token, source
+			}
+		case TokenSourceHeader:
+			if token := utils.BearerToken(c.GetHeader("Authorization")); token != "" {
+				return token, source
+			}
+		}
+	}
+	return "", ""
+}
+
+func Protect(opts ProtectOptions) gin.HandlerFunc{
 	return func(c *gin.Context) {
-		tokenString ,err := c.Cookie("auth_token")
-		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Missing auth_token cookie"})
+		if apiKey := c.GetHeader("X-API-Key"); apiKey != "" && opts.APIKeys != nil {
+			authenticateAPIKey(c, opts.APIKeys, apiKey)
+			return
+		}
+
+		tokenString, source := extractToken(c, opts.TokenSources)
+		if tokenString == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Missing auth_token cookie or Authorization header"})
 			c.Abort()
 			return
 		}
 		claims, err := utils.VerifyJWT(tokenString)
-		if err != nil {
+		if err != nil || claims.Purpose != "" {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
 			c.Abort()
 			return
 		}
 
+		if opts.Revocations != nil {
+			revoked, err := opts.Revocations.IsRevoked(c.Request.Context(), claims.ID)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not verify token"})
+				c.Abort()
+				return
+			}
+			if revoked {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Token has been revoked"})
+				c.Abort()
+				return
+			}
+		}
+
+		if opts.Sessions != nil && claims.SessionID != "" {
+			active, err := opts.Sessions.Active(c.Request.Context(), claims.SessionID)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not verify session"})
+				c.Abort()
+				return
+			}
+			if !active {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Session has been revoked"})
+				c.Abort()
+				return
+			}
+			if err := opts.Sessions.Touch(c.Request.Context(), claims.SessionID); err != nil {
+				log.Println("Error recording session activity:", err)
+			}
+		}
+
+		if opts.Users != nil {
+			status, err := opts.Users.Status(c.Request.Context(), claims.UserID)
+			if err != nil && !errors.Is(err, repositories.ErrStaffNotFound) {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not verify account"})
+				c.Abort()
+				return
+			}
+			if status != models.StatusActive {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": repositories.ErrAccountInactive.Error()})
+				c.Abort()
+				return
+			}
+		}
+
+		// Tokens issued before multi-role support only carry the primary role.
+		roles := claims.Roles
+		if len(roles) == 0 {
+			roles = []string{claims.Role}
+		}
+		if opts.AccessPolicy != nil {
+			var ok bool
+			if roles, ok = enforceAccessPolicy(c, opts, claims.UserID, roles); !ok {
+				return
+			}
+		}
+		permissions := []string{}
+		if opts.Permissions != nil {
+			permissions, err = opts.Permissions.Permissions(c.Request.Context(), roles)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not resolve permissions"})
+				c.Abort()
+				return
+			}
+		}
+
 		c.Set("user_id", claims.UserID)
 		c.Set("role", claims.Role)
+		c.Set("roles", roles)
+		c.Set("permissions", permissions)
+		c.Set("jti", claims.ID)
+		c.Set("session_id", claims.SessionID)
+		c.Set("password_expired", claims.PasswordExpired)
+		c.Set("auth_source", source)
 
 		c.Next()
 	}
 }
 
-func CheckRole(role string) gin.HandlerFunc{
+// enforceAccessPolicy returns the roles the access policy allows for this
+// request. If it allows none and the user holds no override, the denial is
+// logged and audited, the request is aborted with 403 and ok is false. The
+// client IP only honours X-Forwarded-For from TRUSTED_PROXIES.
+func enforceAccessPolicy(c *gin.Context, opts ProtectOptions, userID int, roles []string) ([]string, bool) {
+	ip := net.ParseIP(c.ClientIP())
+	now := time.Now()
+	allowed := []string{}
+	denied := map[string]string{}
+	for _, role := range roles {
+		if err := opts.AccessPolicy.Check(role, ip, now); err != nil {
+			denied[role] = err.Error()
+			continue
+		}
+		allowed = append(allowed, role)
+	}
+	if len(denied) == 0 {
+		return roles, true
+	}
+
+	if opts.AccessOverrides != nil {
+		overridden, err := opts.AccessOverrides.Active(c.Request.Context(), userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not verify access policy override"})
+			c.Abort()
+			return nil, false
+		}
+		if overridden {
+			return roles, true
+		}
+	}
+	if len(allowed) > 0 {
+		return allowed, true
+	}
+
+	log.Printf("Access policy denied user %d from %s on %s %s: %v", userID, c.ClientIP(), c.Request.Method, c.FullPath(), denied)
+	if opts.Audit != nil {
+		err := opts.Audit.Record(c.Request.Context(), models.AuditEntry{
+			UserID:       &userID,
+			Action:       "access_policy.deny",
+			ResourceType: "route",
+			ResourceID:   c.Request.Method + " " + c.FullPath(),
+			Outcome:      models.AuditOutcomeDenied,
+			Severity:     models.AuditSeverityWarning,
+			Details:      map[string]any{"roles": denied},
+			IP:           c.ClientIP(),
+		})
+		if err != nil {
+			log.Println("Error writing audit log:", err)
+		}
+	}
+	c.JSON(http.StatusForbidden, gin.H{"error": "Access is not allowed from this network or at this time"})
+	c.Abort()
+	return nil, false
+}
+
+// authenticateAPIKey resolves an X-API-Key header and continues the chain
+// with the permissions its scopes grant, or aborts with 401.
+func authenticateAPIKey(c *gin.Context, store repositories.APIKeyStore, apiKey string) {
+	key, err := store.FindActive(c.Request.Context(), utils.HashToken(apiKey))
+	if err != nil {
+		if errors.Is(err, repositories.ErrInvalidAPIKey) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not verify API key"})
+		}
+		c.Abort()
+		return
+	}
+	if err := store.Touch(c.Request.Context(), key.ID); err != nil {
+		log.Println("Error recording API key usage:", err)
+	}
+
+	permissions := []string{}
+	for _, scope := range key.Scopes {
+		permissions = append(permissions, models.ScopePermissions[scope]...)
+	}
+
+	c.Set("api_key_id", key.ID)
+	c.Set("scopes", key.Scopes)
+	c.Set("permissions", permissions)
+	c.Set("auth_source", AuthSourceAPIKey)
+	c.Next()
+}
+
+// UsersOnly rejects API key requests on routes that act on the signed-in
+// user's own account.
+func UsersOnly() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		roleVal, exists := c.Get("role")
-		if !exists {
-			c.JSON(http.StatusForbidden, gin.H{"error": "Role not found"})
+		if c.GetString("auth_source") == AuthSourceAPIKey {
+			c.JSON(http.StatusForbidden, gin.H{"error": "API keys cannot be used here"})
 			c.Abort()
 			return
 		}
+		c.Next()
+	}
+}
 
-		userRole := roleVal.(string)
-		if userRole == role {
-			c.Next()
+// APIKeysOnly rejects user requests on routes meant for machine
+// integrations, which skip the checks that tie a user to their own patients.
+func APIKeysOnly() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetString("auth_source") != AuthSourceAPIKey {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Only API keys can be used here"})
+			c.Abort()
 			return
 		}
+		c.Next()
+	}
+}
 
+// PasswordNotExpired blocks users whose password has passed its maximum age
+// until they change it at PUT /api/me/password.
+func PasswordNotExpired() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetBool("password_expired") {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Password has expired and must be changed", "password_expired": true})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequirePermission allows the request only if the caller's roles, or the
+// scopes of its API key, grant permission.
+func RequirePermission(permission string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if slices.Contains(c.GetStringSlice("permissions"), permission) {
+			c.Next()
+			return
+		}
 		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
 		c.Abort()
 	}
 }
-
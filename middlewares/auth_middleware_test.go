@@ -0,0 +1,366 @@
+package middlewares_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/Somvaded/assessment/middlewares"
+	"github.com/Somvaded/assessment/models"
+	"github.com/Somvaded/assessment/repositories"
+	"github.com/Somvaded/assessment/utils"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func protectedRouter(opts middlewares.ProtectOptions) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/whoami", middlewares.Protect(opts), func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"user_id": c.GetInt("user_id"), "source": c.GetString("auth_source")})
+	})
+	return router
+}
+
+func TestProtect_AcceptsBearerHeader(t *testing.T) {
+	token, err := utils.GenerateJWT(5, "doctor")
+	assert.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodGet, "/whoami", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+	protectedRouter(middlewares.ProtectOptions{}).ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"user_id":5,"source":"header"}`, rec.Body.String())
+}
+
+func TestProtect_TokenSourcePrecedence(t *testing.T) {
+	cookieToken, _ := utils.GenerateJWT(1, "receptionist")
+	headerToken, _ := utils.GenerateJWT(2, "receptionist")
+
+	newRequest := func() *http.Request {
+		req := httptest.NewRequest(http.MethodGet, "/whoami", nil)
+		req.AddCookie(&http.Cookie{Name: "auth_token", Value: cookieToken})
+		req.Header.Set("Authorization", "Bearer "+headerToken)
+		return req
+	}
+
+	rec := httptest.NewRecorder()
+	protectedRouter(middlewares.ProtectOptions{}).ServeHTTP(rec, newRequest())
+	assert.JSONEq(t, `{"user_id":1,"source":"cookie"}`, rec.Body.String())
+
+	rec = httptest.NewRecorder()
+	protectedRouter(middlewares.ProtectOptions{
+		TokenSources: []string{middlewares.TokenSourceHeader, middlewares.TokenSourceCookie},
+	}).ServeHTTP(rec, newRequest())
+	assert.JSONEq(t, `{"user_id":2,"source":"header"}`, rec.Body.String())
+}
+
+func TestProtect_RejectsMFAToken(t *testing.T) {
+	token, err := utils.GenerateMFAToken(5, "doctor")
+	assert.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodGet, "/whoami", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+	protectedRouter(middlewares.ProtectOptions{}).ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+}
+
+type fakeSessionStore struct {
+	active  map[string]bool
+	touched []string
+}
+
+func (s *fakeSessionStore) Active(ctx context.Context, id string) (bool, error) {
+	return s.active[id], nil
+}
+
+func (s *fakeSessionStore) Touch(ctx context.Context, id string) error {
+	s.touched = append(s.touched, id)
+	return nil
+}
+
+func TestProtect_RejectsRevokedSession(t *testing.T) {
+	sessions := &fakeSessionStore{active: map[string]bool{"live": true, "revoked": false}}
+	router := protectedRouter(middlewares.ProtectOptions{Sessions: sessions})
+
+	call := func(token string) int {
+		req := httptest.NewRequest(http.MethodGet, "/whoami", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	live, _ := utils.GenerateSessionJWT(models.Claims{UserID: 5, Role: "doctor", SessionID: "live"})
+	revoked, _ := utils.GenerateSessionJWT(models.Claims{UserID: 5, Role: "doctor", SessionID: "revoked"})
+	legacy, _ := utils.GenerateJWT(5, "doctor")
+
+	assert.Equal(t, http.StatusOK, call(live))
+	assert.Equal(t, http.StatusUnauthorized, call(revoked))
+	assert.Equal(t, http.StatusOK, call(legacy), "Tokens without a sid claim are not bound to a session")
+	assert.Equal(t, []string{"live"}, sessions.touched)
+}
+
+type fakeUserStatusStore map[int]string
+
+func (s fakeUserStatusStore) Status(ctx context.Context, userID int) (string, error) {
+	if status, ok := s[userID]; ok {
+		return status, nil
+	}
+	return "", repositories.ErrStaffNotFound
+}
+
+func TestProtect_RejectsInactiveAccount(t *testing.T) {
+	users := fakeUserStatusStore{
+		5: models.StatusActive,
+		6: models.StatusSuspended,
+		7: models.StatusDeactivated,
+	}
+	router := protectedRouter(middlewares.ProtectOptions{Users: users})
+
+	call := func(userID int) int {
+		token, _ := utils.GenerateJWT(userID, "doctor")
+		req := httptest.NewRequest(http.MethodGet, "/whoami", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	assert.Equal(t, http.StatusOK, call(5))
+	assert.Equal(t, http.StatusUnauthorized, call(6))
+	assert.Equal(t, http.StatusUnauthorized, call(7))
+	assert.Equal(t, http.StatusUnauthorized, call(8), "Tokens of deleted users are rejected")
+}
+
+type fakeAccessOverrideStore map[int]bool
+
+func (s fakeAccessOverrideStore) Active(ctx context.Context, userID int) (bool, error) {
+	return s[userID], nil
+}
+
+type fakeAuditRecorder struct {
+	entries []models.AuditEntry
+}
+
+func (r *fakeAuditRecorder) Record(ctx context.Context, entry models.AuditEntry) error {
+	r.entries = append(r.entries, entry)
+	return nil
+}
+
+func TestProtect_EnforcesAccessPolicy(t *testing.T) {
+	// httptest requests come from 192.0.2.1.
+	policy, err := utils.ParseAccessPolicy([]byte(`{"receptionist": {"networks": ["10.0.0.0/8"]}}`), time.UTC)
+	assert.NoError(t, err)
+	audit := &fakeAuditRecorder{}
+	router := protectedRouter(middlewares.ProtectOptions{
+		AccessPolicy:    policy,
+		AccessOverrides: fakeAccessOverrideStore{7: true},
+		Audit:           audit,
+	})
+
+	call := func(userID int, role string, roles ...string) int {
+		token, _ := utils.GenerateJWT(userID, role, roles...)
+		req := httptest.NewRequest(http.MethodGet, "/whoami", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	assert.Equal(t, http.StatusForbidden, call(5, "receptionist"))
+	assert.Equal(t, http.StatusOK, call(6, "doctor"))
+	assert.Equal(t, http.StatusOK, call(6, "doctor", "doctor", "receptionist"), "Only the restricted role is dropped")
+	assert.Equal(t, http.StatusOK, call(7, "receptionist"), "Overrides exempt the user")
+	if assert.Len(t, audit.entries, 1) {
+		assert.Equal(t, "access_policy.deny", audit.entries[0].Action)
+		assert.Equal(t, 5, *audit.entries[0].UserID)
+	}
+}
+
+func TestProtect_AccessPolicyIgnoresSpoofedForwardedFor(t *testing.T) {
+	policy, err := utils.ParseAccessPolicy([]byte(`{"receptionist": {"networks": ["10.0.0.0/8"]}}`), time.UTC)
+	assert.NoError(t, err)
+	audit := &fakeAuditRecorder{}
+	router := protectedRouter(middlewares.ProtectOptions{AccessPolicy: policy, Audit: audit})
+	assert.NoError(t, middlewares.TrustProxies(router, nil))
+
+	token, _ := utils.GenerateJWT(5, "receptionist")
+	req := httptest.NewRequest(http.MethodGet, "/whoami", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("X-Forwarded-For", "10.1.2.3")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusForbidden, rec.Code, "The header must not place the caller inside the network")
+	if assert.Len(t, audit.entries, 1) {
+		assert.Equal(t, "192.0.2.1", audit.entries[0].IP)
+	}
+}
+
+type fakeAPIKeyStore struct {
+	keys    map[string]*models.APIKey
+	touched []int
+}
+
+func (s *fakeAPIKeyStore) FindActive(ctx context.Context, keyHash string) (*models.APIKey, error) {
+	if key, ok := s.keys[keyHash]; ok {
+		return key, nil
+	}
+	return nil, repositories.ErrInvalidAPIKey
+}
+
+func (s *fakeAPIKeyStore) Touch(ctx context.Context, id int) error {
+	s.touched = append(s.touched, id)
+	return nil
+}
+
+func TestRequirePermission_APIKeyScopes(t *testing.T) {
+	store := &fakeAPIKeyStore{keys: map[string]*models.APIKey{
+		utils.HashToken("pms_reader"): {ID: 1, Scopes: []string{models.ScopePatientsRead}},
+	}}
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	group := router.Group("/api", middlewares.Protect(middlewares.ProtectOptions{APIKeys: store}))
+	group.GET("/receptionist/:aadharid", middlewares.RequirePermission(models.PermPatientRead), func(c *gin.Context) { c.Status(http.StatusOK) })
+	group.POST("/receptionist/", middlewares.RequirePermission(models.PermPatientCreate), func(c *gin.Context) { c.Status(http.StatusCreated) })
+	group.GET("/admin/staff", middlewares.RequirePermission(models.PermStaffManage), func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	send := func(method string, path string, key string) int {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("X-API-Key", key)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	assert.Equal(t, http.StatusOK, send(http.MethodGet, "/api/receptionist/1234", "pms_reader"))
+	assert.Equal(t, http.StatusForbidden, send(http.MethodPost, "/api/receptionist/", "pms_reader"), "Read scope must not allow writes")
+	assert.Equal(t, http.StatusForbidden, send(http.MethodGet, "/api/admin/staff", "pms_reader"), "API keys never act as admin")
+	assert.Equal(t, http.StatusUnauthorized, send(http.MethodGet, "/api/receptionist/1234", "pms_unknown"))
+	assert.Equal(t, []int{1, 1, 1}, store.touched, "Only valid keys are touched")
+}
+
+func TestAPIKeysOnly(t *testing.T) {
+	store := &fakeAPIKeyStore{keys: map[string]*models.APIKey{
+		utils.HashToken("pms_lab"): {ID: 2, Scopes: []string{models.ScopeMedicalWrite}},
+	}}
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.PUT("/api/integrations/patients/:patientid/medical",
+		middlewares.Protect(middlewares.ProtectOptions{APIKeys: store}),
+		middlewares.APIKeysOnly(),
+		middlewares.RequirePermission(models.PermMedicalUpdate),
+		func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	send := func(header string, value string) int {
+		req := httptest.NewRequest(http.MethodPut, "/api/integrations/patients/1/medical", nil)
+		req.Header.Set(header, value)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	token, _ := utils.GenerateJWT(3, "doctor")
+
+	assert.Equal(t, http.StatusOK, send("X-API-Key", "pms_lab"))
+	assert.Equal(t, http.StatusForbidden, send("Authorization", "Bearer "+token), "Users must go through the doctor routes")
+}
+
+func TestRequirePermission_UnionOfRoles(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+	mock.ExpectQuery("SELECT role, permission FROM role_permissions").
+		WillReturnRows(sqlmock.NewRows([]string{"role", "permission"}).
+			AddRow("doctor", models.PermMedicalUpdate).
+			AddRow("receptionist", models.PermPatientCreate).
+			AddRow("admin", models.PermStaffManage))
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	group := router.Group("/api", middlewares.Protect(middlewares.ProtectOptions{
+		Permissions: repositories.NewPermissionResolver(db, time.Minute),
+	}))
+	group.PATCH("/doctor/:patientid", middlewares.RequirePermission(models.PermMedicalUpdate), func(c *gin.Context) { c.Status(http.StatusOK) })
+	group.POST("/receptionist/", middlewares.RequirePermission(models.PermPatientCreate), func(c *gin.Context) { c.Status(http.StatusOK) })
+	group.GET("/admin/staff", middlewares.RequirePermission(models.PermStaffManage), func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	token, err := utils.GenerateJWT(5, "doctor", "doctor", "receptionist")
+	assert.NoError(t, err)
+	send := func(method string, path string) int {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	assert.Equal(t, http.StatusOK, send(http.MethodPatch, "/api/doctor/1"))
+	assert.Equal(t, http.StatusOK, send(http.MethodPost, "/api/receptionist/"), "A doctor covering the front desk holds both roles")
+	assert.Equal(t, http.StatusForbidden, send(http.MethodGet, "/api/admin/staff"))
+	assert.NoError(t, mock.ExpectationsWereMet(), "Role permissions are loaded once and cached")
+}
+
+func TestRequireCSRF_CookieAuthOnly(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/patients", middlewares.Protect(middlewares.ProtectOptions{}), middlewares.RequireCSRF(), func(c *gin.Context) {
+		c.Status(http.StatusNoContent)
+	})
+	token, _ := utils.GenerateJWT(1, "receptionist")
+
+	call := func(withCookie bool, csrfHeader string) int {
+		req := httptest.NewRequest(http.MethodPost, "/patients", nil)
+		if withCookie {
+			req.AddCookie(&http.Cookie{Name: "auth_token", Value: token})
+			req.AddCookie(&http.Cookie{Name: middlewares.CSRFCookie, Value: "csrf-value"})
+		} else {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		if csrfHeader != "" {
+			req.Header.Set(middlewares.CSRFHeader, csrfHeader)
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	assert.Equal(t, http.StatusForbidden, call(true, ""), "Cookie requests need the header")
+	assert.Equal(t, http.StatusForbidden, call(true, "guessed"))
+	assert.Equal(t, http.StatusNoContent, call(true, "csrf-value"))
+	assert.Equal(t, http.StatusNoContent, call(false, ""), "Bearer clients are exempt")
+}
+
+func TestRequireCSRFForCookies(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/refresh", middlewares.RequireCSRFForCookies("auth_token", "refresh_token"), func(c *gin.Context) {
+		c.Status(http.StatusNoContent)
+	})
+
+	call := func(withCookie bool, csrfHeader string) int {
+		req := httptest.NewRequest(http.MethodPost, "/refresh", nil)
+		if withCookie {
+			req.AddCookie(&http.Cookie{Name: "refresh_token", Value: "refresh-value"})
+			req.AddCookie(&http.Cookie{Name: middlewares.CSRFCookie, Value: "csrf-value"})
+		}
+		if csrfHeader != "" {
+			req.Header.Set(middlewares.CSRFHeader, csrfHeader)
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	assert.Equal(t, http.StatusForbidden, call(true, ""), "Cookie requests need the header")
+	assert.Equal(t, http.StatusForbidden, call(true, "guessed"))
+	assert.Equal(t, http.StatusNoContent, call(true, "csrf-value"))
+	assert.Equal(t, http.StatusNoContent, call(false, ""), "Body clients are exempt")
+}
@@ -0,0 +1,15 @@
+package middlewares
+
+import "github.com/gin-gonic/gin"
+
+// TrustProxies makes router believe X-Forwarded-For only when the request
+// comes from one of proxies. With no proxies the client IP is always the
+// connection's peer address; gin would otherwise trust the header from
+// anyone, letting callers pick the IP that login throttling, IP lockouts
+// and the access policy see.
+func TrustProxies(router *gin.Engine, proxies []string) error {
+	if len(proxies) == 0 {
+		return router.SetTrustedProxies(nil)
+	}
+	return router.SetTrustedProxies(proxies)
+}
@@ -0,0 +1,32 @@
+package middlewares_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Somvaded/assessment/middlewares"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTrustProxies(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	clientIP := func(proxies []string) string {
+		router := gin.New()
+		assert.NoError(t, middlewares.TrustProxies(router, proxies))
+		router.GET("/ip", func(c *gin.Context) {
+			c.String(http.StatusOK, c.ClientIP())
+		})
+		// httptest requests come from 192.0.2.1.
+		req := httptest.NewRequest(http.MethodGet, "/ip", nil)
+		req.Header.Set("X-Forwarded-For", "10.1.2.3")
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec.Body.String()
+	}
+
+	assert.Equal(t, "192.0.2.1", clientIP(nil), "No proxy is trusted by default")
+	assert.Equal(t, "192.0.2.1", clientIP([]string{"203.0.113.0/24"}))
+	assert.Equal(t, "10.1.2.3", clientIP([]string{"192.0.2.0/24"}))
+}
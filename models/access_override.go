@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// AccessOverride exempts UserID from the role access policy until
+// ExpiresAt.
+type AccessOverride struct {
+	ID        int        `json:"id"`
+	UserID    int        `json:"user_id"`
+	Reason    string     `json:"reason"`
+	CreatedBy int        `json:"created_by"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
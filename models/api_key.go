@@ -0,0 +1,28 @@
+package models
+
+import "time"
+
+// API key scopes. The patients scopes grant the access a receptionist has
+// to patient records; the medical scopes grant reading and pushing medical
+// information through the integration routes, which only API keys reach.
+const (
+	ScopePatientsRead  = "patients:read"
+	ScopePatientsWrite = "patients:write"
+	ScopeMedicalRead   = "medical:read"
+	ScopeMedicalWrite  = "medical:write"
+)
+
+var APIKeyScopes = []string{ScopePatientsRead, ScopePatientsWrite, ScopeMedicalRead, ScopeMedicalWrite}
+
+type APIKey struct {
+	ID         int        `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	KeyHash    string     `json:"-"`
+	Scopes     []string   `json:"scopes"`
+	CreatedBy  int        `json:"created_by"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
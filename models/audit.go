@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+const (
+	AuditOutcomeAllowed = "allowed"
+	AuditOutcomeDenied  = "denied"
+
+	AuditSeverityInfo    = "info"
+	AuditSeverityWarning = "warning"
+	AuditSeverityHigh    = "high"
+)
+
+type AuditEntry struct {
+	ID           int64          `json:"id"`
+	UserID       *int           `json:"user_id,omitempty"`
+	APIKeyID     *int           `json:"api_key_id,omitempty"`
+	Action       string         `json:"action"`
+	ResourceType string         `json:"resource_type"`
+	ResourceID   string         `json:"resource_id"`
+	Outcome      string         `json:"outcome"`
+	Severity     string         `json:"severity"`
+	Details      map[string]any `json:"details,omitempty"`
+	IP           string         `json:"ip"`
+	CreatedAt    time.Time      `json:"created_at"`
+}
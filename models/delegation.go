@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// Access levels of a PatientDelegation. Write also allows reading.
+const (
+	DelegationRead  = "read"
+	DelegationWrite = "write"
+)
+
+// PatientDelegation lets ToDoctorID consult on a patient assigned to
+// FromDoctorID until ExpiresAt.
+type PatientDelegation struct {
+	ID           int        `json:"id"`
+	PatientID    int        `json:"patient_id"`
+	FromDoctorID int        `json:"from_doctor_id"`
+	ToDoctorID   int        `json:"to_doctor_id"`
+	Access       string     `json:"access"`
+	CreatedAt    time.Time  `json:"created_at"`
+	ExpiresAt    time.Time  `json:"expires_at"`
+	RevokedAt    *time.Time `json:"revoked_at,omitempty"`
+}
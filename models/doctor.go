@@ -28,6 +28,11 @@ type DocPatientResponse struct {
 	Consent           bool      `json:"consent"`
 	CreatedAt         time.Time `json:"created_at,omitempty"`
 	UpdatedAt         time.Time `json:"updated_at,omitempty"`
+	// Delegated marks a patient shared by another doctor for a consult;
+	// DelegationAccess and DelegationExpiresAt describe that grant.
+	Delegated           bool       `json:"delegated"`
+	DelegationAccess    string     `json:"delegation_access,omitempty"`
+	DelegationExpiresAt *time.Time `json:"delegation_expires_at,omitempty"`
 }
 
 
@@ -36,4 +41,21 @@ type DocPatientUpdate struct {
 	Medications       string    `json:"medications"`
 	OtherHealthIssues string    `json:"other_health_issues"`
 	KnownAllergies 	  string    `json:"known_allergies"`
-}
\ No newline at end of file
+}
+// DocPatientQuery pages through a doctor's patients, most recently updated
+// first. Since limits the result to patients updated after it, so clients
+// can poll for changes.
+type DocPatientQuery struct {
+	Name   string
+	Since  *time.Time
+	Limit  int
+	Cursor string
+}
+
+// DocPatientPage is one page of a DocPatientQuery; NextCursor is empty on
+// the last page.
+type DocPatientPage struct {
+	Patients   []DocPatientResponse `json:"patients"`
+	Limit      int                  `json:"limit"`
+	NextCursor string               `json:"next_cursor,omitempty"`
+}
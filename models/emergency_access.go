@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+type EmergencyAccessGrant struct {
+	ID            int       `json:"id"`
+	DoctorID      int       `json:"doctor_id"`
+	PatientID     int       `json:"patient_id"`
+	Justification string    `json:"justification"`
+	GrantedAt     time.Time `json:"granted_at"`
+	ExpiresAt     time.Time `json:"expires_at"`
+}
@@ -2,8 +2,22 @@ package models
 
 import "github.com/golang-jwt/jwt/v5"
 
+// PurposeMFA marks the short-lived token handed out between the password
+// and TOTP steps of a login. Access tokens carry no purpose.
+const PurposeMFA = "mfa"
+
+// Claims is the payload of an access token. The embedded RegisteredClaims.ID
+// is serialised as the jti claim and identifies the token for revocation.
+// Role is the primary role from users.role; Roles lists every role the user
+// held when the token was issued. SessionID binds the token to the session
+// it was issued for. PasswordExpired marks a user who must change their
+// password before doing anything else.
 type Claims struct {
-	UserID int    `json:"user_id"`
-	Role   string `json:"role"`
+	UserID          int      `json:"user_id"`
+	Role            string   `json:"role"`
+	Roles           []string `json:"roles,omitempty"`
+	Purpose         string   `json:"purpose,omitempty"`
+	SessionID       string   `json:"sid,omitempty"`
+	PasswordExpired bool     `json:"pwd_exp,omitempty"`
 	jwt.RegisteredClaims
-}
\ No newline at end of file
+}
@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// LoginAttempt tracks consecutive failed logins for a throttling key such as
+// "email:doc@example.com" or "ip:203.0.113.7".
+type LoginAttempt struct {
+	Key           string    `json:"key"`
+	Failures      int       `json:"failures"`
+	LastFailureAt time.Time `json:"last_failure_at"`
+	BlockedUntil  time.Time `json:"blocked_until"`
+}
@@ -0,0 +1,54 @@
+package models
+
+import "time"
+
+const (
+	PatientRevisionBaseline = "baseline"
+	PatientRevisionCreate   = "create"
+	PatientRevisionUpdate   = "update"
+	PatientRevisionDelete   = "delete"
+	PatientRevisionRestore  = "restore"
+	// PatientRevisionPurge is the last revision of a patient removed by the
+	// purge job. It has no author.
+	PatientRevisionPurge = "purge"
+)
+
+// PatientActor is who changed a patient record: a signed-in user or an API
+// key, whichever applies.
+type PatientActor struct {
+	UserID   *int
+	APIKeyID *int
+}
+
+// PatientRevision is one entry of a patient's history. Snapshot holds the
+// record as it was after the change, ChangedFields the keys that differ
+// from the previous revision.
+type PatientRevision struct {
+	PatientID     int            `json:"patient_id"`
+	Revision      int            `json:"revision"`
+	Action        string         `json:"action"`
+	Snapshot      map[string]any `json:"snapshot"`
+	ChangedFields []string       `json:"changed_fields"`
+	ChangedBy     *int           `json:"changed_by,omitempty"`
+	APIKeyID      *int           `json:"api_key_id,omitempty"`
+	CreatedAt     time.Time      `json:"created_at"`
+}
+
+type PatientFieldChange struct {
+	Field string `json:"field"`
+	From  any    `json:"from"`
+	To    any    `json:"to"`
+}
+
+// PatientRevisionDiff lists the fields a revision changed. PreviousRevision
+// is zero, and every From nil, for the first revision of a patient.
+type PatientRevisionDiff struct {
+	PatientID        int                  `json:"patient_id"`
+	Revision         int                  `json:"revision"`
+	PreviousRevision int                  `json:"previous_revision"`
+	Action           string               `json:"action"`
+	ChangedBy        *int                 `json:"changed_by,omitempty"`
+	APIKeyID         *int                 `json:"api_key_id,omitempty"`
+	CreatedAt        time.Time            `json:"created_at"`
+	Changes          []PatientFieldChange `json:"changes"`
+}
@@ -0,0 +1,34 @@
+package models
+
+import "time"
+
+// PatientSearch filters, sorts and pages the receptionist patient list.
+// Zero values leave a filter unset.
+type PatientSearch struct {
+	// Name matches any part of the name, ignoring case; Phone any part of
+	// the phone number.
+	Name        string
+	Phone       string
+	DoctorID    *int
+	Gender      string
+	MinAge      *int
+	MaxAge      *int
+	CreatedFrom *time.Time
+	CreatedTo   *time.Time
+	// Sort is "name", "age", "created_at" (default) or "updated_at"; Order
+	// is "asc" or "desc" (default).
+	Sort  string
+	Order string
+	Limit int
+	// Cursor is the NextCursor of the previous page.
+	Cursor string
+}
+
+// PatientPage is one page of a PatientSearch. Total counts every match,
+// not just this page; NextCursor is empty on the last page.
+type PatientPage struct {
+	Patients   []Patient `json:"patients"`
+	Total      int       `json:"total"`
+	Limit      int       `json:"limit"`
+	NextCursor string    `json:"next_cursor,omitempty"`
+}
@@ -0,0 +1,40 @@
+package models
+
+// Permissions checked by RequirePermission. Roles are mapped to
+// permissions in the role_permissions table.
+const (
+	PermPatientCreate = "patient:create"
+	PermPatientRead   = "patient:read"
+	PermPatientUpdate = "patient:update"
+	PermPatientDelete = "patient:delete"
+	PermMedicalRead   = "medical:read"
+	PermMedicalUpdate = "medical:update"
+	PermMFAManage     = "mfa:manage"
+	PermStaffManage   = "staff:manage"
+	PermAPIKeyManage  = "apikey:manage"
+	PermRoleManage    = "role:manage"
+	PermLockoutManage = "lockout:manage"
+	PermEmergency     = "emergency:access"
+	PermAuditRead     = "audit:read"
+	PermDelegate      = "delegation:manage"
+	PermAccessPolicy  = "access_policy:override"
+)
+
+// ScopePermissions is what each API key scope grants.
+var ScopePermissions = map[string][]string{
+	ScopePatientsRead:  {PermPatientRead},
+	ScopePatientsWrite: {PermPatientCreate, PermPatientUpdate, PermPatientDelete},
+	ScopeMedicalRead:   {PermMedicalRead},
+	ScopeMedicalWrite:  {PermMedicalUpdate},
+}
+
+type Role struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Permissions []string `json:"permissions"`
+}
+
+type Permission struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
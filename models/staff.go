@@ -0,0 +1,13 @@
+package models
+
+// StaffAccount is a users row together with the role specific profile that
+// is joined to it by email. Exactly one of Doctor or Receptionist is set for
+// clinical staff; both are nil for admins.
+type StaffAccount struct {
+	ID           int           `json:"id"`
+	Email        string        `json:"email"`
+	Role         string        `json:"role"`
+	Status       string        `json:"status"`
+	Doctor       *Doctor       `json:"doctor,omitempty"`
+	Receptionist *Receptionist `json:"receptionist,omitempty"`
+}
@@ -1,8 +1,25 @@
 package models
 
+// Account statuses. Only active accounts can sign in; suspended accounts are
+// expected to be reactivated, deactivated ones belong to staff who left.
+const (
+	StatusActive      = "active"
+	StatusSuspended   = "suspended"
+	StatusDeactivated = "deactivated"
+)
+
+// PatientReassignment says what happens to the patients of a doctor being
+// deactivated: they move to ReassignTo, or with UnassignPatients set they
+// are left without a doctor until a receptionist assigns one.
+type PatientReassignment struct {
+	ReassignTo       *int `json:"reassign_to" form:"reassign_to"`
+	UnassignPatients bool `json:"unassign_patients" form:"unassign_patients"`
+}
+
 type User struct {
 	ID           int    `json:"id"`
 	Email        string `json:"email"`
 	Role         string `json:"role"`
-	PasswordHash string `json:"password_hash"`
-}
\ No newline at end of file
+	Status       string `json:"status"`
+	PasswordHash string `json:"-"`
+}
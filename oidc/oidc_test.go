@@ -0,0 +1,155 @@
+package oidc_test
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/Somvaded/assessment/oidc"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+// stubIdP is a minimal OpenID provider that issues one authorization code
+// and remembers the PKCE challenge and nonce it was requested with.
+type stubIdP struct {
+	server    *httptest.Server
+	key       *rsa.PrivateKey
+	challenge string
+	nonce     string
+	audience  string
+	subject   string
+}
+
+func newStubIdP(t *testing.T) *stubIdP {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	idp := &stubIdP{key: key, audience: "client-1", subject: "sub-123"}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 idp.server.URL,
+			"authorization_endpoint": idp.server.URL + "/authorize",
+			"token_endpoint":         idp.server.URL + "/token",
+			"jwks_uri":               idp.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "idp-key",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		id, secret, _ := r.BasicAuth()
+		if id != "client-1" || secret != "s3cret" || r.FormValue("code") != "the-code" ||
+			oidc.S256Challenge(r.FormValue("code_verifier")) != idp.challenge {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+			"iss":            idp.server.URL,
+			"sub":            idp.subject,
+			"aud":            idp.audience,
+			"exp":            time.Now().Add(time.Minute).Unix(),
+			"iat":            time.Now().Unix(),
+			"nonce":          idp.nonce,
+			"email":          "doc@example.com",
+			"email_verified": true,
+		})
+		token.Header["kid"] = "idp-key"
+		signed, _ := token.SignedString(key)
+		json.NewEncoder(w).Encode(map[string]string{"id_token": signed, "token_type": "Bearer"})
+	})
+	idp.server = httptest.NewServer(mux)
+	t.Cleanup(idp.server.Close)
+	return idp
+}
+
+func (idp *stubIdP) provider() *oidc.Provider {
+	return oidc.NewProvider(oidc.Config{
+		Issuer:       idp.server.URL,
+		ClientID:     "client-1",
+		ClientSecret: "s3cret",
+		RedirectURL:  "http://localhost:8080/api/auth/oidc/callback",
+	})
+}
+
+// authorize plays the browser's visit to the authorization endpoint.
+func (idp *stubIdP) authorize(t *testing.T, p *oidc.Provider, verifier string) {
+	target, err := p.AuthCodeURL(context.Background(), "state-1", "nonce-1", verifier)
+	assert.NoError(t, err)
+	parsed, err := url.Parse(target)
+	assert.NoError(t, err)
+
+	query := parsed.Query()
+	assert.Equal(t, "/authorize", parsed.Path)
+	assert.Equal(t, "code", query.Get("response_type"))
+	assert.Equal(t, "S256", query.Get("code_challenge_method"))
+	assert.Equal(t, "state-1", query.Get("state"))
+	idp.challenge = query.Get("code_challenge")
+	idp.nonce = query.Get("nonce")
+}
+
+func TestExchange_Success(t *testing.T) {
+	idp := newStubIdP(t)
+	p := idp.provider()
+	verifier, err := oidc.NewVerifier()
+	assert.NoError(t, err)
+	idp.authorize(t, p, verifier)
+
+	claims, err := p.Exchange(context.Background(), "the-code", verifier, "nonce-1")
+	assert.NoError(t, err)
+	assert.Equal(t, "sub-123", claims.Subject)
+	assert.Equal(t, "doc@example.com", claims.Email)
+	assert.True(t, claims.EmailVerified)
+}
+
+func TestExchange_WrongVerifier(t *testing.T) {
+	idp := newStubIdP(t)
+	p := idp.provider()
+	idp.authorize(t, p, "verifier-one-that-is-long-enough-for-pkce")
+
+	_, err := p.Exchange(context.Background(), "the-code", "another-verifier-that-is-long-enough", "nonce-1")
+	assert.Error(t, err)
+}
+
+func TestExchange_NonceMismatch(t *testing.T) {
+	idp := newStubIdP(t)
+	p := idp.provider()
+	verifier, _ := oidc.NewVerifier()
+	idp.authorize(t, p, verifier)
+
+	_, err := p.Exchange(context.Background(), "the-code", verifier, "nonce-2")
+	assert.ErrorIs(t, err, oidc.ErrInvalidIDToken)
+}
+
+func TestExchange_WrongAudience(t *testing.T) {
+	idp := newStubIdP(t)
+	idp.audience = "another-client"
+	p := idp.provider()
+	verifier, _ := oidc.NewVerifier()
+	idp.authorize(t, p, verifier)
+
+	_, err := p.Exchange(context.Background(), "the-code", verifier, "nonce-1")
+	assert.ErrorIs(t, err, oidc.ErrInvalidIDToken)
+}
+
+func TestS256Challenge(t *testing.T) {
+	// BASE64URL(SHA256(verifier)) without padding.
+	assert.Equal(t, "bgE3A81g4PQnx3xYf3DYix_m5YamOr0klA7LEhJXidA",
+		oidc.S256Challenge("dBjftJeZ4CVP-mB92K9uhvgEwD0eoC7wGtmDBqQ2Wu8"))
+}
@@ -0,0 +1,153 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/Somvaded/assessment/models"
+)
+
+var ErrAccessOverrideNotFound = errors.New("access override not found")
+
+// CreateAccessOverride exempts a staff account from the access policy and
+// audits the exemption in the same transaction.
+func CreateAccessOverride(ctx context.Context, db *sql.DB, override models.AccessOverride, ip string) (*models.AccessOverride, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, `
+	INSERT INTO access_policy_overrides (user_id, reason, created_by, expires_at)
+	VALUES ($1, $2, $3, $4)
+	RETURNING id, created_at;
+	`, override.UserID, override.Reason, override.CreatedBy, override.ExpiresAt).Scan(&override.ID, &override.CreatedAt)
+	if err != nil {
+		if isForeignKeyViolation(err) {
+			return nil, ErrStaffNotFound
+		}
+		return nil, fmt.Errorf("error creating access override: %w", err)
+	}
+
+	err = InsertAuditLog(ctx, tx, models.AuditEntry{
+		UserID:       &override.CreatedBy,
+		Action:       "access_policy.override",
+		ResourceType: "user",
+		ResourceID:   strconv.Itoa(override.UserID),
+		Outcome:      models.AuditOutcomeAllowed,
+		Severity:     models.AuditSeverityWarning,
+		Details: map[string]any{
+			"override_id": override.ID,
+			"reason":      override.Reason,
+			"expires_at":  override.ExpiresAt,
+		},
+		IP: ip,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("error committing transaction: %w", err)
+	}
+	return &override, nil
+}
+
+// ListAccessOverrides returns overrides newest first. activeOnly limits the
+// result to overrides that are neither revoked nor expired.
+func ListAccessOverrides(ctx context.Context, db *sql.DB, activeOnly bool) ([]models.AccessOverride, error) {
+	query := `
+	SELECT id, user_id, reason, created_by, created_at, expires_at, revoked_at
+	FROM access_policy_overrides
+	WHERE ($1 = FALSE OR (revoked_at IS NULL AND expires_at > NOW()))
+	ORDER BY created_at DESC;
+	`
+	rows, err := db.QueryContext(ctx, query, activeOnly)
+	if err != nil {
+		return nil, fmt.Errorf("error querying access overrides: %w", err)
+	}
+	defer rows.Close()
+
+	overrides := []models.AccessOverride{}
+	for rows.Next() {
+		var (
+			override  models.AccessOverride
+			revokedAt sql.NullTime
+		)
+		err := rows.Scan(
+			&override.ID,
+			&override.UserID,
+			&override.Reason,
+			&override.CreatedBy,
+			&override.CreatedAt,
+			&override.ExpiresAt,
+			&revokedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning access override: %w", err)
+		}
+		if revokedAt.Valid {
+			override.RevokedAt = &revokedAt.Time
+		}
+		overrides = append(overrides, override)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+	return overrides, nil
+}
+
+// RevokeAccessOverride ends an override before it expires.
+func RevokeAccessOverride(ctx context.Context, db *sql.DB, overrideID int) error {
+	result, err := db.ExecContext(ctx, `
+	UPDATE access_policy_overrides SET revoked_at = NOW()
+	WHERE id = $1 AND revoked_at IS NULL;
+	`, overrideID)
+	if err != nil {
+		return fmt.Errorf("error revoking access override: %w", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error getting rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return ErrAccessOverrideNotFound
+	}
+	return nil
+}
+
+// AccessOverrideStore is what Protect needs to let exempted users through
+// the access policy.
+type AccessOverrideStore interface {
+	// Active reports whether the user holds an unrevoked, unexpired
+	// override.
+	Active(ctx context.Context, userID int) (bool, error)
+}
+
+type PostgresAccessOverrideStore struct {
+	DB *sql.DB
+}
+
+func NewPostgresAccessOverrideStore(db *sql.DB) *PostgresAccessOverrideStore {
+	return &PostgresAccessOverrideStore{
+		DB: db,
+	}
+}
+
+func (s *PostgresAccessOverrideStore) Active(ctx context.Context, userID int) (bool, error) {
+	var active bool
+	err := s.DB.QueryRowContext(ctx, `
+	SELECT EXISTS (
+		SELECT 1 FROM access_policy_overrides
+		WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > NOW()
+	);
+	`, userID).Scan(&active)
+	if err != nil {
+		return false, fmt.Errorf("error checking access override: %w", err)
+	}
+	return active, nil
+}
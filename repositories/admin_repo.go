@@ -0,0 +1,424 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/Somvaded/assessment/models"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+var (
+	ErrEmailTaken    = errors.New("a user with this email already exists")
+	ErrStaffNotFound = errors.New("no staff account found")
+	// ErrReassignmentRequired is returned when deactivating a doctor who
+	// still has patients without saying where those patients go.
+	ErrReassignmentRequired  = errors.New("doctor has assigned patients: choose reassign_to or unassign_patients")
+	ErrReassignTargetInvalid = errors.New("reassign_to must be another active doctor")
+)
+
+// isUniqueViolation reports whether err is a Postgres unique_violation.
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505"
+}
+
+// isForeignKeyViolation reports whether err is a Postgres
+// foreign_key_violation.
+func isForeignKeyViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23503"
+}
+
+const staffSelect = `
+	SELECT
+	u.id, u.email, u.role, u.status,
+		d.name, d.specialty, d.emergency_contact, d.license_number, d.experience_years, d.created_at, d.updated_at,
+		r.name, r.phone, r.created_at, r.updated_at
+	FROM users u
+	LEFT JOIN doctors d ON u.email = d.email
+	LEFT JOIN receptionists r ON u.email = r.email
+	`
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanStaff(row rowScanner) (*models.StaffAccount, error) {
+	var (
+		account                  models.StaffAccount
+		nullDoctorName           sql.NullString
+		nullSpecialty            sql.NullString
+		nullEmergencyContactInfo sql.NullString
+		nullLicense              sql.NullString
+		nullExperience           sql.NullInt32
+		nullDCreatedAt           sql.NullTime
+		nullDUpdatedAt           sql.NullTime
+		nullReceptionistName     sql.NullString
+		nullReceptionistPhone    sql.NullString
+		nullRCreatedAt           sql.NullTime
+		nullRUpdatedAt           sql.NullTime
+	)
+
+	err := row.Scan(
+		&account.ID,
+		&account.Email,
+		&account.Role,
+		&account.Status,
+
+		&nullDoctorName,
+		&nullSpecialty,
+		&nullEmergencyContactInfo,
+		&nullLicense,
+		&nullExperience,
+		&nullDCreatedAt,
+		&nullDUpdatedAt,
+
+		&nullReceptionistName,
+		&nullReceptionistPhone,
+		&nullRCreatedAt,
+		&nullRUpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if account.Role == "doctor" {
+		account.Doctor = &models.Doctor{
+			ID:               account.ID,
+			Name:             nullDoctorName.String,
+			Email:            account.Email,
+			Specialty:        nullSpecialty.String,
+			EmergencyContact: nullEmergencyContactInfo.String,
+			LicenseNumber:    nullLicense.String,
+			ExperienceYears:  int(nullExperience.Int32),
+			CreatedAt:        nullDCreatedAt.Time,
+			UpdatedAt:        nullDUpdatedAt.Time,
+		}
+	}
+	if account.Role == "receptionist" {
+		account.Receptionist = &models.Receptionist{
+			ID:        account.ID,
+			Name:      nullReceptionistName.String,
+			Email:     account.Email,
+			Phone:     nullReceptionistPhone.String,
+			CreatedAt: nullRCreatedAt.Time,
+			UpdatedAt: nullRUpdatedAt.Time,
+		}
+	}
+	return &account, nil
+}
+
+// CreateStaff inserts the users row and the matching doctors or
+// receptionists row in a single transaction. The profile row reuses the
+// user's id so that patients.doctor_id and the JWT user_id agree.
+func CreateStaff(ctx context.Context, db *sql.DB, user models.User, doctor *models.Doctor, receptionist *models.Receptionist) (*models.StaffAccount, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var id int
+	err = tx.QueryRowContext(ctx, `
+	INSERT INTO users (email, role, password_hash, status)
+	VALUES ($1, $2, $3, $4)
+	RETURNING id;
+	`, user.Email, user.Role, user.PasswordHash, models.StatusActive).Scan(&id)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return nil, ErrEmailTaken
+		}
+		return nil, fmt.Errorf("error creating user: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, `INSERT INTO user_roles (user_id, role) VALUES ($1, $2);`, id, user.Role); err != nil {
+		return nil, fmt.Errorf("error assigning role: %w", err)
+	}
+
+	if doctor != nil {
+		_, err = tx.ExecContext(ctx, `
+		INSERT INTO doctors (id, name, email, specialty, emergency_contact, license_number, experience_years)
+		VALUES ($1, $2, $3, $4, $5, $6, $7);
+		`, id, doctor.Name, user.Email, doctor.Specialty, doctor.EmergencyContact, doctor.LicenseNumber, doctor.ExperienceYears)
+		if err != nil {
+			return nil, fmt.Errorf("error creating doctor profile: %w", err)
+		}
+	}
+	if receptionist != nil {
+		_, err = tx.ExecContext(ctx, `
+		INSERT INTO receptionists (id, name, email, phone)
+		VALUES ($1, $2, $3, $4);
+		`, id, receptionist.Name, user.Email, receptionist.Phone)
+		if err != nil {
+			return nil, fmt.Errorf("error creating receptionist profile: %w", err)
+		}
+	}
+
+	account, err := scanStaff(tx.QueryRowContext(ctx, staffSelect+`WHERE u.id = $1;`, id))
+	if err != nil {
+		return nil, fmt.Errorf("error fetching created staff: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("error committing transaction: %w", err)
+	}
+	return account, nil
+}
+
+func ListStaff(ctx context.Context, db *sql.DB, role string, status string) ([]models.StaffAccount, error) {
+	query := staffSelect + `
+	WHERE u.role <> 'admin'
+	AND ($1 = '' OR u.role = $1)
+	AND ($2 = '' OR u.status = $2)
+	ORDER BY u.id;
+	`
+	rows, err := db.QueryContext(ctx, query, role, status)
+	if err != nil {
+		return nil, fmt.Errorf("error querying staff: %w", err)
+	}
+	defer rows.Close()
+
+	accounts := []models.StaffAccount{}
+	for rows.Next() {
+		account, err := scanStaff(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning staff: %w", err)
+		}
+		accounts = append(accounts, *account)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+	return accounts, nil
+}
+
+func FindStaffByID(ctx context.Context, db *sql.DB, userID int) (*models.StaffAccount, error) {
+	account, err := scanStaff(db.QueryRowContext(ctx, staffSelect+`WHERE u.id = $1;`, userID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrStaffNotFound
+		}
+		return nil, fmt.Errorf("error fetching staff: %w", err)
+	}
+	return account, nil
+}
+
+// UpdateStaff overwrites the account's email and profile fields. Because the
+// profile tables are joined to users by email, the email is changed on both
+// rows in the same transaction. An empty passwordHash keeps the current one;
+// a new one signs the user out everywhere, as after a compromise.
+func UpdateStaff(ctx context.Context, db *sql.DB, userID int, email string, passwordHash string, doctor *models.Doctor, receptionist *models.Receptionist) (*models.StaffAccount, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var oldEmail string
+	err = tx.QueryRowContext(ctx, `SELECT email FROM users WHERE id = $1 AND role <> 'admin' FOR UPDATE;`, userID).Scan(&oldEmail)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrStaffNotFound
+		}
+		return nil, fmt.Errorf("error fetching staff: %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx, `
+	UPDATE users SET email = $1, password_hash = COALESCE(NULLIF($2, ''), password_hash),
+	password_changed_at = CASE WHEN $2 = '' THEN password_changed_at ELSE NOW() END
+	WHERE id = $3;
+	`, email, passwordHash, userID)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return nil, ErrEmailTaken
+		}
+		return nil, fmt.Errorf("error updating user: %w", err)
+	}
+
+	if doctor != nil {
+		_, err = tx.ExecContext(ctx, `
+		UPDATE doctors SET
+			name = $1, email = $2, specialty = $3, emergency_contact = $4,
+			license_number = $5, experience_years = $6, updated_at = NOW()
+		WHERE email = $7;
+		`, doctor.Name, email, doctor.Specialty, doctor.EmergencyContact, doctor.LicenseNumber, doctor.ExperienceYears, oldEmail)
+		if err != nil {
+			return nil, fmt.Errorf("error updating doctor profile: %w", err)
+		}
+	}
+	if receptionist != nil {
+		_, err = tx.ExecContext(ctx, `
+		UPDATE receptionists SET name = $1, email = $2, phone = $3, updated_at = NOW()
+		WHERE email = $4;
+		`, receptionist.Name, email, receptionist.Phone, oldEmail)
+		if err != nil {
+			return nil, fmt.Errorf("error updating receptionist profile: %w", err)
+		}
+	}
+
+	if passwordHash != "" {
+		if err := revokeUserSessions(ctx, tx, userID); err != nil {
+			return nil, err
+		}
+	}
+
+	account, err := scanStaff(tx.QueryRowContext(ctx, staffSelect+`WHERE u.id = $1;`, userID))
+	if err != nil {
+		return nil, fmt.Errorf("error fetching updated staff: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("error committing transaction: %w", err)
+	}
+	return account, nil
+}
+
+// revokeUserSessions ends all of a user's sessions and revokes their
+// refresh tokens, so existing access tokens stop working and no new ones can
+// be minted. It must run in the transaction making the change that requires
+// it.
+func revokeUserSessions(ctx context.Context, db execer, userID int) error {
+	_, err := db.ExecContext(ctx, `
+	UPDATE sessions SET revoked_at = NOW()
+	WHERE user_id = $1 AND revoked_at IS NULL;
+	`, userID)
+	if err != nil {
+		return fmt.Errorf("error revoking sessions: %w", err)
+	}
+	_, err = db.ExecContext(ctx, `
+	UPDATE refresh_tokens SET revoked_at = NOW()
+	WHERE user_id = $1 AND revoked_at IS NULL;
+	`, userID)
+	if err != nil {
+		return fmt.Errorf("error revoking refresh tokens: %w", err)
+	}
+	return nil
+}
+
+// SetUserStatus changes an account's status. Leaving the active state also
+// ends the user's sessions and revokes their refresh tokens so no new access
+// tokens can be minted. Deactivating a doctor who still has patients
+// requires reassign to say where they go; the patients are moved and the
+// doctor's delegations revoked in the same transaction, and each move is
+// recorded in the patient's history as made by adminID. It returns the
+// number of patients moved.
+func SetUserStatus(ctx context.Context, db *sql.DB, userID int, status string, reassign models.PatientReassignment, adminID int) (int, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `UPDATE users SET status = $1 WHERE id = $2 AND role <> 'admin';`, status, userID)
+	if err != nil {
+		return 0, fmt.Errorf("error updating user status: %w", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("error getting rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return 0, ErrStaffNotFound
+	}
+
+	reassigned := 0
+	if status == models.StatusDeactivated {
+		reassigned, err = reassignPatients(ctx, tx, userID, reassign, models.PatientActor{UserID: &adminID})
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	if status != models.StatusActive {
+		if err := revokeUserSessions(ctx, tx, userID); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("error committing transaction: %w", err)
+	}
+	return reassigned, nil
+}
+
+// reassignPatients moves or unassigns the patients of a doctor being
+// deactivated and revokes the delegations the doctor gave or received.
+// Soft-deleted patients move with the rest, so that restoring one never
+// brings it back assigned to an inactive doctor, but only patients that are
+// not deleted require reassign to be given and are counted.
+func reassignPatients(ctx context.Context, tx *sql.Tx, doctorID int, reassign models.PatientReassignment, actor models.PatientActor) (int, error) {
+	var count, total int
+	err := tx.QueryRowContext(ctx, `
+	SELECT COUNT(*) FILTER (WHERE deleted_at IS NULL), COUNT(*)
+	FROM patients WHERE doctor_id = $1;
+	`, doctorID).Scan(&count, &total)
+	if err != nil {
+		return 0, fmt.Errorf("error counting assigned patients: %w", err)
+	}
+
+	if total > 0 {
+		var newDoctorID sql.NullInt64
+		switch {
+		case reassign.ReassignTo != nil:
+			if *reassign.ReassignTo == doctorID {
+				return 0, ErrReassignTargetInvalid
+			}
+			var exists bool
+			err = tx.QueryRowContext(ctx, `
+			SELECT EXISTS (
+				SELECT 1 FROM users u
+				JOIN doctors d ON d.email = u.email
+				WHERE u.id = $1 AND u.status = $2
+			);
+			`, *reassign.ReassignTo, models.StatusActive).Scan(&exists)
+			if err != nil {
+				return 0, fmt.Errorf("error checking reassignment target: %w", err)
+			}
+			if !exists {
+				return 0, ErrReassignTargetInvalid
+			}
+			newDoctorID = sql.NullInt64{Int64: int64(*reassign.ReassignTo), Valid: true}
+		case reassign.UnassignPatients, count == 0:
+		default:
+			return 0, ErrReassignmentRequired
+		}
+
+		rows, err := tx.QueryContext(ctx, `
+		UPDATE patients SET doctor_id = $1, updated_at = NOW()
+		WHERE doctor_id = $2
+		RETURNING id;
+		`, newDoctorID, doctorID)
+		if err != nil {
+			return 0, fmt.Errorf("error reassigning patients: %w", err)
+		}
+		var patientIDs []int
+		for rows.Next() {
+			var id int
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return 0, fmt.Errorf("error scanning reassigned patient: %w", err)
+			}
+			patientIDs = append(patientIDs, id)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return 0, fmt.Errorf("error iterating over rows: %w", err)
+		}
+		if len(patientIDs) > 0 {
+			if err := recordPatientRevisions(ctx, tx, patientIDs, models.PatientRevisionUpdate, actor); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, `
+	UPDATE patient_delegations SET revoked_at = NOW()
+	WHERE (from_doctor_id = $1 OR to_doctor_id = $1) AND revoked_at IS NULL;
+	`, doctorID)
+	if err != nil {
+		return 0, fmt.Errorf("error revoking delegations: %w", err)
+	}
+	return count, nil
+}
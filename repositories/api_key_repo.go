@@ -0,0 +1,163 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Somvaded/assessment/models"
+)
+
+var (
+	ErrInvalidAPIKey  = errors.New("invalid or expired API key")
+	ErrAPIKeyNotFound = errors.New("API key not found")
+)
+
+const apiKeySelect = `
+	SELECT id, name, prefix, scopes, created_by, expires_at, last_used_at, revoked_at, created_at
+	FROM api_keys
+	`
+
+func scanAPIKey(row rowScanner) (*models.APIKey, error) {
+	var (
+		key        models.APIKey
+		scopes     string
+		expiresAt  sql.NullTime
+		lastUsedAt sql.NullTime
+		revokedAt  sql.NullTime
+	)
+	err := row.Scan(
+		&key.ID,
+		&key.Name,
+		&key.Prefix,
+		&scopes,
+		&key.CreatedBy,
+		&expiresAt,
+		&lastUsedAt,
+		&revokedAt,
+		&key.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	key.Scopes = []string{}
+	if scopes != "" {
+		key.Scopes = strings.Split(scopes, ",")
+	}
+	if expiresAt.Valid {
+		key.ExpiresAt = &expiresAt.Time
+	}
+	if lastUsedAt.Valid {
+		key.LastUsedAt = &lastUsedAt.Time
+	}
+	if revokedAt.Valid {
+		key.RevokedAt = &revokedAt.Time
+	}
+	return &key, nil
+}
+
+func CreateAPIKey(ctx context.Context, db *sql.DB, key models.APIKey) (*models.APIKey, error) {
+	query := `
+	INSERT INTO api_keys (name, prefix, key_hash, scopes, created_by, expires_at)
+	VALUES ($1, $2, $3, $4, $5, $6)
+	RETURNING id, name, prefix, scopes, created_by, expires_at, last_used_at, revoked_at, created_at;
+	`
+	created, err := scanAPIKey(db.QueryRowContext(ctx, query,
+		key.Name, key.Prefix, key.KeyHash, strings.Join(key.Scopes, ","), key.CreatedBy, key.ExpiresAt))
+	if err != nil {
+		return nil, fmt.Errorf("error creating API key: %w", err)
+	}
+	return created, nil
+}
+
+func ListAPIKeys(ctx context.Context, db *sql.DB) ([]models.APIKey, error) {
+	rows, err := db.QueryContext(ctx, apiKeySelect+`ORDER BY id;`)
+	if err != nil {
+		return nil, fmt.Errorf("error querying API keys: %w", err)
+	}
+	defer rows.Close()
+
+	keys := []models.APIKey{}
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning API key: %w", err)
+		}
+		keys = append(keys, *key)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+	return keys, nil
+}
+
+func RevokeAPIKey(ctx context.Context, db *sql.DB, id int) error {
+	result, err := db.ExecContext(ctx, `
+	UPDATE api_keys SET revoked_at = NOW()
+	WHERE id = $1 AND revoked_at IS NULL;
+	`, id)
+	if err != nil {
+		return fmt.Errorf("error revoking API key: %w", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error checking rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+// APIKeyStore is what Protect needs to authenticate X-API-Key requests.
+type APIKeyStore interface {
+	// FindActive returns the unrevoked, unexpired key with keyHash, or
+	// ErrInvalidAPIKey.
+	FindActive(ctx context.Context, keyHash string) (*models.APIKey, error)
+	// Touch records that the key was just used.
+	Touch(ctx context.Context, id int) error
+}
+
+type PostgresAPIKeyStore struct {
+	DB *sql.DB
+}
+
+func NewPostgresAPIKeyStore(db *sql.DB) *PostgresAPIKeyStore {
+	return &PostgresAPIKeyStore{
+		DB: db,
+	}
+}
+
+func (s *PostgresAPIKeyStore) FindActive(ctx context.Context, keyHash string) (*models.APIKey, error) {
+	key, err := scanAPIKey(s.DB.QueryRowContext(ctx, apiKeySelect+`
+	WHERE key_hash = $1
+	AND revoked_at IS NULL
+	AND (expires_at IS NULL OR expires_at > NOW());
+	`, keyHash))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrInvalidAPIKey
+		}
+		return nil, fmt.Errorf("error fetching API key: %w", err)
+	}
+	return key, nil
+}
+
+// apiKeyTouchInterval bounds how often last_used_at is written for a busy
+// key, so every request from an analyzer does not update the row.
+const apiKeyTouchInterval = time.Minute
+
+func (s *PostgresAPIKeyStore) Touch(ctx context.Context, id int) error {
+	_, err := s.DB.ExecContext(ctx, `
+	UPDATE api_keys SET last_used_at = NOW()
+	WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < NOW() - make_interval(secs => $2));
+	`, id, apiKeyTouchInterval.Seconds())
+	if err != nil {
+		return fmt.Errorf("error updating API key usage: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"github.com/Somvaded/assessment/models"
+)
+
+// execer is satisfied by both *sql.DB and *sql.Tx so audit entries can be
+// written inside the transaction of the change they describe.
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+func InsertAuditLog(ctx context.Context, db execer, entry models.AuditEntry) error {
+	details := entry.Details
+	if details == nil {
+		details = map[string]any{}
+	}
+	detailsJSON, err := json.Marshal(details)
+	if err != nil {
+		return fmt.Errorf("error encoding audit details: %w", err)
+	}
+	severity := entry.Severity
+	if severity == "" {
+		severity = models.AuditSeverityInfo
+	}
+
+	query := `
+	INSERT INTO audit_log (user_id, api_key_id, action, resource_type, resource_id, outcome, severity, details, ip)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9);
+	`
+	_, err = db.ExecContext(ctx, query,
+		entry.UserID,
+		entry.APIKeyID,
+		entry.Action,
+		entry.ResourceType,
+		entry.ResourceID,
+		entry.Outcome,
+		severity,
+		detailsJSON,
+		entry.IP,
+	)
+	if err != nil {
+		return fmt.Errorf("error writing audit log: %w", err)
+	}
+	return nil
+}
+
+// AuditRecorder writes audit entries for callers, such as middleware, that
+// do not hold a database handle.
+type AuditRecorder interface {
+	Record(ctx context.Context, entry models.AuditEntry) error
+}
+
+type PostgresAuditRecorder struct {
+	DB *sql.DB
+}
+
+func NewPostgresAuditRecorder(db *sql.DB) *PostgresAuditRecorder {
+	return &PostgresAuditRecorder{
+		DB: db,
+	}
+}
+
+func (r *PostgresAuditRecorder) Record(ctx context.Context, entry models.AuditEntry) error {
+	return InsertAuditLog(ctx, r.DB, entry)
+}
+
+// ListAuditLog returns entries newest first, optionally only those with the
+// given severity.
+func ListAuditLog(ctx context.Context, db *sql.DB, severity string, limit int) ([]models.AuditEntry, error) {
+	query := `
+	SELECT id, user_id, api_key_id, action, resource_type, resource_id, outcome, severity, details, ip, created_at
+	FROM audit_log
+	WHERE ($1 = '' OR severity = $1)
+	ORDER BY id DESC
+	LIMIT $2;
+	`
+	rows, err := db.QueryContext(ctx, query, severity, limit)
+	if err != nil {
+		return nil, fmt.Errorf("error querying audit log: %w", err)
+	}
+	defer rows.Close()
+
+	entries := []models.AuditEntry{}
+	for rows.Next() {
+		var (
+			entry    models.AuditEntry
+			userID   sql.NullInt64
+			apiKeyID sql.NullInt64
+			details  []byte
+		)
+		err := rows.Scan(
+			&entry.ID,
+			&userID,
+			&apiKeyID,
+			&entry.Action,
+			&entry.ResourceType,
+			&entry.ResourceID,
+			&entry.Outcome,
+			&entry.Severity,
+			&details,
+			&entry.IP,
+			&entry.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning audit entry: %w", err)
+		}
+		if userID.Valid {
+			id := int(userID.Int64)
+			entry.UserID = &id
+		}
+		if apiKeyID.Valid {
+			id := int(apiKeyID.Int64)
+			entry.APIKeyID = &id
+		}
+		if len(details) > 0 {
+			if err := json.Unmarshal(details, &entry.Details); err != nil {
+				return nil, fmt.Errorf("error decoding audit details: %w", err)
+			}
+		}
+		entries = append(entries, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+	return entries, nil
+}
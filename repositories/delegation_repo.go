@@ -0,0 +1,174 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/Somvaded/assessment/models"
+)
+
+var (
+	ErrDelegationNotFound      = errors.New("delegation not found")
+	ErrDelegationTargetInvalid = errors.New("delegation target must be another active doctor")
+)
+
+// CreateDelegation shares a patient assigned to delegation.FromDoctorID with
+// delegation.ToDoctorID and writes the audit entry in the same transaction.
+// It returns ErrPatientNotFound, ErrPatientNotAssigned when the grantor is
+// not the assigned doctor, or ErrDelegationTargetInvalid.
+func CreateDelegation(ctx context.Context, db *sql.DB, delegation models.PatientDelegation, ip string) (*models.PatientDelegation, error) {
+	if delegation.ToDoctorID == delegation.FromDoctorID {
+		return nil, ErrDelegationTargetInvalid
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var assignedID sql.NullInt64
+	err = tx.QueryRowContext(ctx, `SELECT doctor_id FROM patients WHERE id = $1 AND deleted_at IS NULL;`, delegation.PatientID).Scan(&assignedID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrPatientNotFound
+		}
+		return nil, fmt.Errorf("error fetching patient: %w", err)
+	}
+	if !assignedID.Valid || int(assignedID.Int64) != delegation.FromDoctorID {
+		return nil, ErrPatientNotAssigned
+	}
+
+	var exists bool
+	err = tx.QueryRowContext(ctx, `
+	SELECT EXISTS (
+		SELECT 1 FROM users u
+		JOIN doctors d ON d.email = u.email
+		WHERE u.id = $1 AND u.status = $2
+	);
+	`, delegation.ToDoctorID, models.StatusActive).Scan(&exists)
+	if err != nil {
+		return nil, fmt.Errorf("error checking delegation target: %w", err)
+	}
+	if !exists {
+		return nil, ErrDelegationTargetInvalid
+	}
+
+	err = tx.QueryRowContext(ctx, `
+	INSERT INTO patient_delegations (patient_id, from_doctor_id, to_doctor_id, access, expires_at)
+	VALUES ($1, $2, $3, $4, $5)
+	RETURNING id, created_at;
+	`, delegation.PatientID, delegation.FromDoctorID, delegation.ToDoctorID, delegation.Access, delegation.ExpiresAt).
+		Scan(&delegation.ID, &delegation.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("error creating delegation: %w", err)
+	}
+
+	err = InsertAuditLog(ctx, tx, models.AuditEntry{
+		UserID:       &delegation.FromDoctorID,
+		Action:       "patient.delegate",
+		ResourceType: "patient",
+		ResourceID:   strconv.Itoa(delegation.PatientID),
+		Outcome:      models.AuditOutcomeAllowed,
+		Severity:     models.AuditSeverityInfo,
+		Details: map[string]any{
+			"delegation_id": delegation.ID,
+			"to_doctor_id":  delegation.ToDoctorID,
+			"access":        delegation.Access,
+			"expires_at":    delegation.ExpiresAt,
+		},
+		IP: ip,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("error committing transaction: %w", err)
+	}
+	return &delegation, nil
+}
+
+// ListDelegations returns the unrevoked, unexpired delegations doctorID has
+// given or received, newest first.
+func ListDelegations(ctx context.Context, db *sql.DB, doctorID int) ([]models.PatientDelegation, error) {
+	query := `
+	SELECT id, patient_id, from_doctor_id, to_doctor_id, access, created_at, expires_at
+	FROM patient_delegations
+	WHERE (from_doctor_id = $1 OR to_doctor_id = $1)
+	AND revoked_at IS NULL AND expires_at > NOW()
+	ORDER BY created_at DESC;
+	`
+	rows, err := db.QueryContext(ctx, query, doctorID)
+	if err != nil {
+		return nil, fmt.Errorf("error querying delegations: %w", err)
+	}
+	defer rows.Close()
+
+	delegations := []models.PatientDelegation{}
+	for rows.Next() {
+		var delegation models.PatientDelegation
+		err := rows.Scan(
+			&delegation.ID,
+			&delegation.PatientID,
+			&delegation.FromDoctorID,
+			&delegation.ToDoctorID,
+			&delegation.Access,
+			&delegation.CreatedAt,
+			&delegation.ExpiresAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning delegation: %w", err)
+		}
+		delegations = append(delegations, delegation)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+	return delegations, nil
+}
+
+// RevokeDelegation ends a delegation immediately. Only the doctor who gave
+// it may revoke it; anything else returns ErrDelegationNotFound.
+func RevokeDelegation(ctx context.Context, db *sql.DB, delegationID int, fromDoctorID int, ip string) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var patientID int
+	err = tx.QueryRowContext(ctx, `
+	UPDATE patient_delegations SET revoked_at = NOW()
+	WHERE id = $1 AND from_doctor_id = $2 AND revoked_at IS NULL
+	RETURNING patient_id;
+	`, delegationID, fromDoctorID).Scan(&patientID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrDelegationNotFound
+		}
+		return fmt.Errorf("error revoking delegation: %w", err)
+	}
+
+	err = InsertAuditLog(ctx, tx, models.AuditEntry{
+		UserID:       &fromDoctorID,
+		Action:       "patient.delegate.revoke",
+		ResourceType: "patient",
+		ResourceID:   strconv.Itoa(patientID),
+		Outcome:      models.AuditOutcomeAllowed,
+		Severity:     models.AuditSeverityInfo,
+		Details:      map[string]any{"delegation_id": delegationID},
+		IP:           ip,
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %w", err)
+	}
+	return nil
+}
@@ -4,28 +4,85 @@ package repositories
 import (	
 "context"
 "database/sql"
+"errors"
 "fmt"
+"strconv"
+"strings"
+"time"
 "github.com/Somvaded/assessment/models"
 )
 
-func FindPatientsByDoctorID(ctx context.Context, db *sql.DB, doctorID int) ([]models.DocPatientResponse, error) {
-	var patients []models.DocPatientResponse
+var (
+	ErrPatientNotFound    = errors.New("patient not found")
+	ErrPatientNotAssigned = errors.New("patient is not assigned to this doctor")
+)
 
-	query := `
-	SELECT id , name , phone , age,gender, emergency_contact,
-	known_allergies, medications, other_health_issues, 
-	doctor_notes,consent, created_at, updated_at FROM patients
-	WHERE doctor_id = $1;
+// FindPatientsByDoctorID returns one page of the patients assigned to
+// doctorID together with those other doctors have delegated to them, which
+// are flagged as delegated. A patient delegated more than once shows the
+// widest grant. Pages are ordered by (updated_at, id), newest first; it
+// returns ErrInvalidCursor for a cursor it did not issue.
+func FindPatientsByDoctorID(ctx context.Context, db *sql.DB, doctorID int, query models.DocPatientQuery) (*models.DocPatientPage, error) {
+	if query.Limit <= 0 {
+		query.Limit = defaultPatientPageSize
+	}
+	if query.Limit > maxPatientPageSize {
+		query.Limit = maxPatientPageSize
+	}
+
+	args := []any{doctorID}
+	arg := func(value any) string {
+		args = append(args, value)
+		return "$" + strconv.Itoa(len(args))
+	}
+	conditions := []string{"p.deleted_at IS NULL", "(p.doctor_id = $1 OR pd.access IS NOT NULL)"}
+	if query.Name != "" {
+		conditions = append(conditions, "p.name ILIKE "+arg("%"+escapeLike(query.Name)+"%"))
+	}
+	if query.Since != nil {
+		conditions = append(conditions, "p.updated_at > "+arg(*query.Since))
+	}
+	if query.Cursor != "" {
+		cursor, err := decodeCursor(query.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		if cursor.Sort != "updated_at" || cursor.Order != "desc" {
+			return nil, ErrInvalidCursor
+		}
+		conditions = append(conditions, "(p.updated_at, p.id) < ("+arg(cursor.Value)+"::timestamptz, "+arg(cursor.ID)+")")
+	}
+
+	sqlQuery := `
+	SELECT p.id, p.name, p.phone, p.age, p.gender, p.emergency_contact,
+	p.known_allergies, p.medications, p.other_health_issues,
+	p.doctor_notes, p.consent, p.created_at, p.updated_at,
+	p.doctor_id IS DISTINCT FROM $1, pd.access, pd.expires_at
+	FROM patients p
+	LEFT JOIN LATERAL (
+		SELECT access, expires_at FROM patient_delegations
+		WHERE patient_id = p.id AND to_doctor_id = $1 AND revoked_at IS NULL AND expires_at > NOW()
+		ORDER BY access = 'write' DESC, expires_at DESC
+		LIMIT 1
+	) pd ON p.doctor_id IS DISTINCT FROM $1
+	WHERE ` + strings.Join(conditions, " AND ") + `
+	ORDER BY p.updated_at DESC, p.id DESC
+	LIMIT ` + arg(query.Limit+1) + `;
 	`
 
-	rows, err := db.QueryContext(ctx, query, doctorID)
+	rows, err := db.QueryContext(ctx, sqlQuery, args...)
 	if err != nil {
 		return nil, fmt.Errorf("error querying patients: %w", err)
 	}
 	defer rows.Close()
 
+	page := &models.DocPatientPage{Patients: []models.DocPatientResponse{}, Limit: query.Limit}
 	for rows.Next() {
-		var patient models.DocPatientResponse
+		var (
+			patient             models.DocPatientResponse
+			delegationAccess    sql.NullString
+			delegationExpiresAt sql.NullTime
+		)
 		err := rows.Scan(
 			&patient.ID,
 			&patient.Name,
@@ -40,30 +97,59 @@ func FindPatientsByDoctorID(ctx context.Context, db *sql.DB, doctorID int) ([]mo
 			&patient.Consent,
 			&patient.CreatedAt,
 			&patient.UpdatedAt,
+			&patient.Delegated,
+			&delegationAccess,
+			&delegationExpiresAt,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("error scanning patient: %w", err)
 		}
-		patients = append(patients, patient)
+		patient.DelegationAccess = delegationAccess.String
+		if delegationExpiresAt.Valid {
+			patient.DelegationExpiresAt = &delegationExpiresAt.Time
+		}
+		page.Patients = append(page.Patients, patient)
 	}
 
 	if err := rows.Err(); err != nil {
 		return nil, fmt.Errorf("error iterating over rows: %w", err)
 	}
-	return patients, nil
+
+	if len(page.Patients) > query.Limit {
+		page.Patients = page.Patients[:query.Limit]
+		last := page.Patients[len(page.Patients)-1]
+		page.NextCursor = encodeCursor(pageCursor{
+			Sort:  "updated_at",
+			Order: "desc",
+			Value: last.UpdatedAt.Format(time.RFC3339Nano),
+			ID:    last.ID,
+		})
+	}
+	return page, nil
 }
 
 
-func UpdateMedicalInfo(ctx context.Context, db *sql.DB, patient_id int,updateInfo models.DocPatientUpdate)(*models.DocPatientResponse,error){
+// UpdateMedicalInfo updates a patient's medical fields only if the patient
+// is assigned to doctor_id, the doctor holds an active emergency access
+// grant for them or a delegation with write access, and records the change
+// in the patient's history. It returns ErrPatientNotFound or
+// ErrPatientNotAssigned when nothing was updated.
+func UpdateMedicalInfo(ctx context.Context, db *sql.DB, patient_id int, doctor_id int, updateInfo models.DocPatientUpdate)(*models.DocPatientResponse,error){
 	query := `
 	UPDATE patients
 	SET known_allergies = $1, medications = $2, other_health_issues = $3, doctor_notes = $4, updated_at = NOW()
-	WHERE id = $5
+	WHERE id = $5 AND ` + patientAccessCondition("$6", models.DelegationWrite) + `
 	RETURNING id, name, phone, age, gender, emergency_contact, known_allergies, medications, other_health_issues, doctor_notes, consent, created_at, updated_at;
 	`
 
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
 	var updatedPatient models.DocPatientResponse
-	err := db.QueryRowContext(
+	err = tx.QueryRowContext(
 		ctx,
 		query,
 		updateInfo.KnownAllergies,
@@ -71,6 +157,7 @@ func UpdateMedicalInfo(ctx context.Context, db *sql.DB, patient_id int,updateInf
 		updateInfo.OtherHealthIssues,
 		updateInfo.DoctorNotes,
 		patient_id,
+		doctor_id,
 	).Scan(
 		&updatedPatient.ID,
 		&updatedPatient.Name,
@@ -87,9 +174,31 @@ func UpdateMedicalInfo(ctx context.Context, db *sql.DB, patient_id int,updateInf
 		&updatedPatient.UpdatedAt,
 	)
 	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, patientAccessError(ctx, db, patient_id)
+		}
 		return nil, fmt.Errorf("error updating patient medical info: %w", err)
 	}
+	if err := recordPatientRevision(ctx, tx, patient_id, models.PatientRevisionUpdate, models.PatientActor{UserID: &doctor_id}); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("error committing transaction: %w", err)
+	}
 
 	return &updatedPatient, nil
 }
 
+// patientAccessError explains why a statement restricted to a doctor's own
+// patients matched no row.
+func patientAccessError(ctx context.Context, db *sql.DB, patient_id int) error {
+	var exists bool
+	err := db.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM patients WHERE id = $1 AND deleted_at IS NULL);`, patient_id).Scan(&exists)
+	if err != nil {
+		return fmt.Errorf("error checking patient: %w", err)
+	}
+	if !exists {
+		return ErrPatientNotFound
+	}
+	return ErrPatientNotAssigned
+}
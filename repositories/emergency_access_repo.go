@@ -0,0 +1,191 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/Somvaded/assessment/models"
+)
+
+var ErrPatientAlreadyAssigned = errors.New("patient is already assigned to this doctor")
+
+// patientAccessCondition is the SQL predicate over the patients table that
+// holds when the doctor bound to param may read (models.DelegationRead) or
+// update (models.DelegationWrite) the row: the patient is not deleted, and
+// is assigned to them, they hold an unexpired emergency access grant for it
+// or the assigned doctor has delegated it to them with sufficient access.
+func patientAccessCondition(param string, access string) string {
+	delegationAccess := ``
+	if access == models.DelegationWrite {
+		delegationAccess = ` AND pd.access = 'write'`
+	}
+	return `patients.deleted_at IS NULL AND (patients.doctor_id = ` + param + ` OR EXISTS (
+		SELECT 1 FROM emergency_access_grants g
+		WHERE g.patient_id = patients.id AND g.doctor_id = ` + param + ` AND g.expires_at > NOW()
+	) OR EXISTS (
+		SELECT 1 FROM patient_delegations pd
+		WHERE pd.patient_id = patients.id AND pd.to_doctor_id = ` + param + `
+		AND pd.revoked_at IS NULL AND pd.expires_at > NOW()` + delegationAccess + `
+	))`
+}
+
+// FindPatientForDoctor returns one patient the doctor may access, or
+// ErrPatientNotFound / ErrPatientNotAssigned.
+func FindPatientForDoctor(ctx context.Context, db *sql.DB, patientID int, doctorID int) (*models.DocPatientResponse, error) {
+	query := `
+	SELECT ` + docPatientColumns + ` FROM patients
+	WHERE id = $1 AND ` + patientAccessCondition("$2", models.DelegationRead) + `;
+	`
+	patient, err := scanDocPatient(db.QueryRowContext(ctx, query, patientID, doctorID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, patientAccessError(ctx, db, patientID)
+		}
+		return nil, fmt.Errorf("error fetching patient: %w", err)
+	}
+	return patient, nil
+}
+
+// docPatientColumns are the patient columns doctors see, in the order
+// scanDocPatient reads them.
+const docPatientColumns = `id, name, phone, age, gender, emergency_contact,
+	known_allergies, medications, other_health_issues,
+	doctor_notes, consent, created_at, updated_at`
+
+func scanDocPatient(row rowScanner) (*models.DocPatientResponse, error) {
+	var patient models.DocPatientResponse
+	err := row.Scan(
+		&patient.ID,
+		&patient.Name,
+		&patient.Phone,
+		&patient.Age,
+		&patient.Gender,
+		&patient.EmergencyContact,
+		&patient.KnownAllergies,
+		&patient.Medications,
+		&patient.OtherHealthIssues,
+		&patient.DoctorNotes,
+		&patient.Consent,
+		&patient.CreatedAt,
+		&patient.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &patient, nil
+}
+
+// CreateEmergencyGrant records a break-the-glass grant together with its
+// high-severity audit entry in one transaction. It returns the grant and
+// the patient's assigned doctor, who is nil when the patient has none.
+func CreateEmergencyGrant(ctx context.Context, db *sql.DB, grant models.EmergencyAccessGrant, ip string) (*models.EmergencyAccessGrant, *models.Doctor, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var (
+		assignedID    sql.NullInt64
+		assignedName  sql.NullString
+		assignedEmail sql.NullString
+	)
+	err = tx.QueryRowContext(ctx, `
+	SELECT p.doctor_id, d.name, d.email
+	FROM patients p
+	LEFT JOIN users u ON u.id = p.doctor_id
+	LEFT JOIN doctors d ON d.email = u.email
+	WHERE p.id = $1 AND p.deleted_at IS NULL;
+	`, grant.PatientID).Scan(&assignedID, &assignedName, &assignedEmail)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil, ErrPatientNotFound
+		}
+		return nil, nil, fmt.Errorf("error fetching patient: %w", err)
+	}
+	if assignedID.Valid && int(assignedID.Int64) == grant.DoctorID {
+		return nil, nil, ErrPatientAlreadyAssigned
+	}
+
+	err = tx.QueryRowContext(ctx, `
+	INSERT INTO emergency_access_grants (doctor_id, patient_id, justification, expires_at)
+	VALUES ($1, $2, $3, $4)
+	RETURNING id, granted_at;
+	`, grant.DoctorID, grant.PatientID, grant.Justification, grant.ExpiresAt).Scan(&grant.ID, &grant.GrantedAt)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error creating emergency access grant: %w", err)
+	}
+
+	details := map[string]any{
+		"grant_id":      grant.ID,
+		"justification": grant.Justification,
+		"expires_at":    grant.ExpiresAt,
+	}
+	if assignedID.Valid {
+		details["assigned_doctor_id"] = assignedID.Int64
+	}
+	err = InsertAuditLog(ctx, tx, models.AuditEntry{
+		UserID:       &grant.DoctorID,
+		Action:       "patient.emergency_access",
+		ResourceType: "patient",
+		ResourceID:   strconv.Itoa(grant.PatientID),
+		Outcome:      models.AuditOutcomeAllowed,
+		Severity:     models.AuditSeverityHigh,
+		Details:      details,
+		IP:           ip,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, nil, fmt.Errorf("error committing transaction: %w", err)
+	}
+
+	var assigned *models.Doctor
+	if assignedID.Valid && assignedEmail.Valid {
+		assigned = &models.Doctor{ID: int(assignedID.Int64), Name: assignedName.String, Email: assignedEmail.String}
+	}
+	return &grant, assigned, nil
+}
+
+// ListEmergencyGrants returns grants newest first. activeOnly limits the
+// result to grants that have not expired.
+func ListEmergencyGrants(ctx context.Context, db *sql.DB, activeOnly bool, limit int) ([]models.EmergencyAccessGrant, error) {
+	query := `
+	SELECT id, doctor_id, patient_id, justification, granted_at, expires_at
+	FROM emergency_access_grants
+	WHERE ($1 = FALSE OR expires_at > NOW())
+	ORDER BY granted_at DESC
+	LIMIT $2;
+	`
+	rows, err := db.QueryContext(ctx, query, activeOnly, limit)
+	if err != nil {
+		return nil, fmt.Errorf("error querying emergency access grants: %w", err)
+	}
+	defer rows.Close()
+
+	grants := []models.EmergencyAccessGrant{}
+	for rows.Next() {
+		var grant models.EmergencyAccessGrant
+		err := rows.Scan(
+			&grant.ID,
+			&grant.DoctorID,
+			&grant.PatientID,
+			&grant.Justification,
+			&grant.GrantedAt,
+			&grant.ExpiresAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning emergency access grant: %w", err)
+		}
+		grants = append(grants, grant)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+	return grants, nil
+}
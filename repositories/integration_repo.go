@@ -0,0 +1,68 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/Somvaded/assessment/models"
+)
+
+// FindPatientMedicalInfo returns the fields doctors see of any patient that
+// is not deleted, for API keys with the medical:read scope. It returns
+// ErrPatientNotFound when there is no such patient.
+func FindPatientMedicalInfo(ctx context.Context, db *sql.DB, patientID int) (*models.DocPatientResponse, error) {
+	query := `
+	SELECT ` + docPatientColumns + ` FROM patients
+	WHERE id = $1 AND deleted_at IS NULL;
+	`
+	patient, err := scanDocPatient(db.QueryRowContext(ctx, query, patientID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrPatientNotFound
+		}
+		return nil, fmt.Errorf("error fetching patient: %w", err)
+	}
+	return patient, nil
+}
+
+// PushMedicalInfo updates a patient's medical fields on behalf of an API key
+// with the medical:write scope, such as a lab analyzer, and records the
+// change in the patient's history as made by that key. It returns
+// ErrPatientNotFound when there is no such patient.
+func PushMedicalInfo(ctx context.Context, db *sql.DB, patientID int, apiKeyID int, updateInfo models.DocPatientUpdate) (*models.DocPatientResponse, error) {
+	query := `
+	UPDATE patients
+	SET known_allergies = $1, medications = $2, other_health_issues = $3, doctor_notes = $4, updated_at = NOW()
+	WHERE id = $5 AND deleted_at IS NULL
+	RETURNING ` + docPatientColumns + `;
+	`
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	patient, err := scanDocPatient(tx.QueryRowContext(ctx, query,
+		updateInfo.KnownAllergies,
+		updateInfo.Medications,
+		updateInfo.OtherHealthIssues,
+		updateInfo.DoctorNotes,
+		patientID,
+	))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrPatientNotFound
+		}
+		return nil, fmt.Errorf("error updating patient medical info: %w", err)
+	}
+	if err := recordPatientRevision(ctx, tx, patientID, models.PatientRevisionUpdate, models.PatientActor{APIKeyID: &apiKeyID}); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("error committing transaction: %w", err)
+	}
+	return patient, nil
+}
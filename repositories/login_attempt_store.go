@@ -0,0 +1,175 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Somvaded/assessment/models"
+)
+
+// LoginAttemptStore keeps failed login counters per throttling key. The
+// backoff policy itself lives with the caller; the store only counts and
+// remembers until when a key is blocked.
+type LoginAttemptStore interface {
+	// Get returns the state for key, or nil if it has no recorded failures.
+	Get(ctx context.Context, key string) (*models.LoginAttempt, error)
+	// RecordFailure atomically increments the failure count for key. When the
+	// previous failure is older than window the count restarts at one.
+	RecordFailure(ctx context.Context, key string, window time.Duration) (*models.LoginAttempt, error)
+	Block(ctx context.Context, key string, until time.Time) error
+	Reset(ctx context.Context, key string) error
+}
+
+// MemoryLoginAttemptStore counts failures in process memory. Counters are
+// per instance and are lost on restart.
+type MemoryLoginAttemptStore struct {
+	mu       sync.Mutex
+	attempts map[string]*models.LoginAttempt
+}
+
+func NewMemoryLoginAttemptStore() *MemoryLoginAttemptStore {
+	return &MemoryLoginAttemptStore{
+		attempts: make(map[string]*models.LoginAttempt),
+	}
+}
+
+func (s *MemoryLoginAttemptStore) Get(ctx context.Context, key string) (*models.LoginAttempt, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	attempt, ok := s.attempts[key]
+	if !ok {
+		return nil, nil
+	}
+	copied := *attempt
+	return &copied, nil
+}
+
+func (s *MemoryLoginAttemptStore) RecordFailure(ctx context.Context, key string, window time.Duration) (*models.LoginAttempt, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	attempt, ok := s.attempts[key]
+	if !ok {
+		attempt = &models.LoginAttempt{Key: key}
+		s.attempts[key] = attempt
+	}
+	if now.Sub(attempt.LastFailureAt) > window {
+		attempt.Failures = 0
+	}
+	attempt.Failures++
+	attempt.LastFailureAt = now
+
+	copied := *attempt
+	return &copied, nil
+}
+
+func (s *MemoryLoginAttemptStore) Block(ctx context.Context, key string, until time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	attempt, ok := s.attempts[key]
+	if !ok {
+		attempt = &models.LoginAttempt{Key: key, LastFailureAt: time.Now()}
+		s.attempts[key] = attempt
+	}
+	attempt.BlockedUntil = until
+	return nil
+}
+
+func (s *MemoryLoginAttemptStore) Reset(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.attempts, key)
+	return nil
+}
+
+// PostgresLoginAttemptStore shares counters between instances through the
+// login_attempts table.
+type PostgresLoginAttemptStore struct {
+	DB *sql.DB
+}
+
+func NewPostgresLoginAttemptStore(db *sql.DB) *PostgresLoginAttemptStore {
+	return &PostgresLoginAttemptStore{
+		DB: db,
+	}
+}
+
+func (s *PostgresLoginAttemptStore) Get(ctx context.Context, key string) (*models.LoginAttempt, error) {
+	var (
+		attempt      models.LoginAttempt
+		blockedUntil sql.NullTime
+	)
+	err := s.DB.QueryRowContext(ctx, `
+	SELECT key, failures, last_failure_at, blocked_until
+	FROM login_attempts WHERE key = $1;
+	`, key).Scan(
+		&attempt.Key,
+		&attempt.Failures,
+		&attempt.LastFailureAt,
+		&blockedUntil,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error reading login attempts: %w", err)
+	}
+	attempt.BlockedUntil = blockedUntil.Time
+	return &attempt, nil
+}
+
+func (s *PostgresLoginAttemptStore) RecordFailure(ctx context.Context, key string, window time.Duration) (*models.LoginAttempt, error) {
+	query := `
+	INSERT INTO login_attempts (key, failures, last_failure_at)
+	VALUES ($1, 1, NOW())
+	ON CONFLICT (key) DO UPDATE SET
+		failures = CASE
+			WHEN login_attempts.last_failure_at < NOW() - make_interval(secs => $2) THEN 1
+			ELSE login_attempts.failures + 1
+		END,
+		last_failure_at = NOW()
+	RETURNING key, failures, last_failure_at, blocked_until;
+	`
+	var (
+		attempt      models.LoginAttempt
+		blockedUntil sql.NullTime
+	)
+	err := s.DB.QueryRowContext(ctx, query, key, window.Seconds()).Scan(
+		&attempt.Key,
+		&attempt.Failures,
+		&attempt.LastFailureAt,
+		&blockedUntil,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error recording login failure: %w", err)
+	}
+	attempt.BlockedUntil = blockedUntil.Time
+	return &attempt, nil
+}
+
+func (s *PostgresLoginAttemptStore) Block(ctx context.Context, key string, until time.Time) error {
+	query := `
+	INSERT INTO login_attempts (key, failures, last_failure_at, blocked_until)
+	VALUES ($1, 0, NOW(), $2)
+	ON CONFLICT (key) DO UPDATE SET blocked_until = EXCLUDED.blocked_until;
+	`
+	if _, err := s.DB.ExecContext(ctx, query, key, until); err != nil {
+		return fmt.Errorf("error blocking login key: %w", err)
+	}
+	return nil
+}
+
+func (s *PostgresLoginAttemptStore) Reset(ctx context.Context, key string) error {
+	if _, err := s.DB.ExecContext(ctx, `DELETE FROM login_attempts WHERE key = $1;`, key); err != nil {
+		return fmt.Errorf("error resetting login attempts: %w", err)
+	}
+	return nil
+}
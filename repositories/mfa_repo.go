@@ -0,0 +1,145 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/Somvaded/assessment/models"
+)
+
+// FindMFA returns the user's TOTP enrolment, or nil when there is none.
+func FindMFA(ctx context.Context, db *sql.DB, userID int) (*models.UserMFA, error) {
+	var mfa models.UserMFA
+	err := db.QueryRowContext(ctx, `
+	SELECT user_id, secret, enabled, last_used_step, confirmed_at, created_at
+	FROM user_mfa WHERE user_id = $1;
+	`, userID).Scan(
+		&mfa.UserID,
+		&mfa.Secret,
+		&mfa.Enabled,
+		&mfa.LastUsedStep,
+		&mfa.ConfirmedAt,
+		&mfa.CreatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error finding mfa enrolment: %w", err)
+	}
+	return &mfa, nil
+}
+
+// SavePendingMFA stores a new, unconfirmed secret for the user, replacing a
+// previous pending enrolment. It never overwrites an enabled one.
+func SavePendingMFA(ctx context.Context, db *sql.DB, userID int, secret string) error {
+	query := `
+	INSERT INTO user_mfa (user_id, secret, enabled)
+	VALUES ($1, $2, FALSE)
+	ON CONFLICT (user_id) DO UPDATE
+	SET secret = EXCLUDED.secret, last_used_step = NULL, created_at = NOW()
+	WHERE user_mfa.enabled = FALSE;
+	`
+	_, err := db.ExecContext(ctx, query, userID, secret)
+	if err != nil {
+		return fmt.Errorf("error saving mfa secret: %w", err)
+	}
+	return nil
+}
+
+// EnableMFA confirms the pending enrolment, records the step of the code used
+// to confirm it and replaces the user's recovery codes.
+func EnableMFA(ctx context.Context, db *sql.DB, userID int, step int64, recoveryCodeHashes []string) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `
+	UPDATE user_mfa SET enabled = TRUE, confirmed_at = NOW(), last_used_step = $2
+	WHERE user_id = $1;
+	`, userID, step)
+	if err != nil {
+		return fmt.Errorf("error enabling mfa: %w", err)
+	}
+
+	if err := replaceRecoveryCodes(ctx, tx, userID, recoveryCodeHashes); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %w", err)
+	}
+	return nil
+}
+
+func replaceRecoveryCodes(ctx context.Context, tx *sql.Tx, userID int, codeHashes []string) error {
+	if _, err := tx.ExecContext(ctx, `DELETE FROM mfa_recovery_codes WHERE user_id = $1;`, userID); err != nil {
+		return fmt.Errorf("error deleting recovery codes: %w", err)
+	}
+	for _, hash := range codeHashes {
+		_, err := tx.ExecContext(ctx, `INSERT INTO mfa_recovery_codes (user_id, code_hash) VALUES ($1, $2);`, userID, hash)
+		if err != nil {
+			return fmt.Errorf("error storing recovery code: %w", err)
+		}
+	}
+	return nil
+}
+
+func DisableMFA(ctx context.Context, db *sql.DB, userID int) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM mfa_recovery_codes WHERE user_id = $1;`, userID); err != nil {
+		return fmt.Errorf("error deleting recovery codes: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM user_mfa WHERE user_id = $1;`, userID); err != nil {
+		return fmt.Errorf("error disabling mfa: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %w", err)
+	}
+	return nil
+}
+
+// ConsumeTOTPStep atomically records step as the user's last used TOTP step.
+// It returns false when a code from this or a later step was already used.
+func ConsumeTOTPStep(ctx context.Context, db *sql.DB, userID int, step int64) (bool, error) {
+	result, err := db.ExecContext(ctx, `
+	UPDATE user_mfa SET last_used_step = $2
+	WHERE user_id = $1 AND enabled = TRUE
+	AND (last_used_step IS NULL OR last_used_step < $2);
+	`, userID, step)
+	if err != nil {
+		return false, fmt.Errorf("error recording totp step: %w", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("error getting rows affected: %w", err)
+	}
+	return rowsAffected == 1, nil
+}
+
+// ConsumeRecoveryCode marks the matching unused recovery code as used and
+// reports whether one was found.
+func ConsumeRecoveryCode(ctx context.Context, db *sql.DB, userID int, codeHash string) (bool, error) {
+	result, err := db.ExecContext(ctx, `
+	UPDATE mfa_recovery_codes SET used_at = NOW()
+	WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL;
+	`, userID, codeHash)
+	if err != nil {
+		return false, fmt.Errorf("error using recovery code: %w", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("error getting rows affected: %w", err)
+	}
+	return rowsAffected > 0, nil
+}
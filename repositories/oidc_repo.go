@@ -0,0 +1,47 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/Somvaded/assessment/models"
+)
+
+var ErrOIDCUserNotFound = errors.New("no account is linked to this identity")
+
+// FindStaffByOIDC resolves an IdP identity to a local account. The subject
+// is tried first; otherwise, when email is non-empty, an account with that
+// email and no linked subject is linked to subject and returned. Callers
+// must only pass an email the IdP has verified.
+func FindStaffByOIDC(ctx context.Context, db *sql.DB, subject string, email string) (*models.StaffAccount, error) {
+	account, err := scanStaff(db.QueryRowContext(ctx, staffSelect+`WHERE u.oidc_subject = $1;`, subject))
+	if err == nil {
+		return account, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("error fetching staff by subject: %w", err)
+	}
+	if email == "" {
+		return nil, ErrOIDCUserNotFound
+	}
+
+	var userID int
+	err = db.QueryRowContext(ctx, `
+	UPDATE users SET oidc_subject = $1
+	WHERE LOWER(email) = LOWER($2) AND oidc_subject IS NULL
+	RETURNING id;
+	`, subject, email).Scan(&userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrOIDCUserNotFound
+		}
+		if isUniqueViolation(err) {
+			// A concurrent login linked the subject first.
+			return FindStaffByOIDC(ctx, db, subject, "")
+		}
+		return nil, fmt.Errorf("error linking identity: %w", err)
+	}
+	return FindStaffByID(ctx, db, userID)
+}
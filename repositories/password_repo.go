@@ -0,0 +1,133 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// FindPasswordHashes returns the user's current password hash followed by
+// up to history hashes from password_history, newest first, together with
+// when the current password was set.
+func FindPasswordHashes(ctx context.Context, db *sql.DB, userID int, history int) ([]string, time.Time, error) {
+	var (
+		current   string
+		changedAt time.Time
+	)
+	err := db.QueryRowContext(ctx, `
+	SELECT password_hash, password_changed_at FROM users WHERE id = $1;
+	`, userID).Scan(&current, &changedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, time.Time{}, ErrStaffNotFound
+		}
+		return nil, time.Time{}, fmt.Errorf("error fetching password: %w", err)
+	}
+
+	hashes := []string{current}
+	if history <= 0 {
+		return hashes, changedAt, nil
+	}
+	rows, err := db.QueryContext(ctx, `
+	SELECT password_hash FROM password_history
+	WHERE user_id = $1
+	ORDER BY id DESC
+	LIMIT $2;
+	`, userID, history)
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("error querying password history: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var hash string
+		if err := rows.Scan(&hash); err != nil {
+			return nil, time.Time{}, fmt.Errorf("error scanning password history: %w", err)
+		}
+		hashes = append(hashes, hash)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, time.Time{}, fmt.Errorf("error iterating over rows: %w", err)
+	}
+	return hashes, changedAt, nil
+}
+
+// FindPasswordChangedAt returns when the user's current password was set.
+func FindPasswordChangedAt(ctx context.Context, db *sql.DB, userID int) (time.Time, error) {
+	var changedAt time.Time
+	err := db.QueryRowContext(ctx, `SELECT password_changed_at FROM users WHERE id = $1;`, userID).Scan(&changedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return time.Time{}, ErrStaffNotFound
+		}
+		return time.Time{}, fmt.Errorf("error fetching password age: %w", err)
+	}
+	return changedAt, nil
+}
+
+// ChangePassword sets a new password for userID and ends every session of
+// the user except keepSessionID, the one the change was made from.
+func ChangePassword(ctx context.Context, db *sql.DB, userID int, passwordHash string, history int, keepSessionID string) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := setPassword(ctx, tx, userID, passwordHash, history); err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+	UPDATE sessions SET revoked_at = NOW()
+	WHERE user_id = $1 AND id <> $2 AND revoked_at IS NULL;
+	`, userID, keepSessionID)
+	if err != nil {
+		return fmt.Errorf("error revoking sessions: %w", err)
+	}
+	_, err = tx.ExecContext(ctx, `
+	UPDATE refresh_tokens SET revoked_at = NOW()
+	WHERE user_id = $1 AND family_id <> $2 AND revoked_at IS NULL;
+	`, userID, keepSessionID)
+	if err != nil {
+		return fmt.Errorf("error revoking refresh tokens: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %w", err)
+	}
+	return nil
+}
+
+// setPassword stores passwordHash as the user's password, appends it to the
+// password history and trims the history to its newest history entries.
+func setPassword(ctx context.Context, tx execer, userID int, passwordHash string, history int) error {
+	_, err := tx.ExecContext(ctx, `
+	UPDATE users SET password_hash = $1, password_changed_at = NOW()
+	WHERE id = $2;
+	`, passwordHash, userID)
+	if err != nil {
+		return fmt.Errorf("error updating password: %w", err)
+	}
+	if history <= 0 {
+		return nil
+	}
+
+	_, err = tx.ExecContext(ctx, `
+	INSERT INTO password_history (user_id, password_hash) VALUES ($1, $2);
+	`, userID, passwordHash)
+	if err != nil {
+		return fmt.Errorf("error recording password history: %w", err)
+	}
+	_, err = tx.ExecContext(ctx, `
+	DELETE FROM password_history
+	WHERE user_id = $1 AND id NOT IN (
+		SELECT id FROM password_history WHERE user_id = $1 ORDER BY id DESC LIMIT $2
+	);
+	`, userID, history)
+	if err != nil {
+		return fmt.Errorf("error trimming password history: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Somvaded/assessment/models"
+)
+
+var ErrInvalidResetToken = errors.New("invalid or expired reset token")
+
+// FindActiveUserByEmail returns the active account registered under email,
+// or nil when there is none. It never checks a password.
+func FindActiveUserByEmail(ctx context.Context, db *sql.DB, email string) (*models.User, error) {
+	var user models.User
+	err := db.QueryRowContext(ctx, `
+	SELECT id, email, role, status FROM users
+	WHERE email = $1 AND status = $2;
+	`, email, models.StatusActive).Scan(
+		&user.ID,
+		&user.Email,
+		&user.Role,
+		&user.Status,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error finding user: %w", err)
+	}
+	return &user, nil
+}
+
+func CreatePasswordResetToken(ctx context.Context, db *sql.DB, userID int, tokenHash string, expiresAt time.Time) error {
+	query := `
+	INSERT INTO password_reset_tokens (user_id, token_hash, expires_at)
+	VALUES ($1, $2, $3);
+	`
+	_, err := db.ExecContext(ctx, query, userID, tokenHash, expiresAt)
+	if err != nil {
+		return fmt.Errorf("error creating reset token: %w", err)
+	}
+	return nil
+}
+
+// FindResetTokenUser returns the owner of a usable reset token, so the new
+// password can be checked against their history before it is set.
+func FindResetTokenUser(ctx context.Context, db *sql.DB, tokenHash string) (int, error) {
+	var userID int
+	err := db.QueryRowContext(ctx, `
+	SELECT t.user_id FROM password_reset_tokens t
+	JOIN users u ON u.id = t.user_id
+	WHERE t.token_hash = $1 AND t.used_at IS NULL AND t.expires_at > NOW() AND u.status = $2;
+	`, tokenHash, models.StatusActive).Scan(&userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrInvalidResetToken
+		}
+		return 0, fmt.Errorf("error finding reset token: %w", err)
+	}
+	return userID, nil
+}
+
+// ResetPassword consumes the reset token identified by tokenHash and sets the
+// owner's password hash, keeping up to history past hashes. Every other
+// outstanding reset token and all sessions and refresh tokens of the user
+// are invalidated in the same transaction.
+func ResetPassword(ctx context.Context, db *sql.DB, tokenHash string, passwordHash string, history int) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var userID int
+	err = tx.QueryRowContext(ctx, `
+	SELECT t.user_id FROM password_reset_tokens t
+	JOIN users u ON u.id = t.user_id
+	WHERE t.token_hash = $1 AND t.used_at IS NULL AND t.expires_at > NOW() AND u.status = $2
+	FOR UPDATE OF t;
+	`, tokenHash, models.StatusActive).Scan(&userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrInvalidResetToken
+		}
+		return fmt.Errorf("error finding reset token: %w", err)
+	}
+
+	if err := setPassword(ctx, tx, userID, passwordHash, history); err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+	UPDATE password_reset_tokens SET used_at = NOW()
+	WHERE user_id = $1 AND used_at IS NULL;
+	`, userID)
+	if err != nil {
+		return fmt.Errorf("error consuming reset tokens: %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx, `
+	UPDATE sessions SET revoked_at = NOW()
+	WHERE user_id = $1 AND revoked_at IS NULL;
+	`, userID)
+	if err != nil {
+		return fmt.Errorf("error revoking sessions: %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx, `
+	UPDATE refresh_tokens SET revoked_at = NOW()
+	WHERE user_id = $1 AND revoked_at IS NULL;
+	`, userID)
+	if err != nil {
+		return fmt.Errorf("error revoking refresh tokens: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,228 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/Somvaded/assessment/models"
+)
+
+var ErrRevisionNotFound = errors.New("patient revision not found")
+
+// DoctorPatientFields are the patient fields doctors may see, matching
+// models.DocPatientResponse. Doctors get the history restricted to them.
+var DoctorPatientFields = []string{
+	"id", "name", "phone", "age", "gender", "emergency_contact",
+	"known_allergies", "medications", "other_health_issues",
+	"doctor_notes", "consent", "created_at", "updated_at",
+}
+
+// recordPatientRevision appends the current state of a patient to its
+// history. It must run in the transaction that changed the patient, after
+// the change, so that the row lock taken by the change keeps revision
+// numbers in sequence. updated_at is never reported as a changed field.
+func recordPatientRevision(ctx context.Context, db execer, patientID int, action string, actor models.PatientActor) error {
+	query := `
+	WITH cur AS (
+		SELECT to_jsonb(p) AS snapshot FROM patients p WHERE p.id = $1
+	), prev AS (
+		SELECT revision, snapshot FROM patient_revisions
+		WHERE patient_id = $1
+		ORDER BY revision DESC
+		LIMIT 1
+	)
+	INSERT INTO patient_revisions (patient_id, revision, action, snapshot, changed_fields, changed_by, api_key_id)
+	SELECT $1, COALESCE((SELECT revision FROM prev), 0) + 1, $2, cur.snapshot,
+		COALESCE((
+			SELECT jsonb_agg(f.key ORDER BY f.key) FROM jsonb_each(cur.snapshot) f
+			WHERE f.key <> 'updated_at' AND f.value IS DISTINCT FROM (SELECT snapshot FROM prev) -> f.key
+		), '[]'),
+		$3, $4
+	FROM cur;
+	`
+	_, err := db.ExecContext(ctx, query, patientID, action, actor.UserID, actor.APIKeyID)
+	if err != nil {
+		return fmt.Errorf("error recording patient revision: %w", err)
+	}
+	return nil
+}
+
+// recordPatientRevisions does what recordPatientRevision does for many
+// patients in one statement.
+func recordPatientRevisions(ctx context.Context, db execer, patientIDs []int, action string, actor models.PatientActor) error {
+	query := `
+	INSERT INTO patient_revisions (patient_id, revision, action, snapshot, changed_fields, changed_by, api_key_id)
+	SELECT p.id, COALESCE(prev.revision, 0) + 1, $2, cur.snapshot,
+		COALESCE((
+			SELECT jsonb_agg(f.key ORDER BY f.key) FROM jsonb_each(cur.snapshot) f
+			WHERE f.key <> 'updated_at' AND f.value IS DISTINCT FROM prev.snapshot -> f.key
+		), '[]'),
+		$3, $4
+	FROM patients p
+	CROSS JOIN LATERAL (SELECT to_jsonb(p) AS snapshot) cur
+	LEFT JOIN LATERAL (
+		SELECT r.revision, r.snapshot FROM patient_revisions r
+		WHERE r.patient_id = p.id
+		ORDER BY r.revision DESC
+		LIMIT 1
+	) prev ON true
+	WHERE p.id = ANY($1);
+	`
+	_, err := db.ExecContext(ctx, query, patientIDs, action, actor.UserID, actor.APIKeyID)
+	if err != nil {
+		return fmt.Errorf("error recording patient revisions: %w", err)
+	}
+	return nil
+}
+
+const patientRevisionColumns = `patient_id, revision, action, snapshot, changed_fields, changed_by, api_key_id, created_at`
+
+func scanPatientRevision(row rowScanner) (*models.PatientRevision, error) {
+	var (
+		revision      models.PatientRevision
+		snapshot      []byte
+		changedFields []byte
+		changedBy     sql.NullInt64
+		apiKeyID      sql.NullInt64
+	)
+	err := row.Scan(
+		&revision.PatientID,
+		&revision.Revision,
+		&revision.Action,
+		&snapshot,
+		&changedFields,
+		&changedBy,
+		&apiKeyID,
+		&revision.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(snapshot, &revision.Snapshot); err != nil {
+		return nil, fmt.Errorf("error decoding revision snapshot: %w", err)
+	}
+	if err := json.Unmarshal(changedFields, &revision.ChangedFields); err != nil {
+		return nil, fmt.Errorf("error decoding revision fields: %w", err)
+	}
+	if changedBy.Valid {
+		id := int(changedBy.Int64)
+		revision.ChangedBy = &id
+	}
+	if apiKeyID.Valid {
+		id := int(apiKeyID.Int64)
+		revision.APIKeyID = &id
+	}
+	return &revision, nil
+}
+
+// restrictRevision drops everything but fields from a revision. A nil
+// fields keeps the revision whole.
+func restrictRevision(revision *models.PatientRevision, fields []string) {
+	if fields == nil {
+		return
+	}
+	for key := range revision.Snapshot {
+		if !slices.Contains(fields, key) {
+			delete(revision.Snapshot, key)
+		}
+	}
+	revision.ChangedFields = slices.DeleteFunc(revision.ChangedFields, func(field string) bool {
+		return !slices.Contains(fields, field)
+	})
+}
+
+// ListPatientRevisions returns a patient's history, newest first, limited
+// to fields unless fields is nil. It returns ErrPatientNotFound when the
+// patient has no history, i.e. does not exist.
+func ListPatientRevisions(ctx context.Context, db *sql.DB, patientID int, fields []string) ([]models.PatientRevision, error) {
+	query := `
+	SELECT ` + patientRevisionColumns + `
+	FROM patient_revisions
+	WHERE patient_id = $1
+	ORDER BY revision DESC;
+	`
+	rows, err := db.QueryContext(ctx, query, patientID)
+	if err != nil {
+		return nil, fmt.Errorf("error querying patient revisions: %w", err)
+	}
+	defer rows.Close()
+
+	revisions := []models.PatientRevision{}
+	for rows.Next() {
+		revision, err := scanPatientRevision(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning patient revision: %w", err)
+		}
+		restrictRevision(revision, fields)
+		revisions = append(revisions, *revision)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+	if len(revisions) == 0 {
+		return nil, ErrPatientNotFound
+	}
+	return revisions, nil
+}
+
+// DiffPatientRevision compares a revision with the one before it, field by
+// field, limited to fields unless fields is nil. It returns
+// ErrRevisionNotFound when the patient has no such revision.
+func DiffPatientRevision(ctx context.Context, db *sql.DB, patientID int, revisionNumber int, fields []string) (*models.PatientRevisionDiff, error) {
+	query := `
+	SELECT ` + patientRevisionColumns + `
+	FROM patient_revisions
+	WHERE patient_id = $1 AND revision <= $2
+	ORDER BY revision DESC
+	LIMIT 2;
+	`
+	rows, err := db.QueryContext(ctx, query, patientID, revisionNumber)
+	if err != nil {
+		return nil, fmt.Errorf("error querying patient revisions: %w", err)
+	}
+	defer rows.Close()
+
+	var revisions []*models.PatientRevision
+	for rows.Next() {
+		revision, err := scanPatientRevision(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning patient revision: %w", err)
+		}
+		restrictRevision(revision, fields)
+		revisions = append(revisions, revision)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+	if len(revisions) == 0 || revisions[0].Revision != revisionNumber {
+		return nil, ErrRevisionNotFound
+	}
+
+	revision := revisions[0]
+	diff := &models.PatientRevisionDiff{
+		PatientID: revision.PatientID,
+		Revision:  revision.Revision,
+		Action:    revision.Action,
+		ChangedBy: revision.ChangedBy,
+		APIKeyID:  revision.APIKeyID,
+		CreatedAt: revision.CreatedAt,
+		Changes:   []models.PatientFieldChange{},
+	}
+	var previous map[string]any
+	if len(revisions) > 1 {
+		diff.PreviousRevision = revisions[1].Revision
+		previous = revisions[1].Snapshot
+	}
+	for _, field := range revision.ChangedFields {
+		diff.Changes = append(diff.Changes, models.PatientFieldChange{
+			Field: field,
+			From:  previous[field],
+			To:    revision.Snapshot[field],
+		})
+	}
+	return diff, nil
+}
@@ -0,0 +1,233 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Somvaded/assessment/models"
+)
+
+var ErrInvalidCursor = errors.New("invalid or expired cursor")
+
+const (
+	defaultPatientPageSize = 25
+	maxPatientPageSize     = 100
+)
+
+// patientSortColumns maps PatientSearch.Sort to the column and the
+// Postgres type its cursor value is cast to.
+var patientSortColumns = map[string]struct{ column, cast string }{
+	"name":       {"name", "text"},
+	"age":        {"age", "integer"},
+	"created_at": {"created_at", "timestamptz"},
+	"updated_at": {"updated_at", "timestamptz"},
+}
+
+// pageCursor is the position after the last row of a page: its sort value
+// and ID. Sort and Order are kept so a cursor cannot be replayed against a
+// different ordering.
+type pageCursor struct {
+	Sort  string `json:"s"`
+	Order string `json:"o"`
+	Value string `json:"v"`
+	ID    int    `json:"id"`
+}
+
+func encodeCursor(cursor pageCursor) string {
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(encoded string) (pageCursor, error) {
+	var cursor pageCursor
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return cursor, ErrInvalidCursor
+	}
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return cursor, ErrInvalidCursor
+	}
+	return cursor, nil
+}
+
+// escapeLike escapes the LIKE wildcards in s so user input matches
+// literally.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// SearchPatients returns one page of patients matching search, ordered by
+// search.Sort with the ID as tie-breaker, together with the total number of
+// matches. It returns ErrInvalidCursor for a malformed cursor or one issued
+// for another sort order.
+func SearchPatients(ctx context.Context, db *sql.DB, search models.PatientSearch) (*models.PatientPage, error) {
+	if search.Sort == "" {
+		search.Sort = "created_at"
+	}
+	if search.Order == "" {
+		search.Order = "desc"
+	}
+	sort, ok := patientSortColumns[search.Sort]
+	if !ok || (search.Order != "asc" && search.Order != "desc") {
+		return nil, fmt.Errorf("unsupported sort %q %q", search.Sort, search.Order)
+	}
+	if search.Limit <= 0 {
+		search.Limit = defaultPatientPageSize
+	}
+	if search.Limit > maxPatientPageSize {
+		search.Limit = maxPatientPageSize
+	}
+	var cursor *pageCursor
+	if search.Cursor != "" {
+		decoded, err := decodeCursor(search.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		if decoded.Sort != search.Sort || decoded.Order != search.Order {
+			return nil, ErrInvalidCursor
+		}
+		cursor = &decoded
+	}
+
+	var (
+		conditions = []string{"deleted_at IS NULL"}
+		args       []any
+	)
+	arg := func(value any) string {
+		args = append(args, value)
+		return "$" + strconv.Itoa(len(args))
+	}
+	if search.Name != "" {
+		conditions = append(conditions, "name ILIKE "+arg("%"+escapeLike(search.Name)+"%"))
+	}
+	if search.Phone != "" {
+		conditions = append(conditions, "phone LIKE "+arg("%"+escapeLike(search.Phone)+"%"))
+	}
+	if search.DoctorID != nil {
+		conditions = append(conditions, "doctor_id = "+arg(*search.DoctorID))
+	}
+	if search.Gender != "" {
+		conditions = append(conditions, "LOWER(gender) = LOWER("+arg(search.Gender)+")")
+	}
+	if search.MinAge != nil {
+		conditions = append(conditions, "age >= "+arg(*search.MinAge))
+	}
+	if search.MaxAge != nil {
+		conditions = append(conditions, "age <= "+arg(*search.MaxAge))
+	}
+	if search.CreatedFrom != nil {
+		conditions = append(conditions, "created_at >= "+arg(*search.CreatedFrom))
+	}
+	if search.CreatedTo != nil {
+		conditions = append(conditions, "created_at < "+arg(*search.CreatedTo))
+	}
+	where := "WHERE " + strings.Join(conditions, " AND ")
+
+	page := &models.PatientPage{Patients: []models.Patient{}, Limit: search.Limit}
+	err := db.QueryRowContext(ctx, `SELECT COUNT(*) FROM patients `+where+`;`, args...).Scan(&page.Total)
+	if err != nil {
+		return nil, fmt.Errorf("error counting patients: %w", err)
+	}
+
+	if cursor != nil {
+		comparison := ">"
+		if search.Order == "desc" {
+			comparison = "<"
+		}
+		where += fmt.Sprintf(" AND (%s, id) %s (%s::%s, %s)", sort.column, comparison, arg(cursor.Value), sort.cast, arg(cursor.ID))
+	}
+
+	query := `
+	SELECT ` + patientColumns + `
+	FROM patients
+	` + where + `
+	ORDER BY ` + sort.column + ` ` + search.Order + `, id ` + search.Order + `
+	LIMIT ` + arg(search.Limit+1) + `;
+	`
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error querying patients: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		patient, err := scanPatient(rows)
+		if err != nil {
+			return nil, err
+		}
+		page.Patients = append(page.Patients, *patient)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+
+	if len(page.Patients) > search.Limit {
+		page.Patients = page.Patients[:search.Limit]
+		last := page.Patients[len(page.Patients)-1]
+		page.NextCursor = encodeCursor(pageCursor{
+			Sort:  search.Sort,
+			Order: search.Order,
+			Value: patientSortValue(last, search.Sort),
+			ID:    last.ID,
+		})
+	}
+	return page, nil
+}
+
+// patientSortValue formats the sort column of patient for a cursor.
+func patientSortValue(patient models.Patient, sort string) string {
+	switch sort {
+	case "name":
+		return patient.Name
+	case "age":
+		return strconv.Itoa(patient.Age)
+	case "updated_at":
+		return patient.UpdatedAt.Format(time.RFC3339Nano)
+	default:
+		return patient.CreatedAt.Format(time.RFC3339Nano)
+	}
+}
+
+// patientColumns lists the patients columns in the order scanPatient reads
+// them.
+const patientColumns = `id, name, phone, age, dob, gender, emergency_contact, aadhar, doctor_id,
+	payment_info, known_allergies, medications, other_health_issues, doctor_notes, consent,
+	created_at, updated_at`
+
+func scanPatient(row rowScanner) (*models.Patient, error) {
+	var (
+		patient  models.Patient
+		doctorID sql.NullInt64
+	)
+	err := row.Scan(
+		&patient.ID,
+		&patient.Name,
+		&patient.Phone,
+		&patient.Age,
+		&patient.DOB,
+		&patient.Gender,
+		&patient.EmergencyContact,
+		&patient.Aadhar,
+		&doctorID,
+		&patient.PaymentInfo,
+		&patient.KnownAllergies,
+		&patient.Medications,
+		&patient.OtherHealthIssues,
+		&patient.DoctorNotes,
+		&patient.Consent,
+		&patient.CreatedAt,
+		&patient.UpdatedAt,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error scanning patient: %w", err)
+	}
+	patient.DoctorID = int(doctorID.Int64)
+	return &patient, nil
+}
@@ -0,0 +1,264 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Somvaded/assessment/models"
+)
+
+var (
+	ErrUnknownRole       = errors.New("unknown role")
+	ErrUnknownPermission = errors.New("unknown permission")
+	// ErrProtectedRole is returned when a change would leave no role able
+	// to manage roles, locking every admin out of this API.
+	ErrProtectedRole = errors.New("the admin role must keep the role:manage permission")
+)
+
+// FindUserRoles returns the roles held by a user, sorted by name.
+func FindUserRoles(ctx context.Context, db *sql.DB, userID int) ([]string, error) {
+	rows, err := db.QueryContext(ctx, `SELECT role FROM user_roles WHERE user_id = $1 ORDER BY role;`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error querying user roles: %w", err)
+	}
+	defer rows.Close()
+
+	roles := []string{}
+	for rows.Next() {
+		var role string
+		if err := rows.Scan(&role); err != nil {
+			return nil, fmt.Errorf("error scanning user role: %w", err)
+		}
+		roles = append(roles, role)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+	return roles, nil
+}
+
+// SetUserRoles replaces every role of a user. Access tokens carry the roles
+// they were issued with, so the user's sessions and refresh tokens are
+// revoked in the same transaction and a removed role stops working at once.
+func SetUserRoles(ctx context.Context, db *sql.DB, userID int, roles []string) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var exists bool
+	if err := tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM users WHERE id = $1);`, userID).Scan(&exists); err != nil {
+		return fmt.Errorf("error checking user: %w", err)
+	}
+	if !exists {
+		return ErrStaffNotFound
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM user_roles WHERE user_id = $1;`, userID); err != nil {
+		return fmt.Errorf("error clearing user roles: %w", err)
+	}
+	for _, role := range roles {
+		_, err := tx.ExecContext(ctx, `
+		INSERT INTO user_roles (user_id, role) VALUES ($1, $2)
+		ON CONFLICT DO NOTHING;
+		`, userID, role)
+		if err != nil {
+			if isForeignKeyViolation(err) {
+				return fmt.Errorf("%w: %s", ErrUnknownRole, role)
+			}
+			return fmt.Errorf("error assigning role: %w", err)
+		}
+	}
+
+	if err := revokeUserSessions(ctx, tx, userID); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %w", err)
+	}
+	return nil
+}
+
+// ListRoles returns every role with its permissions.
+func ListRoles(ctx context.Context, db *sql.DB) ([]models.Role, error) {
+	rows, err := db.QueryContext(ctx, `
+	SELECT r.name, r.description, rp.permission
+	FROM roles r
+	LEFT JOIN role_permissions rp ON rp.role = r.name
+	ORDER BY r.name, rp.permission;
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("error querying roles: %w", err)
+	}
+	defer rows.Close()
+
+	roles := []models.Role{}
+	for rows.Next() {
+		var (
+			name        string
+			description string
+			permission  sql.NullString
+		)
+		if err := rows.Scan(&name, &description, &permission); err != nil {
+			return nil, fmt.Errorf("error scanning role: %w", err)
+		}
+		if len(roles) == 0 || roles[len(roles)-1].Name != name {
+			roles = append(roles, models.Role{Name: name, Description: description, Permissions: []string{}})
+		}
+		if permission.Valid {
+			last := &roles[len(roles)-1]
+			last.Permissions = append(last.Permissions, permission.String)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+	return roles, nil
+}
+
+func ListPermissions(ctx context.Context, db *sql.DB) ([]models.Permission, error) {
+	rows, err := db.QueryContext(ctx, `SELECT name, description FROM permissions ORDER BY name;`)
+	if err != nil {
+		return nil, fmt.Errorf("error querying permissions: %w", err)
+	}
+	defer rows.Close()
+
+	permissions := []models.Permission{}
+	for rows.Next() {
+		var permission models.Permission
+		if err := rows.Scan(&permission.Name, &permission.Description); err != nil {
+			return nil, fmt.Errorf("error scanning permission: %w", err)
+		}
+		permissions = append(permissions, permission)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+	return permissions, nil
+}
+
+// SetRolePermissions creates role if needed and replaces its permissions.
+func SetRolePermissions(ctx context.Context, db *sql.DB, role string, description string, permissions []string) error {
+	if role == "admin" && !slices.Contains(permissions, models.PermRoleManage) {
+		return ErrProtectedRole
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `
+	INSERT INTO roles (name, description) VALUES ($1, $2)
+	ON CONFLICT (name) DO UPDATE SET description = CASE WHEN EXCLUDED.description = '' THEN roles.description ELSE EXCLUDED.description END;
+	`, role, description)
+	if err != nil {
+		return fmt.Errorf("error saving role: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM role_permissions WHERE role = $1;`, role); err != nil {
+		return fmt.Errorf("error clearing role permissions: %w", err)
+	}
+	for _, permission := range permissions {
+		_, err := tx.ExecContext(ctx, `
+		INSERT INTO role_permissions (role, permission) VALUES ($1, $2)
+		ON CONFLICT DO NOTHING;
+		`, role, permission)
+		if err != nil {
+			if isForeignKeyViolation(err) {
+				return fmt.Errorf("%w: %s", ErrUnknownPermission, permission)
+			}
+			return fmt.Errorf("error granting permission: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %w", err)
+	}
+	return nil
+}
+
+// PermissionResolver turns role names into permissions. The role to
+// permission table is small and read on every request, so it is cached for
+// TTL; Invalidate drops the cache after a change made by this instance.
+type PermissionResolver struct {
+	DB  *sql.DB
+	TTL time.Duration
+
+	mu       sync.Mutex
+	byRole   map[string][]string
+	loadedAt time.Time
+}
+
+func NewPermissionResolver(db *sql.DB, ttl time.Duration) *PermissionResolver {
+	return &PermissionResolver{
+		DB:  db,
+		TTL: ttl,
+	}
+}
+
+// Permissions returns the sorted union of the permissions of roles.
+func (r *PermissionResolver) Permissions(ctx context.Context, roles []string) ([]string, error) {
+	byRole, err := r.load(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := map[string]bool{}
+	permissions := []string{}
+	for _, role := range roles {
+		for _, permission := range byRole[role] {
+			if !seen[permission] {
+				seen[permission] = true
+				permissions = append(permissions, permission)
+			}
+		}
+	}
+	sort.Strings(permissions)
+	return permissions, nil
+}
+
+func (r *PermissionResolver) Invalidate() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.byRole = nil
+}
+
+func (r *PermissionResolver) load(ctx context.Context) (map[string][]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.byRole != nil && time.Since(r.loadedAt) < r.TTL {
+		return r.byRole, nil
+	}
+
+	rows, err := r.DB.QueryContext(ctx, `SELECT role, permission FROM role_permissions;`)
+	if err != nil {
+		return nil, fmt.Errorf("error loading role permissions: %w", err)
+	}
+	defer rows.Close()
+
+	byRole := map[string][]string{}
+	for rows.Next() {
+		var role, permission string
+		if err := rows.Scan(&role, &permission); err != nil {
+			return nil, fmt.Errorf("error scanning role permission: %w", err)
+		}
+		byRole[role] = append(byRole[role], permission)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+
+	r.byRole = byRole
+	r.loadedAt = time.Now()
+	return byRole, nil
+}
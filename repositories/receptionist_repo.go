@@ -3,7 +3,12 @@ package repositories
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"log"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 	"github.com/Somvaded/assessment/models"
 )
@@ -12,44 +17,27 @@ import (
 
 
 
+// FindPatients returns the patient with the given Aadhar number, ignoring
+// deleted patients.
 func FindPatients(ctx context.Context,DB *sql.DB, aadharid string) (*models.Patient,error){
-	var patient models.Patient
-
 	query := `
-	SELECT * from patients
-	where aadhar=$1;
+	SELECT ` + patientColumns + `
+	FROM patients
+	WHERE aadhar = $1 AND deleted_at IS NULL;
 	`
-	err := DB.QueryRowContext(ctx,query,aadharid).Scan(
-		&patient.ID,
-		&patient.Name,
-		&patient.Phone,
-		&patient.Age,
-		&patient.DOB,
-		&patient.Gender,
-		&patient.EmergencyContact,
-		&patient.Aadhar,
-		&patient.DoctorID,
-		&patient.PaymentInfo,
-		&patient.KnownAllergies,
-		&patient.Medications,
-		&patient.OtherHealthIssues,
-		&patient.DoctorNotes,
-		&patient.Consent,
-		&patient.CreatedAt,
-		&patient.UpdatedAt,
-	)
-
+	patient, err := scanPatient(DB.QueryRowContext(ctx,query,aadharid))
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return nil ,fmt.Errorf("no patient found")
-		}else {
-			return nil , fmt.Errorf(err.Error())
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrPatientNotFound
 		}
+		return nil, err
 	}
-	return &patient,nil
+	return patient,nil
 }
 
-func InsertPatient(ctx context.Context,db *sql.DB, patient models.Patient)(int, error) {
+// InsertPatient adds a patient and records the first revision of its
+// history in the same transaction.
+func InsertPatient(ctx context.Context,db *sql.DB, patient models.Patient, actor models.PatientActor)(int, error) {
 	parsedDob, err := time.Parse("2006-01-02", patient.DOB.Format("2006-01-02"))
     if err != nil {
         return 0, fmt.Errorf("error parsing date: %w", err)
@@ -67,8 +55,14 @@ func InsertPatient(ctx context.Context,db *sql.DB, patient models.Patient)(int,
 	)
 	RETURNING id;`
 
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
 	var id int
-	err = db.QueryRowContext(
+	err = tx.QueryRowContext(
 		ctx,
 		query,
 		patient.Name,
@@ -89,10 +83,19 @@ func InsertPatient(ctx context.Context,db *sql.DB, patient models.Patient)(int,
 	if err != nil {
 		return 0,fmt.Errorf("query error %w",err)
 	}
+	if err := recordPatientRevision(ctx, tx, id, models.PatientRevisionCreate, actor); err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("error committing transaction: %w", err)
+	}
 	return id,nil
 }
 
-func UpdatePatient(ctx context.Context,db *sql.DB, patient models.Patient) (*models.Patient, error) {
+// UpdatePatient overwrites a patient and records the change in its history
+// in the same transaction. It returns ErrPatientNotFound when the patient
+// does not exist or is deleted.
+func UpdatePatient(ctx context.Context,db *sql.DB, patient models.Patient, actor models.PatientActor) (*models.Patient, error) {
 	// Parse the date of birth
     parsedDob, err := time.Parse("2006-01-02", patient.DOB.Format("2006-01-02"))
     if err != nil {
@@ -106,10 +109,16 @@ func UpdatePatient(ctx context.Context,db *sql.DB, patient models.Patient) (*mod
         emergency_contact = $6,aadhar = $7, doctor_id = $8, payment_info = $9,
         known_allergies = $10, medications = $11, other_health_issues = $12,
         doctor_notes = $13, consent = $14, updated_at = NOW()
-    WHERE id = $15;
+    WHERE id = $15 AND deleted_at IS NULL;
     `
 
-    row,err := db.ExecContext(
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+    row,err := tx.ExecContext(
 		ctx,
         query,
         patient.Name,
@@ -136,8 +145,11 @@ func UpdatePatient(ctx context.Context,db *sql.DB, patient models.Patient) (*mod
         return nil, fmt.Errorf("error checking rows affected: %w", err)
     }
     if rowsAffected == 0 {
-        return nil, fmt.Errorf("no patient found with ID %d", patient.ID)
+        return nil, ErrPatientNotFound
     }
+	if err := recordPatientRevision(ctx, tx, patient.ID, models.PatientRevisionUpdate, actor); err != nil {
+		return nil, err
+	}
 
 	 selectQuery := `
 	 SELECT 
@@ -145,11 +157,11 @@ func UpdatePatient(ctx context.Context,db *sql.DB, patient models.Patient) (*mod
 		 payment_info, known_allergies, medications, other_health_issues,
 		 doctor_notes, consent, created_at, updated_at
 	 FROM patients
-	 WHERE id = $1;
+	 WHERE id = $1 AND deleted_at IS NULL;
 	 `
  
 	 var updatedPatient models.Patient
-	 err = db.QueryRowContext(ctx, selectQuery, patient.ID).Scan(
+	 err = tx.QueryRowContext(ctx, selectQuery, patient.ID).Scan(
 		 &updatedPatient.ID,
 		 &updatedPatient.Name,
 		 &updatedPatient.Phone,
@@ -171,16 +183,114 @@ func UpdatePatient(ctx context.Context,db *sql.DB, patient models.Patient) (*mod
 	 if err != nil {
 		 return nil, fmt.Errorf("fetch updated patient error: %w", err)
 	 }
+	 if err := tx.Commit(); err != nil {
+		 return nil, fmt.Errorf("error committing transaction: %w", err)
+	 }
  
 	 return &updatedPatient, nil
 
 }
 
-func DeletePatient(ctx context.Context,db *sql.DB, patientid int) (error) {
+var (
+	ErrPatientDoctorInvalid = errors.New("doctor does not exist")
+	ErrAadharTaken          = errors.New("a patient with this Aadhar number already exists")
+)
+
+// PatientPatchColumns are the columns PatchPatient may change, and so the
+// fields a merge patch of a patient may set.
+var PatientPatchColumns = []string{
+	"name", "phone", "age", "dob", "gender", "emergency_contact", "aadhar", "doctor_id",
+	"payment_info", "known_allergies", "medications", "other_health_issues", "doctor_notes", "consent",
+}
+
+// PatchPatient sets only the given columns of a patient, keyed by column
+// name, and records the change in its history in the same transaction. A
+// nil doctor_id unassigns the patient. An empty changes leaves the patient
+// untouched and returns it as it is. It returns ErrPatientNotFound,
+// ErrPatientDoctorInvalid or ErrAadharTaken.
+func PatchPatient(ctx context.Context, db *sql.DB, patientID int, changes map[string]any, actor models.PatientActor) (*models.Patient, error) {
+	columns := make([]string, 0, len(changes))
+	for column := range changes {
+		if !slices.Contains(PatientPatchColumns, column) {
+			return nil, fmt.Errorf("patient field %q cannot be patched", column)
+		}
+		columns = append(columns, column)
+	}
+	slices.Sort(columns)
+
+	if len(columns) == 0 {
+		query := `
+		SELECT ` + patientColumns + `
+		FROM patients
+		WHERE id = $1 AND deleted_at IS NULL;
+		`
+		patient, err := scanPatient(db.QueryRowContext(ctx, query, patientID))
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return nil, ErrPatientNotFound
+			}
+			return nil, err
+		}
+		return patient, nil
+	}
+
+	args := []any{patientID}
+	assignments := make([]string, 0, len(columns)+1)
+	for _, column := range columns {
+		args = append(args, changes[column])
+		assignments = append(assignments, column+" = $"+strconv.Itoa(len(args)))
+	}
+	assignments = append(assignments, "updated_at = NOW()")
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := `
+	UPDATE patients SET ` + strings.Join(assignments, ", ") + `
+	WHERE id = $1 AND deleted_at IS NULL
+	RETURNING ` + patientColumns + `;
+	`
+	patient, err := scanPatient(tx.QueryRowContext(ctx, query, args...))
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrPatientNotFound
+		case isForeignKeyViolation(err):
+			return nil, ErrPatientDoctorInvalid
+		case isUniqueViolation(err):
+			return nil, ErrAadharTaken
+		}
+		return nil, fmt.Errorf("error patching patient: %w", err)
+	}
+	if err := recordPatientRevision(ctx, tx, patientID, models.PatientRevisionUpdate, actor); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("error committing transaction: %w", err)
+	}
+	return patient, nil
+}
+
+// DeletePatient soft-deletes a patient: the row is hidden from every read
+// but kept, with who deleted it and when, until PurgeDeletedPatients removes
+// it after the retention period. deleted_by is only set when actor is a
+// user. It returns ErrPatientNotFound when there is no such patient or it is
+// already deleted.
+func DeletePatient(ctx context.Context,db *sql.DB, patientid int, actor models.PatientActor) (error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
 	query := `
-	DELETE FROM patients WHERE id = $1;
+	UPDATE patients SET deleted_at = NOW(), deleted_by = $2
+	WHERE id = $1 AND deleted_at IS NULL;
 	`
-	result, err := db.ExecContext(ctx, query, patientid)
+	result, err := tx.ExecContext(ctx, query, patientid, actor.UserID)
 	if err != nil {
 		return fmt.Errorf("query error: %w", err)
 	}
@@ -190,7 +300,102 @@ func DeletePatient(ctx context.Context,db *sql.DB, patientid int) (error) {
 	}
 
 	if rowsAffected == 0 {
-		return fmt.Errorf("no patient found with id %d", patientid)
+		return ErrPatientNotFound
+	}
+	if err := recordPatientRevision(ctx, tx, patientid, models.PatientRevisionDelete, actor); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %w", err)
 	}
 	return nil
 }
+
+// RestorePatient undoes DeletePatient. A patient whose doctor is no longer
+// active comes back unassigned. It returns ErrPatientNotFound when the
+// patient is not deleted or has already been purged.
+func RestorePatient(ctx context.Context, db *sql.DB, patientID int, actor models.PatientActor) (*models.Patient, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := `
+	UPDATE patients p SET deleted_at = NULL, deleted_by = NULL, updated_at = NOW(),
+		doctor_id = CASE WHEN EXISTS (
+			SELECT 1 FROM users u WHERE u.id = p.doctor_id AND u.status = $2
+		) THEN p.doctor_id END
+	WHERE id = $1 AND deleted_at IS NOT NULL
+	RETURNING ` + patientColumns + `;
+	`
+	patient, err := scanPatient(tx.QueryRowContext(ctx, query, patientID, models.StatusActive))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrPatientNotFound
+		}
+		return nil, err
+	}
+	if err := recordPatientRevision(ctx, tx, patientID, models.PatientRevisionRestore, actor); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("error committing transaction: %w", err)
+	}
+	return patient, nil
+}
+
+// PurgeDeletedPatients permanently removes patients deleted more than
+// retention ago and returns how many were removed. The history of each one
+// is kept and closed with a purge revision holding its final state, written
+// by the same statement that removes it.
+func PurgeDeletedPatients(ctx context.Context, db *sql.DB, retention time.Duration) (int64, error) {
+	result, err := db.ExecContext(ctx, `
+	WITH purged AS (
+		DELETE FROM patients p
+		WHERE p.deleted_at IS NOT NULL AND p.deleted_at < NOW() - make_interval(secs => $1)
+		RETURNING p.id, to_jsonb(p) AS snapshot
+	)
+	INSERT INTO patient_revisions (patient_id, revision, action, snapshot, changed_fields)
+	SELECT purged.id,
+		COALESCE((SELECT MAX(r.revision) FROM patient_revisions r WHERE r.patient_id = purged.id), 0) + 1,
+		$2, purged.snapshot, '[]'
+	FROM purged;
+	`, retention.Seconds(), models.PatientRevisionPurge)
+	if err != nil {
+		return 0, fmt.Errorf("error purging deleted patients: %w", err)
+	}
+	purged, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("error getting rows affected: %w", err)
+	}
+	return purged, nil
+}
+
+// StartPatientPurge runs PurgeDeletedPatients every interval until ctx is
+// cancelled. A retention or interval of zero disables purging.
+func StartPatientPurge(ctx context.Context, db *sql.DB, retention time.Duration, interval time.Duration) {
+	if retention <= 0 || interval <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				purgeCtx, cancel := context.WithTimeout(ctx, time.Minute)
+				purged, err := PurgeDeletedPatients(purgeCtx, db, retention)
+				cancel()
+				if err != nil {
+					log.Println("Error purging deleted patients:", err)
+				} else if purged > 0 {
+					log.Printf("Purged %d patients deleted more than %s ago", purged, retention)
+				}
+			}
+		}
+	}()
+}
@@ -3,7 +3,9 @@ package repositories_test
 import (
 	"context"
 	"database/sql"
+	"database/sql/driver"
 	"regexp"
+	"strings"
 
 	"testing"
 	"time"
@@ -12,23 +14,29 @@ import (
 	"github.com/Somvaded/assessment/models"
 	"github.com/Somvaded/assessment/repositories"
 	"github.com/Somvaded/assessment/utils"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/stretchr/testify/assert"
 )
 
+// patientRows returns an empty result with the columns of patientColumns.
+func patientRows() *sqlmock.Rows {
+	return sqlmock.NewRows([]string{
+		"id", "name", "phone", "age", "dob", "gender", "emergency_contact", "aadhar",
+		"doctor_id", "payment_info", "known_allergies", "medications", "other_health_issues",
+		"doctor_notes", "consent", "created_at", "updated_at",
+	})
+}
+
 func TestFindPatients_Success(t *testing.T) {
     db, mock, _ := sqlmock.New()
     defer db.Close()
 
     ctx := context.Background()
     aadharID := "1234-5678-9012"
-    rows := sqlmock.NewRows([]string{
-        "id", "name", "phone", "age", "dob", "gender", "emergency_contact", "aadhar",
-        "doctor_id", "payment_info", "known_allergies", "medications", "other_health_issues",
-        "doctor_notes", "consent", "created_at", "updated_at",
-    }).AddRow(1, "John Doe", "9876543210", 30, time.Now(), "male", "1234567890", aadharID,
+    rows := patientRows().AddRow(1, "John Doe", "9876543210", 30, time.Now(), "male", "1234567890", aadharID,
         1, "Paid", "None", "Paracetamol", "None", "Healthy", true, time.Now(), time.Now())
 
-    mock.ExpectQuery("SELECT \\* from patients where aadhar=\\$1;").WithArgs(aadharID).WillReturnRows(rows)
+    mock.ExpectQuery("FROM patients WHERE aadhar = \\$1 AND deleted_at IS NULL").WithArgs(aadharID).WillReturnRows(rows)
 
     patient, err := repositories.FindPatients(ctx, db, aadharID)
     assert.NoError(t, err)
@@ -40,7 +48,7 @@ func TestFindPatients_NotFound(t *testing.T) {
     defer db.Close()
 
     ctx := context.Background()
-    mock.ExpectQuery("SELECT \\* from patients where aadhar=\\$1;").WillReturnError(sql.ErrNoRows)
+    mock.ExpectQuery("FROM patients WHERE aadhar = \\$1 AND deleted_at IS NULL").WillReturnError(sql.ErrNoRows)
 
     patient, err := repositories.FindPatients(ctx, db, "not-found")
     assert.Error(t, err)
@@ -59,11 +67,18 @@ func TestInsertPatient(t *testing.T) {
         OtherHealthIssues: "None", DoctorNotes: "Healthy", Consent: true,
     }
 
+    receptionistID := 4
+    mock.ExpectBegin()
     mock.ExpectQuery("INSERT INTO patients").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+    mock.ExpectExec("INSERT INTO patient_revisions").
+        WithArgs(1, models.PatientRevisionCreate, &receptionistID, nil).
+        WillReturnResult(sqlmock.NewResult(1, 1))
+    mock.ExpectCommit()
 
-    id, err := repositories.InsertPatient(ctx, db, patient)
+    id, err := repositories.InsertPatient(ctx, db, patient, models.PatientActor{UserID: &receptionistID})
     assert.NoError(t, err)
     assert.Equal(t, 1, id)
+    assert.NoError(t, mock.ExpectationsWereMet())
 }
 
 func TestUpdatePatient_Success(t *testing.T) {
@@ -78,21 +93,106 @@ func TestUpdatePatient_Success(t *testing.T) {
         OtherHealthIssues: "None", DoctorNotes: "Healthy", Consent: true,
     }
 
+    apiKeyID := 3
+    mock.ExpectBegin()
     mock.ExpectExec("UPDATE patients SET").WillReturnResult(sqlmock.NewResult(0, 1))
+    mock.ExpectExec("INSERT INTO patient_revisions").
+        WithArgs(1, models.PatientRevisionUpdate, nil, &apiKeyID).
+        WillReturnResult(sqlmock.NewResult(1, 1))
     mock.ExpectQuery("SELECT id, name, phone, age, dob, gender, emergency_contact").
         WithArgs(patient.ID).
-        WillReturnRows(sqlmock.NewRows([]string{
-            "id", "name", "phone", "age", "dob", "gender", "emergency_contact", "aadhar",
-            "doctor_id", "payment_info", "known_allergies", "medications", "other_health_issues",
-            "doctor_notes", "consent", "created_at", "updated_at",
-        }).AddRow(
+        WillReturnRows(patientRows().AddRow(
             1, "John Doe", "9876543210", 30, time.Now(), "male", "1234567890", "1234-5678-9012",
             1, "Paid", "None", "Paracetamol", "None", "Healthy", true, time.Now(), time.Now(),
         ))
 
-    updatedPatient, err := repositories.UpdatePatient(ctx, db, patient)
+    mock.ExpectCommit()
+
+    updatedPatient, err := repositories.UpdatePatient(ctx, db, patient, models.PatientActor{APIKeyID: &apiKeyID})
     assert.NoError(t, err)
     assert.NotNil(t, updatedPatient)
+    assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUpdatePatient_Deleted(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE patients SET(.|\\n)*WHERE id = \\$15 AND deleted_at IS NULL").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+
+	_, err = repositories.UpdatePatient(context.Background(), db, models.Patient{ID: 2, DOB: time.Now()}, models.PatientActor{})
+	assert.ErrorIs(t, err, repositories.ErrPatientNotFound)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPatchPatient_UpdatesOnlyGivenColumns(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	receptionistID := 4
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`UPDATE patients SET doctor_id = $2, phone = $3, updated_at = NOW() WHERE id = $1 AND deleted_at IS NULL RETURNING id, name`)).
+		WithArgs(1, nil, "9000000000").
+		WillReturnRows(patientRows().AddRow(1, "John Doe", "9000000000", 30, time.Now(), "male", "1234567890", "1234-5678-9012",
+			nil, "Paid", "None", "Paracetamol", "None", "Healthy", true, time.Now(), time.Now()))
+	mock.ExpectExec("INSERT INTO patient_revisions").
+		WithArgs(1, models.PatientRevisionUpdate, &receptionistID, nil).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	patient, err := repositories.PatchPatient(context.Background(), db, 1, map[string]any{
+		"phone":     "9000000000",
+		"doctor_id": nil,
+	}, models.PatientActor{UserID: &receptionistID})
+	assert.NoError(t, err)
+	assert.Equal(t, "9000000000", patient.Phone)
+	assert.Equal(t, 0, patient.DoctorID)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPatchPatient_EmptyPatchReadsPatient(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectQuery("FROM patients WHERE id = \\$1 AND deleted_at IS NULL").
+		WithArgs(99).
+		WillReturnError(sql.ErrNoRows)
+
+	_, err = repositories.PatchPatient(context.Background(), db, 99, map[string]any{}, models.PatientActor{})
+	assert.ErrorIs(t, err, repositories.ErrPatientNotFound)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPatchPatient_Errors(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	_, err = repositories.PatchPatient(context.Background(), db, 1, map[string]any{"created_at; DROP TABLE patients": 1}, models.PatientActor{})
+	assert.Error(t, err)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("UPDATE patients SET doctor_id = \\$2").
+		WithArgs(1, 42).
+		WillReturnError(&pgconn.PgError{Code: "23503"})
+	mock.ExpectRollback()
+	_, err = repositories.PatchPatient(context.Background(), db, 1, map[string]any{"doctor_id": 42}, models.PatientActor{})
+	assert.ErrorIs(t, err, repositories.ErrPatientDoctorInvalid)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("UPDATE patients SET name = \\$2").
+		WithArgs(2, "Jane").
+		WillReturnError(sql.ErrNoRows)
+	mock.ExpectRollback()
+	_, err = repositories.PatchPatient(context.Background(), db, 2, map[string]any{"name": "Jane"}, models.PatientActor{})
+	assert.ErrorIs(t, err, repositories.ErrPatientNotFound)
+	assert.NoError(t, mock.ExpectationsWereMet())
 }
 
 func TestDeletePatient_Success(t *testing.T) {
@@ -101,11 +201,18 @@ func TestDeletePatient_Success(t *testing.T) {
 
     ctx := context.Background()
     patientID := 1
-    mock.ExpectExec("DELETE FROM patients WHERE id = \\$1").
-        WithArgs(patientID).WillReturnResult(sqlmock.NewResult(0, 1))
+    receptionistID := 4
+    mock.ExpectBegin()
+    mock.ExpectExec("UPDATE patients SET deleted_at = NOW\\(\\), deleted_by = \\$2 WHERE id = \\$1 AND deleted_at IS NULL").
+        WithArgs(patientID, &receptionistID).WillReturnResult(sqlmock.NewResult(0, 1))
+    mock.ExpectExec("INSERT INTO patient_revisions").
+        WithArgs(patientID, models.PatientRevisionDelete, &receptionistID, nil).
+        WillReturnResult(sqlmock.NewResult(1, 1))
+    mock.ExpectCommit()
 
-    err := repositories.DeletePatient(ctx, db, patientID)
+    err := repositories.DeletePatient(ctx, db, patientID, models.PatientActor{UserID: &receptionistID})
     assert.NoError(t, err)
+    assert.NoError(t, mock.ExpectationsWereMet())
 }
 
 func TestDeletePatient_NotFound(t *testing.T) {
@@ -114,11 +221,157 @@ func TestDeletePatient_NotFound(t *testing.T) {
 
     ctx := context.Background()
     patientID := 999
-    mock.ExpectExec("DELETE FROM patients WHERE id = \\$1").
-        WithArgs(patientID).WillReturnResult(sqlmock.NewResult(0, 0))
+    mock.ExpectBegin()
+    mock.ExpectExec("UPDATE patients SET deleted_at = NOW\\(\\)").
+        WithArgs(patientID, nil).WillReturnResult(sqlmock.NewResult(0, 0))
+    mock.ExpectRollback()
 
-    err := repositories.DeletePatient(ctx, db, patientID)
-    assert.Error(t, err)
+    err := repositories.DeletePatient(ctx, db, patientID, models.PatientActor{})
+    assert.ErrorIs(t, err, repositories.ErrPatientNotFound)
+}
+
+func TestRestorePatient(t *testing.T) {
+    db, mock, _ := sqlmock.New()
+    defer db.Close()
+
+    ctx := context.Background()
+    rows := patientRows().AddRow(1, "John Doe", "9876543210", 30, time.Now(), "male", "1234567890", "1234-5678-9012",
+        nil, "Paid", "None", "Paracetamol", "None", "Healthy", true, time.Now(), time.Now())
+    receptionistID := 4
+    actor := models.PatientActor{UserID: &receptionistID}
+    mock.ExpectBegin()
+    mock.ExpectQuery("UPDATE patients p SET deleted_at = NULL, deleted_by = NULL(.|\\n)*WHERE id = \\$1 AND deleted_at IS NOT NULL").
+        WithArgs(1, models.StatusActive).WillReturnRows(rows)
+    mock.ExpectExec("INSERT INTO patient_revisions").
+        WithArgs(1, models.PatientRevisionRestore, &receptionistID, nil).
+        WillReturnResult(sqlmock.NewResult(1, 1))
+    mock.ExpectCommit()
+
+    patient, err := repositories.RestorePatient(ctx, db, 1, actor)
+    assert.NoError(t, err)
+    assert.Equal(t, "John Doe", patient.Name)
+
+    mock.ExpectBegin()
+    mock.ExpectQuery("UPDATE patients p SET deleted_at = NULL").WithArgs(2, models.StatusActive).WillReturnError(sql.ErrNoRows)
+    mock.ExpectRollback()
+    _, err = repositories.RestorePatient(ctx, db, 2, actor)
+    assert.ErrorIs(t, err, repositories.ErrPatientNotFound)
+    assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRestorePatient_InactiveDoctorUnassigned(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	receptionistID := 4
+	mock.ExpectBegin()
+	mock.ExpectQuery("doctor_id = CASE WHEN EXISTS \\( SELECT 1 FROM users u WHERE u.id = p.doctor_id AND u.status = \\$2 \\) THEN p.doctor_id END").
+		WithArgs(1, models.StatusActive).
+		WillReturnRows(patientRows().AddRow(1, "John Doe", "9876543210", 30, time.Now(), "male", "1234567890", "1234-5678-9012",
+			nil, "Paid", "None", "Paracetamol", "None", "Healthy", true, time.Now(), time.Now()))
+	mock.ExpectExec("INSERT INTO patient_revisions").
+		WithArgs(1, models.PatientRevisionRestore, &receptionistID, nil).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	patient, err := repositories.RestorePatient(context.Background(), db, 1, models.PatientActor{UserID: &receptionistID})
+	assert.NoError(t, err)
+	assert.Equal(t, 0, patient.DoctorID)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPurgeDeletedPatients(t *testing.T) {
+    db, mock, _ := sqlmock.New()
+    defer db.Close()
+
+    mock.ExpectExec("DELETE FROM patients p(.|\\n)*deleted_at < NOW\\(\\) - make_interval\\(secs => \\$1\\)(.|\\n)*INSERT INTO patient_revisions").
+        WithArgs(float64(86400), models.PatientRevisionPurge).WillReturnResult(sqlmock.NewResult(0, 3))
+
+    purged, err := repositories.PurgeDeletedPatients(context.Background(), db, 24*time.Hour)
+    assert.NoError(t, err)
+    assert.Equal(t, int64(3), purged)
+    assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDeletePatient_RecordsRevision(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	// The revision is numbered after, and diffed against, the latest one.
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE patients SET deleted_at = NOW\\(\\)").
+		WithArgs(1, nil).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("WITH cur AS \\(\\s*SELECT to_jsonb\\(p\\) AS snapshot FROM patients p WHERE p.id = \\$1(.|\\n)*ORDER BY revision DESC(.|\\n)*COALESCE\\(\\(SELECT revision FROM prev\\), 0\\) \\+ 1(.|\\n)*f.key <> 'updated_at'").
+		WithArgs(1, models.PatientRevisionDelete, nil, nil).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	assert.NoError(t, repositories.DeletePatient(context.Background(), db, 1, models.PatientActor{}))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func patientRevisionRows() *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"patient_id", "revision", "action", "snapshot", "changed_fields", "changed_by", "api_key_id", "created_at"})
+}
+
+func TestListPatientRevisions(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	now := time.Now()
+	mock.ExpectQuery("FROM patient_revisions WHERE patient_id = \\$1 ORDER BY revision DESC").
+		WithArgs(1).
+		WillReturnRows(patientRevisionRows().
+			AddRow(1, 2, "update", []byte(`{"id": 1, "name": "John Doe", "aadhar": "1234", "known_allergies": "Dust"}`), []byte(`["aadhar", "known_allergies"]`), 7, nil, now).
+			AddRow(1, 1, "create", []byte(`{"id": 1, "name": "John Doe", "aadhar": "9999", "known_allergies": "None"}`), []byte(`["aadhar", "id", "known_allergies", "name"]`), 4, nil, now))
+
+	revisions, err := repositories.ListPatientRevisions(context.Background(), db, 1, repositories.DoctorPatientFields)
+	assert.NoError(t, err)
+	assert.Len(t, revisions, 2)
+	assert.Equal(t, 2, revisions[0].Revision)
+	assert.Equal(t, 7, *revisions[0].ChangedBy)
+	assert.Nil(t, revisions[0].APIKeyID)
+	assert.Equal(t, []string{"known_allergies"}, revisions[0].ChangedFields)
+	assert.NotContains(t, revisions[0].Snapshot, "aadhar")
+	assert.Equal(t, "Dust", revisions[0].Snapshot["known_allergies"])
+
+	mock.ExpectQuery("FROM patient_revisions").WithArgs(99).WillReturnRows(patientRevisionRows())
+	_, err = repositories.ListPatientRevisions(context.Background(), db, 99, nil)
+	assert.ErrorIs(t, err, repositories.ErrPatientNotFound)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDiffPatientRevision(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	now := time.Now()
+	mock.ExpectQuery("FROM patient_revisions WHERE patient_id = \\$1 AND revision <= \\$2 ORDER BY revision DESC LIMIT 2").
+		WithArgs(1, 3).
+		WillReturnRows(patientRevisionRows().
+			AddRow(1, 3, "update", []byte(`{"medications": "Ibuprofen", "known_allergies": "Dust"}`), []byte(`["known_allergies", "medications"]`), nil, 2, now).
+			AddRow(1, 2, "update", []byte(`{"medications": "Paracetamol", "known_allergies": null}`), []byte(`["medications"]`), 7, nil, now))
+
+	diff, err := repositories.DiffPatientRevision(context.Background(), db, 1, 3, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, diff.PreviousRevision)
+	assert.Equal(t, 2, *diff.APIKeyID)
+	assert.Equal(t, []models.PatientFieldChange{
+		{Field: "known_allergies", From: nil, To: "Dust"},
+		{Field: "medications", From: "Paracetamol", To: "Ibuprofen"},
+	}, diff.Changes)
+
+	mock.ExpectQuery("FROM patient_revisions").
+		WithArgs(1, 5).
+		WillReturnRows(patientRevisionRows().
+			AddRow(1, 3, "update", []byte(`{}`), []byte(`[]`), nil, nil, now))
+	_, err = repositories.DiffPatientRevision(context.Background(), db, 1, 5, nil)
+	assert.ErrorIs(t, err, repositories.ErrRevisionNotFound)
+	assert.NoError(t, mock.ExpectationsWereMet())
 }
 
 
@@ -128,29 +381,78 @@ func TestFindPatientsByDoctorID(t *testing.T) {
     defer db.Close()
 
     ctx := context.Background()
+    expiresAt := time.Now().Add(24 * time.Hour)
 
     rows := sqlmock.NewRows([]string{
         "id", "name", "phone", "age", "gender", "emergency_contact",
         "known_allergies", "medications", "other_health_issues", 
         "doctor_notes", "consent", "created_at", "updated_at",
+        "delegated", "access", "expires_at",
     }).AddRow(
         1, "John Doe", "1234567890", 30, "Male", "9876543210",
         "Peanuts", "Aspirin", "Asthma", "Note 1", true, time.Now(), time.Now(),
+        false, nil, nil,
+    ).AddRow(
+        2, "Jane Roe", "1234567891", 41, "Female", "9876543211",
+        "", "", "", "", true, time.Now(), time.Now(),
+        true, "read", expiresAt,
     )
 
-    mock.ExpectQuery(regexp.QuoteMeta(`
-        SELECT id , name , phone , age,gender, emergency_contact,
-        known_allergies, medications, other_health_issues, 
-        doctor_notes,consent, created_at, updated_at FROM patients
-        WHERE doctor_id = $1;
-    `)).
-        WithArgs(1).
+    mock.ExpectQuery("FROM patients p LEFT JOIN LATERAL \\( SELECT access, expires_at FROM patient_delegations").
+        WithArgs(1, 26).
         WillReturnRows(rows)
 
-    patients, err := repositories.FindPatientsByDoctorID(ctx, db, 1)
+    page, err := repositories.FindPatientsByDoctorID(ctx, db, 1, models.DocPatientQuery{})
     assert.NoError(t, err)
-    assert.Len(t, patients, 1)
+    assert.Empty(t, page.NextCursor)
+    patients := page.Patients
+    assert.Len(t, patients, 2)
     assert.Equal(t, "John Doe", patients[0].Name)
+    assert.False(t, patients[0].Delegated)
+    assert.Nil(t, patients[0].DelegationExpiresAt)
+    assert.True(t, patients[1].Delegated)
+    assert.Equal(t, models.DelegationRead, patients[1].DelegationAccess)
+    assert.Equal(t, expiresAt, *patients[1].DelegationExpiresAt)
+}
+
+func TestFindPatientsByDoctorID_Pages(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	columns := []string{
+		"id", "name", "phone", "age", "gender", "emergency_contact",
+		"known_allergies", "medications", "other_health_issues",
+		"doctor_notes", "consent", "created_at", "updated_at",
+		"delegated", "access", "expires_at",
+	}
+	since := time.Date(2026, 5, 1, 0, 0, 0, 0, time.UTC)
+	newest := since.Add(3 * time.Hour)
+	rows := sqlmock.NewRows(columns).
+		AddRow(8, "Ravi", "", 40, "male", "", "", "", "", "", true, since, newest, false, nil, nil).
+		AddRow(3, "Ravina", "", 35, "female", "", "", "", "", "", true, since, newest, false, nil, nil)
+	mock.ExpectQuery("WHERE p.deleted_at IS NULL AND \\(p.doctor_id = \\$1 OR pd.access IS NOT NULL\\) AND p.name ILIKE \\$2 AND p.updated_at > \\$3 ORDER BY p.updated_at DESC, p.id DESC LIMIT \\$4").
+		WithArgs(1, "%ravi%", since, 2).
+		WillReturnRows(rows)
+
+	page, err := repositories.FindPatientsByDoctorID(context.Background(), db, 1, models.DocPatientQuery{Name: "ravi", Since: &since, Limit: 1})
+	assert.NoError(t, err)
+	assert.Len(t, page.Patients, 1)
+	assert.NotEmpty(t, page.NextCursor)
+
+	mock.ExpectQuery("AND \\(p.updated_at, p.id\\) < \\(\\$2::timestamptz, \\$3\\) ORDER BY p.updated_at DESC, p.id DESC LIMIT \\$4").
+		WithArgs(1, newest.Format(time.RFC3339Nano), 8, 2).
+		WillReturnRows(sqlmock.NewRows(columns).
+			AddRow(3, "Ravina", "", 35, "female", "", "", "", "", "", true, since, newest, false, nil, nil))
+
+	page, err = repositories.FindPatientsByDoctorID(context.Background(), db, 1, models.DocPatientQuery{Limit: 1, Cursor: page.NextCursor})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, page.Patients[0].ID)
+	assert.Empty(t, page.NextCursor)
+
+	_, err = repositories.FindPatientsByDoctorID(context.Background(), db, 1, models.DocPatientQuery{Cursor: "bogus"})
+	assert.ErrorIs(t, err, repositories.ErrInvalidCursor)
+	assert.NoError(t, mock.ExpectationsWereMet())
 }
 
 func TestUpdateMedicalInfo(t *testing.T) {
@@ -177,19 +479,33 @@ func TestUpdateMedicalInfo(t *testing.T) {
         "Dust", "Paracetamol", "None", "Stable condition", true, now, now,
     )
 
+    mock.ExpectBegin()
     mock.ExpectQuery(regexp.QuoteMeta(`
         UPDATE patients
         SET known_allergies = $1, medications = $2, other_health_issues = $3, doctor_notes = $4, updated_at = NOW()
-        WHERE id = $5
+        WHERE id = $5 AND patients.deleted_at IS NULL AND (patients.doctor_id = $6 OR EXISTS (
+            SELECT 1 FROM emergency_access_grants g
+            WHERE g.patient_id = patients.id AND g.doctor_id = $6 AND g.expires_at > NOW()
+        ) OR EXISTS (
+            SELECT 1 FROM patient_delegations pd
+            WHERE pd.patient_id = patients.id AND pd.to_doctor_id = $6
+            AND pd.revoked_at IS NULL AND pd.expires_at > NOW() AND pd.access = 'write'
+        ))
         RETURNING id, name, phone, age, gender, emergency_contact, known_allergies, medications, other_health_issues, doctor_notes, consent, created_at, updated_at;
     `)).
-        WithArgs(updateInfo.KnownAllergies, updateInfo.Medications, updateInfo.OtherHealthIssues, updateInfo.DoctorNotes, 1).
+        WithArgs(updateInfo.KnownAllergies, updateInfo.Medications, updateInfo.OtherHealthIssues, updateInfo.DoctorNotes, 1, 7).
         WillReturnRows(row)
+    doctorID := 7
+    mock.ExpectExec("INSERT INTO patient_revisions").
+        WithArgs(1, models.PatientRevisionUpdate, &doctorID, nil).
+        WillReturnResult(sqlmock.NewResult(1, 1))
+    mock.ExpectCommit()
 
-    updatedPatient, err := repositories.UpdateMedicalInfo(ctx, db, 1, updateInfo)
+    updatedPatient, err := repositories.UpdateMedicalInfo(ctx, db, 1, 7, updateInfo)
     assert.NoError(t, err)
     assert.Equal(t, "Jane Doe", updatedPatient.Name)
     assert.Equal(t, "Dust", updatedPatient.KnownAllergies)
+    assert.NoError(t, mock.ExpectationsWereMet())
 }
 
 func TestFindUserByEmail_Doctor(t *testing.T) {
@@ -201,11 +517,11 @@ func TestFindUserByEmail_Doctor(t *testing.T) {
 	hash, _ := utils.HashPassword(password)
 
 	rows := sqlmock.NewRows([]string{
-		"id", "email", "role", "password_hash",
+		"id", "email", "role", "status", "password_hash",
 		"doctor_name", "specialty", "emergency_contact", "license_number", "experience_years", "d_created_at", "d_updated_at",
 		"receptionist_name", "phone", "r_created_at", "r_updated_at",
 	}).AddRow(
-		1, "doc@example.com", "doctor", hash,
+		1, "doc@example.com", "doctor", "active", hash,
 		"Dr. Smith", "Cardiology", "1234567890", "LIC1234", 10, time.Now(), time.Now(),
 		nil, nil, nil, nil,
 	)
@@ -233,11 +549,11 @@ func TestFindUserByEmail_Receptionist(t *testing.T) {
 	hash, _ := utils.HashPassword(password)
 
 	rows := sqlmock.NewRows([]string{
-		"id", "email", "role", "password_hash",
+		"id", "email", "role", "status", "password_hash",
 		"doctor_name", "specialty", "emergency_contact", "license_number", "experience_years", "d_created_at", "d_updated_at",
 		"receptionist_name", "phone", "r_created_at", "r_updated_at",
 	}).AddRow(
-		2, "rec@example.com", "receptionist", hash,
+		2, "rec@example.com", "receptionist", "active", hash,
 		nil, nil, nil, nil, nil, nil, nil,
 		"Alice", "9876543210", time.Now(), time.Now(),
 	)
@@ -264,11 +580,11 @@ func TestFindUserByEmail_WrongPassword(t *testing.T) {
 	hash, _ := utils.HashPassword("correctpass")
 
 	rows := sqlmock.NewRows([]string{
-		"id", "email", "role", "password_hash",
+		"id", "email", "role", "status", "password_hash",
 		"doctor_name", "specialty", "emergency_contact", "license_number", "experience_years", "d_created_at", "d_updated_at",
 		"receptionist_name", "phone", "r_created_at", "r_updated_at",
 	}).AddRow(
-		3, "user@example.com", "doctor", hash,
+		3, "user@example.com", "doctor", "active", hash,
 		"Dr. Wrong", "Neuro", "0001112222", "LIC5678", 5, time.Now(), time.Now(),
 		nil, nil, nil, nil,
 	)
@@ -283,7 +599,7 @@ func TestFindUserByEmail_WrongPassword(t *testing.T) {
 	assert.Nil(t, user)
 	assert.Nil(t, doctor)
 	assert.Nil(t, receptionist)
-	assert.Contains(t, err.Error(), "error comparing password")
+	assert.ErrorIs(t, err, repositories.ErrInvalidCredentials)
 }
 
 func TestFindUserByEmail_NotFound(t *testing.T) {
@@ -301,5 +617,1026 @@ func TestFindUserByEmail_NotFound(t *testing.T) {
 	assert.Nil(t, user)
 	assert.Nil(t, doctor)
 	assert.Nil(t, receptionist)
-	assert.Contains(t, err.Error(), "no user found")
-}
\ No newline at end of file
+	assert.ErrorIs(t, err, repositories.ErrInvalidCredentials)
+}
+func TestRotateRefreshToken_Success(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT id, user_id, family_id, expires_at, used_at, revoked_at FROM refresh_tokens").
+		WithArgs("old-hash").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "family_id", "expires_at", "used_at", "revoked_at"}).
+			AddRow(7, 1, "family", time.Now().Add(time.Hour), nil, nil))
+	mock.ExpectExec("UPDATE refresh_tokens SET used_at = NOW\\(\\) WHERE id = \\$1").
+		WithArgs(7).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO refresh_tokens").
+		WithArgs(1, "family", "new-hash", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(8, 1))
+	mock.ExpectExec("INSERT INTO sessions .* ON CONFLICT \\(id\\) DO UPDATE").
+		WithArgs("family", 1, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("SELECT id, email, role FROM users WHERE id = \\$1").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "email", "role"}).AddRow(1, "doc@example.com", "doctor"))
+	mock.ExpectCommit()
+
+	user, sessionID, err := repositories.RotateRefreshToken(context.Background(), db, "old-hash", "new-hash", time.Now().Add(time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, "doctor", user.Role)
+	assert.Equal(t, "family", sessionID)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRotateRefreshToken_ReuseRevokesFamily(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT id, user_id, family_id, expires_at, used_at, revoked_at FROM refresh_tokens").
+		WithArgs("old-hash").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "family_id", "expires_at", "used_at", "revoked_at"}).
+			AddRow(7, 1, "family", time.Now().Add(time.Hour), time.Now(), nil))
+	mock.ExpectExec("UPDATE refresh_tokens SET revoked_at = NOW\\(\\)").
+		WithArgs("family").
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectCommit()
+
+	user, _, err := repositories.RotateRefreshToken(context.Background(), db, "old-hash", "new-hash", time.Now().Add(time.Hour))
+	assert.ErrorIs(t, err, repositories.ErrRefreshTokenReused)
+	assert.Nil(t, user)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRotateRefreshToken_Unknown(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT id, user_id, family_id, expires_at, used_at, revoked_at FROM refresh_tokens").
+		WithArgs("missing").
+		WillReturnError(sql.ErrNoRows)
+	mock.ExpectRollback()
+
+	user, _, err := repositories.RotateRefreshToken(context.Background(), db, "missing", "new-hash", time.Now().Add(time.Hour))
+	assert.ErrorIs(t, err, repositories.ErrInvalidRefreshToken)
+	assert.Nil(t, user)
+}
+
+func TestMemoryRevocationStore(t *testing.T) {
+	store := repositories.NewMemoryRevocationStore()
+	ctx := context.Background()
+
+	revoked, err := store.IsRevoked(ctx, "jti-1")
+	assert.NoError(t, err)
+	assert.False(t, revoked)
+
+	assert.NoError(t, store.Revoke(ctx, "jti-1", time.Now().Add(time.Hour)))
+	assert.NoError(t, store.Revoke(ctx, "jti-2", time.Now().Add(-time.Minute)))
+
+	revoked, err = store.IsRevoked(ctx, "jti-1")
+	assert.NoError(t, err)
+	assert.True(t, revoked)
+
+	revoked, err = store.IsRevoked(ctx, "jti-2")
+	assert.NoError(t, err)
+	assert.False(t, revoked, "Entries past the token expiry no longer matter")
+}
+
+func TestPostgresRevocationStore(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	store := repositories.NewPostgresRevocationStore(db)
+	expiresAt := time.Now().Add(time.Hour)
+
+	mock.ExpectExec("INSERT INTO revoked_tokens").
+		WithArgs("jti-1", expiresAt).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("DELETE FROM revoked_tokens WHERE expires_at < NOW\\(\\)").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SELECT EXISTS").
+		WithArgs("jti-1").
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+
+	assert.NoError(t, store.Revoke(context.Background(), "jti-1", expiresAt))
+	revoked, err := store.IsRevoked(context.Background(), "jti-1")
+	assert.NoError(t, err)
+	assert.True(t, revoked)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func staffColumns() []string {
+	return []string{
+		"id", "email", "role", "status",
+		"doctor_name", "specialty", "emergency_contact", "license_number", "experience_years", "d_created_at", "d_updated_at",
+		"receptionist_name", "phone", "r_created_at", "r_updated_at",
+	}
+}
+
+func TestFindUserByEmail_Deactivated(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	password := "securepass"
+	hash, _ := utils.HashPassword(password)
+
+	rows := sqlmock.NewRows([]string{
+		"id", "email", "role", "status", "password_hash",
+		"doctor_name", "specialty", "emergency_contact", "license_number", "experience_years", "d_created_at", "d_updated_at",
+		"receptionist_name", "phone", "r_created_at", "r_updated_at",
+	}).AddRow(
+		4, "gone@example.com", "doctor", models.StatusDeactivated, hash,
+		"Dr. Gone", "Cardiology", "1234567890", "LIC1234", 10, time.Now(), time.Now(),
+		nil, nil, nil, nil,
+	)
+
+	mock.ExpectQuery("SELECT (.+) FROM users u").
+		WithArgs("gone@example.com").
+		WillReturnRows(rows)
+
+	user, _, _, err := repositories.FindUserByEmail(context.Background(), db, "gone@example.com", password)
+	assert.ErrorIs(t, err, repositories.ErrAccountInactive)
+	assert.Nil(t, user)
+}
+
+func TestCreateStaff_Doctor(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	user := models.User{Email: "new@example.com", Role: "doctor", PasswordHash: "hash"}
+	doctor := &models.Doctor{Name: "Dr. New", Specialty: "ENT", LicenseNumber: "LIC9"}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("INSERT INTO users").
+		WithArgs(user.Email, user.Role, user.PasswordHash, models.StatusActive).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(5))
+	mock.ExpectExec("INSERT INTO user_roles").
+		WithArgs(5, user.Role).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO doctors").
+		WithArgs(5, doctor.Name, user.Email, doctor.Specialty, doctor.EmergencyContact, doctor.LicenseNumber, doctor.ExperienceYears).
+		WillReturnResult(sqlmock.NewResult(5, 1))
+	mock.ExpectQuery("SELECT (.+) FROM users u").
+		WithArgs(5).
+		WillReturnRows(sqlmock.NewRows(staffColumns()).AddRow(
+			5, user.Email, "doctor", models.StatusActive,
+			"Dr. New", "ENT", "", "LIC9", 0, time.Now(), time.Now(),
+			nil, nil, nil, nil,
+		))
+	mock.ExpectCommit()
+
+	account, err := repositories.CreateStaff(context.Background(), db, user, doctor, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 5, account.ID)
+	assert.Equal(t, "Dr. New", account.Doctor.Name)
+	assert.Nil(t, account.Receptionist)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUpdateStaff_PasswordResetRevokesSessions(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT email FROM users WHERE id = \\$1").
+		WithArgs(5).
+		WillReturnRows(sqlmock.NewRows([]string{"email"}).AddRow("rec@example.com"))
+	mock.ExpectExec("UPDATE users SET email = \\$1").
+		WithArgs("rec@example.com", "new-hash", 5).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE sessions SET revoked_at = NOW\\(\\)").
+		WithArgs(5).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec("UPDATE refresh_tokens SET revoked_at = NOW\\(\\)").
+		WithArgs(5).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectQuery("FROM users u").
+		WithArgs(5).
+		WillReturnRows(sqlmock.NewRows(staffColumns()).AddRow(
+			5, "rec@example.com", "receptionist", models.StatusActive,
+			nil, nil, nil, nil, nil, nil, nil,
+			nil, nil, nil, nil,
+		))
+	mock.ExpectCommit()
+
+	_, err = repositories.UpdateStaff(context.Background(), db, 5, "rec@example.com", "new-hash", nil, nil)
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSetUserRoles_RevokesSessions(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT EXISTS \\(SELECT 1 FROM users WHERE id = \\$1\\)").
+		WithArgs(5).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	mock.ExpectExec("DELETE FROM user_roles WHERE user_id = \\$1").
+		WithArgs(5).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec("INSERT INTO user_roles").
+		WithArgs(5, "receptionist").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE sessions SET revoked_at = NOW\\(\\)").
+		WithArgs(5).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE refresh_tokens SET revoked_at = NOW\\(\\)").
+		WithArgs(5).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	err = repositories.SetUserRoles(context.Background(), db, 5, []string{"receptionist"})
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSetUserStatus_DeactivateRevokesRefreshTokens(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE users SET status = \\$1").
+		WithArgs(models.StatusDeactivated, 5).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\) FILTER \\(WHERE deleted_at IS NULL\\), COUNT\\(\\*\\) FROM patients WHERE doctor_id = \\$1").
+		WithArgs(5).
+		WillReturnRows(sqlmock.NewRows([]string{"count", "count"}).AddRow(0, 0))
+	mock.ExpectExec("UPDATE patient_delegations SET revoked_at = NOW\\(\\)").
+		WithArgs(5).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("UPDATE sessions SET revoked_at = NOW\\(\\)").
+		WithArgs(5).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE refresh_tokens SET revoked_at = NOW\\(\\)").
+		WithArgs(5).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	_, err = repositories.SetUserStatus(context.Background(), db, 5, models.StatusDeactivated, models.PatientReassignment{}, 1)
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSetUserStatus_DeactivateDoctorRequiresReassignment(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE users SET status = \\$1").
+		WithArgs(models.StatusDeactivated, 5).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\) FILTER").
+		WithArgs(5).
+		WillReturnRows(sqlmock.NewRows([]string{"count", "count"}).AddRow(3, 3))
+	mock.ExpectRollback()
+
+	_, err = repositories.SetUserStatus(context.Background(), db, 5, models.StatusDeactivated, models.PatientReassignment{}, 1)
+	assert.ErrorIs(t, err, repositories.ErrReassignmentRequired)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// intSliceConverter passes []int arguments through as pgx does, where they
+// become Postgres arrays, and converts everything else as usual.
+type intSliceConverter struct{}
+
+func (intSliceConverter) ConvertValue(v any) (driver.Value, error) {
+	if ids, ok := v.([]int); ok {
+		return ids, nil
+	}
+	return driver.DefaultParameterConverter.ConvertValue(v)
+}
+
+func TestSetUserStatus_DeactivateDoctorReassignsPatients(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.ValueConverterOption(intSliceConverter{}))
+	assert.NoError(t, err)
+	defer db.Close()
+
+	newDoctorID := 9
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE users SET status = \\$1").
+		WithArgs(models.StatusDeactivated, 5).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\) FILTER").
+		WithArgs(5).
+		WillReturnRows(sqlmock.NewRows([]string{"count", "count"}).AddRow(3, 4))
+	mock.ExpectQuery("SELECT 1 FROM users u JOIN doctors d ON d.email = u.email WHERE u.id = \\$1 AND u.status = \\$2").
+		WithArgs(9, models.StatusActive).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	mock.ExpectQuery("UPDATE patients SET doctor_id = \\$1, updated_at = NOW\\(\\) WHERE doctor_id = \\$2 RETURNING id").
+		WithArgs(int64(9), 5).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(11).AddRow(12).AddRow(13).AddRow(14))
+	adminID := 1
+	mock.ExpectExec("INSERT INTO patient_revisions(.|\\n)*WHERE p.id = ANY\\(\\$1\\)").
+		WithArgs([]int{11, 12, 13, 14}, models.PatientRevisionUpdate, &adminID, nil).
+		WillReturnResult(sqlmock.NewResult(0, 4))
+	mock.ExpectExec("UPDATE patient_delegations SET revoked_at = NOW\\(\\)").
+		WithArgs(5).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("UPDATE sessions SET revoked_at = NOW\\(\\)").
+		WithArgs(5).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE refresh_tokens SET revoked_at = NOW\\(\\)").
+		WithArgs(5).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	reassigned, err := repositories.SetUserStatus(context.Background(), db, 5, models.StatusDeactivated, models.PatientReassignment{ReassignTo: &newDoctorID}, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, reassigned)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSetUserStatus_ReassignTargetMustBeActiveDoctor(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	receptionistID := 7
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE users SET status = \\$1").
+		WithArgs(models.StatusDeactivated, 5).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\) FILTER").
+		WithArgs(5).
+		WillReturnRows(sqlmock.NewRows([]string{"count", "count"}).AddRow(2, 2))
+	mock.ExpectQuery("SELECT 1 FROM users u JOIN doctors d ON d.email = u.email WHERE u.id = \\$1 AND u.status = \\$2").
+		WithArgs(receptionistID, models.StatusActive).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	mock.ExpectRollback()
+
+	_, err = repositories.SetUserStatus(context.Background(), db, 5, models.StatusDeactivated, models.PatientReassignment{ReassignTo: &receptionistID}, 1)
+	assert.ErrorIs(t, err, repositories.ErrReassignTargetInvalid)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSetUserStatus_DeactivateDoctorUnassignsDeletedPatients(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.ValueConverterOption(intSliceConverter{}))
+	assert.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE users SET status = \\$1").
+		WithArgs(models.StatusDeactivated, 5).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\) FILTER").
+		WithArgs(5).
+		WillReturnRows(sqlmock.NewRows([]string{"count", "count"}).AddRow(0, 2))
+	mock.ExpectQuery("UPDATE patients SET doctor_id = \\$1, updated_at = NOW\\(\\) WHERE doctor_id = \\$2 RETURNING id").
+		WithArgs(nil, 5).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(21).AddRow(22))
+	adminID := 1
+	mock.ExpectExec("INSERT INTO patient_revisions(.|\\n)*WHERE p.id = ANY\\(\\$1\\)").
+		WithArgs([]int{21, 22}, models.PatientRevisionUpdate, &adminID, nil).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec("UPDATE patient_delegations SET revoked_at = NOW\\(\\)").
+		WithArgs(5).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("UPDATE sessions SET revoked_at = NOW\\(\\)").
+		WithArgs(5).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE refresh_tokens SET revoked_at = NOW\\(\\)").
+		WithArgs(5).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	reassigned, err := repositories.SetUserStatus(context.Background(), db, 5, models.StatusDeactivated, models.PatientReassignment{}, 1)
+	assert.NoError(t, err, "Deleted patients alone do not require a reassignment")
+	assert.Equal(t, 0, reassigned)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestResetPassword_Success(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT t.user_id FROM password_reset_tokens t").
+		WithArgs("token-hash", models.StatusActive).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id"}).AddRow(3))
+	mock.ExpectExec("UPDATE users SET password_hash = \\$1, password_changed_at = NOW\\(\\) WHERE id = \\$2").
+		WithArgs("new-hash", 3).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO password_history").
+		WithArgs(3, "new-hash").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("DELETE FROM password_history").
+		WithArgs(3, 5).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("UPDATE password_reset_tokens SET used_at = NOW\\(\\)").
+		WithArgs(3).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE sessions SET revoked_at = NOW\\(\\)").
+		WithArgs(3).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE refresh_tokens SET revoked_at = NOW\\(\\)").
+		WithArgs(3).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectCommit()
+
+	err = repositories.ResetPassword(context.Background(), db, "token-hash", "new-hash", 5)
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestResetPassword_InvalidToken(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT t.user_id FROM password_reset_tokens t").
+		WithArgs("used-hash", models.StatusActive).
+		WillReturnError(sql.ErrNoRows)
+	mock.ExpectRollback()
+
+	err = repositories.ResetPassword(context.Background(), db, "used-hash", "new-hash", 5)
+	assert.ErrorIs(t, err, repositories.ErrInvalidResetToken)
+}
+
+func TestConsumeTOTPStep_RejectsReplay(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectExec("UPDATE user_mfa SET last_used_step = \\$2").
+		WithArgs(1, int64(100)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE user_mfa SET last_used_step = \\$2").
+		WithArgs(1, int64(100)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	ok, err := repositories.ConsumeTOTPStep(context.Background(), db, 1, 100)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	ok, err = repositories.ConsumeTOTPStep(context.Background(), db, 1, 100)
+	assert.NoError(t, err)
+	assert.False(t, ok, "The same step must not be accepted twice")
+}
+
+func TestMemoryLoginAttemptStore(t *testing.T) {
+	store := repositories.NewMemoryLoginAttemptStore()
+	ctx := context.Background()
+
+	attempt, err := store.Get(ctx, "email:doc@example.com")
+	assert.NoError(t, err)
+	assert.Nil(t, attempt)
+
+	store.RecordFailure(ctx, "email:doc@example.com", time.Minute)
+	attempt, err = store.RecordFailure(ctx, "email:doc@example.com", time.Minute)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, attempt.Failures)
+
+	until := time.Now().Add(time.Minute)
+	assert.NoError(t, store.Block(ctx, "email:doc@example.com", until))
+	attempt, err = store.Get(ctx, "email:doc@example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, until, attempt.BlockedUntil)
+
+	assert.NoError(t, store.Reset(ctx, "email:doc@example.com"))
+	attempt, err = store.Get(ctx, "email:doc@example.com")
+	assert.NoError(t, err)
+	assert.Nil(t, attempt)
+}
+
+func TestPostgresLoginAttemptStore_RecordFailure(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	now := time.Now()
+	mock.ExpectQuery("INSERT INTO login_attempts").
+		WithArgs("ip:203.0.113.7", float64(900)).
+		WillReturnRows(sqlmock.NewRows([]string{"key", "failures", "last_failure_at", "blocked_until"}).
+			AddRow("ip:203.0.113.7", 4, now, nil))
+
+	store := repositories.NewPostgresLoginAttemptStore(db)
+	attempt, err := store.RecordFailure(context.Background(), "ip:203.0.113.7", 15*time.Minute)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, attempt.Failures)
+	assert.True(t, attempt.BlockedUntil.IsZero())
+}
+
+func TestFindStaffByOIDC_LinksVerifiedEmail(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectQuery("SELECT (.+) FROM users u (.+) WHERE u.oidc_subject = \\$1").
+		WithArgs("sub-123").
+		WillReturnError(sql.ErrNoRows)
+	mock.ExpectQuery("UPDATE users SET oidc_subject = \\$1").
+		WithArgs("sub-123", "doc@example.com").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(5))
+	mock.ExpectQuery("SELECT (.+) FROM users u (.+) WHERE u.id = \\$1").
+		WithArgs(5).
+		WillReturnRows(sqlmock.NewRows(staffColumns()).AddRow(
+			5, "doc@example.com", "doctor", models.StatusActive,
+			"Dr. Who", "ENT", "", "LIC9", 0, time.Now(), time.Now(),
+			nil, nil, nil, nil,
+		))
+
+	account, err := repositories.FindStaffByOIDC(context.Background(), db, "sub-123", "doc@example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, 5, account.ID)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestFindStaffByOIDC_UnverifiedEmailNotLinked(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectQuery("SELECT (.+) FROM users u (.+) WHERE u.oidc_subject = \\$1").
+		WithArgs("sub-123").
+		WillReturnError(sql.ErrNoRows)
+
+	_, err = repositories.FindStaffByOIDC(context.Background(), db, "sub-123", "")
+	assert.ErrorIs(t, err, repositories.ErrOIDCUserNotFound)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPostgresAPIKeyStore_FindActive(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	columns := []string{"id", "name", "prefix", "scopes", "created_by", "expires_at", "last_used_at", "revoked_at", "created_at"}
+	mock.ExpectQuery("FROM api_keys WHERE key_hash = \\$1 AND revoked_at IS NULL").
+		WithArgs("hash").
+		WillReturnRows(sqlmock.NewRows(columns).AddRow(3, "lab", "pms_abcdefgh", "patients:read,medical:write", 1, nil, nil, nil, time.Now()))
+	mock.ExpectQuery("FROM api_keys WHERE key_hash = \\$1 AND revoked_at IS NULL").
+		WithArgs("unknown").
+		WillReturnError(sql.ErrNoRows)
+
+	store := repositories.NewPostgresAPIKeyStore(db)
+	key, err := store.FindActive(context.Background(), "hash")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{models.ScopePatientsRead, models.ScopeMedicalWrite}, key.Scopes)
+
+	_, err = store.FindActive(context.Background(), "unknown")
+	assert.ErrorIs(t, err, repositories.ErrInvalidAPIKey)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPushMedicalInfo_RecordsAPIKey(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	apiKeyID := 6
+	mock.ExpectBegin()
+	mock.ExpectQuery("UPDATE patients SET known_allergies = \\$1(.|\\n)*WHERE id = \\$5 AND deleted_at IS NULL").
+		WithArgs("None", "Metformin", "HbA1c 6.1%", "", 1).
+		WillReturnRows(sqlmock.NewRows([]string{
+			"id", "name", "phone", "age", "gender", "emergency_contact",
+			"known_allergies", "medications", "other_health_issues",
+			"doctor_notes", "consent", "created_at", "updated_at",
+		}).AddRow(1, "John Doe", "9876543210", 30, "male", "1234567890",
+			"None", "Metformin", "HbA1c 6.1%", "", true, time.Now(), time.Now()))
+	mock.ExpectExec("INSERT INTO patient_revisions").
+		WithArgs(1, models.PatientRevisionUpdate, nil, &apiKeyID).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	patient, err := repositories.PushMedicalInfo(context.Background(), db, 1, apiKeyID, models.DocPatientUpdate{
+		KnownAllergies:    "None",
+		Medications:       "Metformin",
+		OtherHealthIssues: "HbA1c 6.1%",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "HbA1c 6.1%", patient.OtherHealthIssues)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("UPDATE patients SET known_allergies").WillReturnError(sql.ErrNoRows)
+	mock.ExpectRollback()
+	_, err = repositories.PushMedicalInfo(context.Background(), db, 2, apiKeyID, models.DocPatientUpdate{})
+	assert.ErrorIs(t, err, repositories.ErrPatientNotFound)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUpdateMedicalInfo_NotAssigned(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	updateInfo := models.DocPatientUpdate{DoctorNotes: "Rewritten"}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("UPDATE patients (.+) WHERE id = \\$5 AND patients.deleted_at IS NULL AND \\(patients.doctor_id = \\$6 OR EXISTS").
+		WithArgs(updateInfo.KnownAllergies, updateInfo.Medications, updateInfo.OtherHealthIssues, updateInfo.DoctorNotes, 1, 8).
+		WillReturnError(sql.ErrNoRows)
+	mock.ExpectQuery("SELECT EXISTS \\(SELECT 1 FROM patients WHERE id = \\$1 AND deleted_at IS NULL\\)").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	mock.ExpectRollback()
+
+	_, err = repositories.UpdateMedicalInfo(context.Background(), db, 1, 8, updateInfo)
+	assert.ErrorIs(t, err, repositories.ErrPatientNotAssigned)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUpdateMedicalInfo_NotFound(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("UPDATE patients").
+		WillReturnError(sql.ErrNoRows)
+	mock.ExpectQuery("SELECT EXISTS").
+		WithArgs(99).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	mock.ExpectRollback()
+
+	_, err = repositories.UpdateMedicalInfo(context.Background(), db, 99, 8, models.DocPatientUpdate{})
+	assert.ErrorIs(t, err, repositories.ErrPatientNotFound)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestInsertAuditLog(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	userID := 8
+	mock.ExpectExec("INSERT INTO audit_log").
+		WithArgs(&userID, nil, "patient.medical.update", "patient", "1", models.AuditOutcomeDenied, models.AuditSeverityWarning, []byte(`{"reason":"not assigned"}`), "10.0.0.1").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	err = repositories.InsertAuditLog(context.Background(), db, models.AuditEntry{
+		UserID:       &userID,
+		Action:       "patient.medical.update",
+		ResourceType: "patient",
+		ResourceID:   "1",
+		Outcome:      models.AuditOutcomeDenied,
+		Severity:     models.AuditSeverityWarning,
+		Details:      map[string]any{"reason": "not assigned"},
+		IP:           "10.0.0.1",
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCreateEmergencyGrant_AuditsInTransaction(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	expiresAt := time.Now().Add(time.Hour)
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT p.doctor_id, d.name, d.email FROM patients p").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"doctor_id", "name", "email"}).AddRow(3, "Dr. Assigned", "assigned@example.com"))
+	mock.ExpectQuery("INSERT INTO emergency_access_grants").
+		WithArgs(8, 1, "Unconscious patient in ER, assigned doctor off duty", expiresAt).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "granted_at"}).AddRow(11, time.Now()))
+	mock.ExpectExec("INSERT INTO audit_log").
+		WithArgs(sqlmock.AnyArg(), nil, "patient.emergency_access", "patient", "1", models.AuditOutcomeAllowed, models.AuditSeverityHigh, sqlmock.AnyArg(), "10.0.0.1").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	grant, assigned, err := repositories.CreateEmergencyGrant(context.Background(), db, models.EmergencyAccessGrant{
+		DoctorID:      8,
+		PatientID:     1,
+		Justification: "Unconscious patient in ER, assigned doctor off duty",
+		ExpiresAt:     expiresAt,
+	}, "10.0.0.1")
+	assert.NoError(t, err)
+	assert.Equal(t, 11, grant.ID)
+	assert.Equal(t, "assigned@example.com", assigned.Email)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCreateEmergencyGrant_FindsDoctorByEmail(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	// patients.doctor_id holds the user ID 3; the doctor's profile row has
+	// its own ID and is only linked to the user by email.
+	expiresAt := time.Now().Add(time.Hour)
+	mock.ExpectBegin()
+	mock.ExpectQuery("FROM patients p LEFT JOIN users u ON u.id = p.doctor_id LEFT JOIN doctors d ON d.email = u.email WHERE p.id = \\$1").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"doctor_id", "name", "email"}).AddRow(3, "Dr. Legacy", "legacy@example.com"))
+	mock.ExpectQuery("INSERT INTO emergency_access_grants").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "granted_at"}).AddRow(12, time.Now()))
+	mock.ExpectExec("INSERT INTO audit_log").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	_, assigned, err := repositories.CreateEmergencyGrant(context.Background(), db, models.EmergencyAccessGrant{
+		DoctorID:      8,
+		PatientID:     1,
+		Justification: "Unconscious patient in ER, assigned doctor off duty",
+		ExpiresAt:     expiresAt,
+	}, "10.0.0.1")
+	assert.NoError(t, err)
+	if assert.NotNil(t, assigned) {
+		assert.Equal(t, 3, assigned.ID, "The assigned doctor is identified by user ID")
+		assert.Equal(t, "legacy@example.com", assigned.Email)
+	}
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCreateEmergencyGrant_AlreadyAssigned(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT p.doctor_id, d.name, d.email FROM patients p").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"doctor_id", "name", "email"}).AddRow(8, "Dr. Own", "own@example.com"))
+	mock.ExpectRollback()
+
+	_, _, err = repositories.CreateEmergencyGrant(context.Background(), db, models.EmergencyAccessGrant{DoctorID: 8, PatientID: 1}, "")
+	assert.ErrorIs(t, err, repositories.ErrPatientAlreadyAssigned)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCreateDelegation_AuditsInTransaction(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	expiresAt := time.Now().Add(48 * time.Hour)
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT doctor_id FROM patients WHERE id = \\$1").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"doctor_id"}).AddRow(3))
+	mock.ExpectQuery("SELECT 1 FROM users u JOIN doctors d ON d.email = u.email WHERE u.id = \\$1 AND u.status = \\$2").
+		WithArgs(8, models.StatusActive).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	mock.ExpectQuery("INSERT INTO patient_delegations").
+		WithArgs(1, 3, 8, models.DelegationWrite, expiresAt).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(21, time.Now()))
+	mock.ExpectExec("INSERT INTO audit_log").
+		WithArgs(sqlmock.AnyArg(), nil, "patient.delegate", "patient", "1", models.AuditOutcomeAllowed, models.AuditSeverityInfo, sqlmock.AnyArg(), "10.0.0.1").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	delegation, err := repositories.CreateDelegation(context.Background(), db, models.PatientDelegation{
+		PatientID:    1,
+		FromDoctorID: 3,
+		ToDoctorID:   8,
+		Access:       models.DelegationWrite,
+		ExpiresAt:    expiresAt,
+	}, "10.0.0.1")
+	assert.NoError(t, err)
+	assert.Equal(t, 21, delegation.ID)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCreateDelegation_NotAssignedDoctor(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT doctor_id FROM patients WHERE id = \\$1").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"doctor_id"}).AddRow(5))
+	mock.ExpectRollback()
+
+	_, err = repositories.CreateDelegation(context.Background(), db, models.PatientDelegation{
+		PatientID: 1, FromDoctorID: 3, ToDoctorID: 8, Access: models.DelegationRead, ExpiresAt: time.Now().Add(time.Hour),
+	}, "")
+	assert.ErrorIs(t, err, repositories.ErrPatientNotAssigned)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCreateDelegation_TargetMustBeActiveDoctor(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT doctor_id FROM patients WHERE id = \\$1").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"doctor_id"}).AddRow(3))
+	mock.ExpectQuery("SELECT 1 FROM users u JOIN doctors d ON d.email = u.email WHERE u.id = \\$1 AND u.status = \\$2").
+		WithArgs(9, models.StatusActive).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	mock.ExpectRollback()
+
+	_, err = repositories.CreateDelegation(context.Background(), db, models.PatientDelegation{
+		PatientID: 1, FromDoctorID: 3, ToDoctorID: 9, Access: models.DelegationRead, ExpiresAt: time.Now().Add(time.Hour),
+	}, "")
+	assert.ErrorIs(t, err, repositories.ErrDelegationTargetInvalid)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRevokeDelegation_OnlyGrantor(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("UPDATE patient_delegations SET revoked_at = NOW\\(\\) WHERE id = \\$1 AND from_doctor_id = \\$2").
+		WithArgs(21, 8).
+		WillReturnRows(sqlmock.NewRows([]string{"patient_id"}))
+	mock.ExpectRollback()
+
+	err = repositories.RevokeDelegation(context.Background(), db, 21, 8, "")
+	assert.ErrorIs(t, err, repositories.ErrDelegationNotFound)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRevokeSession_RevokesRefreshFamily(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE sessions SET revoked_at = NOW\\(\\) WHERE id = \\$1 AND user_id = \\$2").
+		WithArgs("family", 4).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE refresh_tokens SET revoked_at = NOW\\(\\) WHERE family_id = \\$1").
+		WithArgs("family").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	err = repositories.RevokeSession(context.Background(), db, 4, "family")
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRevokeSession_OtherUsersSession(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE sessions SET revoked_at = NOW\\(\\)").
+		WithArgs("family", 9).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+
+	err = repositories.RevokeSession(context.Background(), db, 9, "family")
+	assert.ErrorIs(t, err, repositories.ErrSessionNotFound)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestChangePassword_KeepsCurrentSession(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE users SET password_hash = \\$1, password_changed_at = NOW\\(\\)").
+		WithArgs("new-hash", 4).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE sessions SET revoked_at = NOW\\(\\) WHERE user_id = \\$1 AND id <> \\$2").
+		WithArgs(4, "current").
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec("UPDATE refresh_tokens SET revoked_at = NOW\\(\\) WHERE user_id = \\$1 AND family_id <> \\$2").
+		WithArgs(4, "current").
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectCommit()
+
+	err = repositories.ChangePassword(context.Background(), db, 4, "new-hash", 0, "current")
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestFindUserByEmail_RehashesLegacyBcrypt(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	password := "legacypass"
+	legacyHash, err := utils.NewBcryptHasher(4).Hash(password)
+	assert.NoError(t, err)
+
+	rows := sqlmock.NewRows([]string{
+		"id", "email", "role", "status", "password_hash",
+		"doctor_name", "specialty", "emergency_contact", "license_number", "experience_years", "d_created_at", "d_updated_at",
+		"receptionist_name", "phone", "r_created_at", "r_updated_at",
+	}).AddRow(
+		2, "rec@example.com", "receptionist", "active", legacyHash,
+		nil, nil, nil, nil, nil, nil, nil,
+		"Alice", "9876543210", time.Now(), time.Now(),
+	)
+	mock.ExpectQuery("SELECT (.+) FROM users u").
+		WithArgs("rec@example.com").
+		WillReturnRows(rows)
+	mock.ExpectExec("UPDATE users SET password_hash = \\$1 WHERE id = \\$2 AND password_hash = \\$3").
+		WithArgs(sqlmock.AnyArg(), 2, legacyHash).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	user, _, _, err := repositories.FindUserByEmail(context.Background(), db, "rec@example.com", password)
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(user.PasswordHash, "$argon2id$"))
+	assert.NoError(t, utils.ComparePassword(user.PasswordHash, password))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCreateAccessOverride_AuditsInTransaction(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	expiresAt := time.Now().Add(8 * time.Hour)
+	mock.ExpectBegin()
+	mock.ExpectQuery("INSERT INTO access_policy_overrides").
+		WithArgs(5, "Covering the night shift", 1, expiresAt).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(2, time.Now()))
+	mock.ExpectExec("INSERT INTO audit_log").
+		WithArgs(sqlmock.AnyArg(), nil, "access_policy.override", "user", "5", models.AuditOutcomeAllowed, models.AuditSeverityWarning, sqlmock.AnyArg(), "10.0.0.1").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	override, err := repositories.CreateAccessOverride(context.Background(), db, models.AccessOverride{
+		UserID:    5,
+		Reason:    "Covering the night shift",
+		CreatedBy: 1,
+		ExpiresAt: expiresAt,
+	}, "10.0.0.1")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, override.ID)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func patientSearchRow(rows *sqlmock.Rows, id int, name string, createdAt time.Time) *sqlmock.Rows {
+	return rows.AddRow(id, name, "9876543210", 30, time.Now(), "female", "1234567890", "1234-5678-9012", nil,
+		"card", "", "", "", "", true, createdAt, createdAt)
+}
+
+func TestSearchPatients_FiltersAndPages(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	first := time.Date(2026, 3, 2, 10, 0, 0, 0, time.UTC)
+	doctorID := 3
+
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM patients WHERE deleted_at IS NULL AND name ILIKE \\$1 AND doctor_id = \\$2").
+		WithArgs("%an\\_n%", 3).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+	rows := patientRows()
+	patientSearchRow(rows, 9, "Anna", first)
+	patientSearchRow(rows, 7, "Hannah", first.Add(-time.Hour))
+	patientSearchRow(rows, 4, "Joanna", first.Add(-2*time.Hour))
+	mock.ExpectQuery("FROM patients WHERE deleted_at IS NULL AND name ILIKE \\$1 AND doctor_id = \\$2 ORDER BY created_at desc, id desc LIMIT \\$3").
+		WithArgs("%an\\_n%", 3, 3).
+		WillReturnRows(rows)
+
+	page, err := repositories.SearchPatients(context.Background(), db, models.PatientSearch{Name: "an_n", DoctorID: &doctorID, Limit: 2})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, page.Total)
+	assert.Len(t, page.Patients, 2)
+	assert.Equal(t, 0, page.Patients[0].DoctorID)
+	assert.NotEmpty(t, page.NextCursor)
+
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM patients").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+	rows = patientRows()
+	patientSearchRow(rows, 4, "Joanna", first.Add(-2*time.Hour))
+	mock.ExpectQuery("AND \\(created_at, id\\) < \\(\\$3::timestamptz, \\$4\\) ORDER BY created_at desc, id desc LIMIT \\$5").
+		WithArgs("%an\\_n%", 3, first.Add(-time.Hour).Format(time.RFC3339Nano), 7, 3).
+		WillReturnRows(rows)
+
+	page, err = repositories.SearchPatients(context.Background(), db, models.PatientSearch{Name: "an_n", DoctorID: &doctorID, Limit: 2, Cursor: page.NextCursor})
+	assert.NoError(t, err)
+	assert.Len(t, page.Patients, 1)
+	assert.Empty(t, page.NextCursor)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSearchPatients_RejectsCursorForOtherSort(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM patients").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+	rows := patientRows()
+	patientSearchRow(rows, 1, "Anna", time.Now())
+	patientSearchRow(rows, 2, "Bela", time.Now())
+	mock.ExpectQuery("ORDER BY name asc, id asc").WillReturnRows(rows)
+
+	page, err := repositories.SearchPatients(context.Background(), db, models.PatientSearch{Sort: "name", Order: "asc", Limit: 1})
+	assert.NoError(t, err)
+
+	_, err = repositories.SearchPatients(context.Background(), db, models.PatientSearch{Sort: "age", Order: "asc", Cursor: page.NextCursor})
+	assert.ErrorIs(t, err, repositories.ErrInvalidCursor)
+	_, err = repositories.SearchPatients(context.Background(), db, models.PatientSearch{Cursor: "not-a-cursor"})
+	assert.ErrorIs(t, err, repositories.ErrInvalidCursor)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
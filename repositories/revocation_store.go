@@ -0,0 +1,96 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// TokenRevocationStore records access tokens that were revoked before they
+// expired, keyed by their jti claim. Entries only need to live until the
+// token's own expiry, after which signature verification rejects it anyway.
+type TokenRevocationStore interface {
+	Revoke(ctx context.Context, jti string, expiresAt time.Time) error
+	IsRevoked(ctx context.Context, jti string) (bool, error)
+}
+
+// MemoryRevocationStore keeps revoked jtis in process memory. It is suitable
+// for single-instance deployments and tests; revocations are lost on restart.
+type MemoryRevocationStore struct {
+	mu      sync.Mutex
+	revoked map[string]time.Time
+}
+
+func NewMemoryRevocationStore() *MemoryRevocationStore {
+	return &MemoryRevocationStore{
+		revoked: make(map[string]time.Time),
+	}
+}
+
+func (s *MemoryRevocationStore) Revoke(ctx context.Context, jti string, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for id, exp := range s.revoked {
+		if now.After(exp) {
+			delete(s.revoked, id)
+		}
+	}
+	s.revoked[jti] = expiresAt
+	return nil
+}
+
+func (s *MemoryRevocationStore) IsRevoked(ctx context.Context, jti string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	exp, ok := s.revoked[jti]
+	if !ok {
+		return false, nil
+	}
+	return time.Now().Before(exp), nil
+}
+
+// PostgresRevocationStore persists revoked jtis in the revoked_tokens table so
+// that every instance behind the load balancer sees a logout.
+type PostgresRevocationStore struct {
+	DB *sql.DB
+}
+
+func NewPostgresRevocationStore(db *sql.DB) *PostgresRevocationStore {
+	return &PostgresRevocationStore{
+		DB: db,
+	}
+}
+
+func (s *PostgresRevocationStore) Revoke(ctx context.Context, jti string, expiresAt time.Time) error {
+	query := `
+	INSERT INTO revoked_tokens (jti, expires_at)
+	VALUES ($1, $2)
+	ON CONFLICT (jti) DO NOTHING;
+	`
+	if _, err := s.DB.ExecContext(ctx, query, jti, expiresAt); err != nil {
+		return fmt.Errorf("error revoking token: %w", err)
+	}
+
+	if _, err := s.DB.ExecContext(ctx, `DELETE FROM revoked_tokens WHERE expires_at < NOW();`); err != nil {
+		return fmt.Errorf("error pruning revoked tokens: %w", err)
+	}
+	return nil
+}
+
+func (s *PostgresRevocationStore) IsRevoked(ctx context.Context, jti string) (bool, error) {
+	query := `
+	SELECT EXISTS (
+		SELECT 1 FROM revoked_tokens WHERE jti = $1 AND expires_at > NOW()
+	);
+	`
+	var revoked bool
+	if err := s.DB.QueryRowContext(ctx, query, jti).Scan(&revoked); err != nil {
+		return false, fmt.Errorf("error checking token revocation: %w", err)
+	}
+	return revoked, nil
+}
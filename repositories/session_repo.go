@@ -0,0 +1,186 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Somvaded/assessment/models"
+)
+
+var ErrSessionNotFound = errors.New("session not found")
+
+func CreateSession(ctx context.Context, db *sql.DB, session models.Session) error {
+	query := `
+	INSERT INTO sessions (id, user_id, device, ip, user_agent, expires_at)
+	VALUES ($1, $2, $3, $4, $5, $6);
+	`
+	_, err := db.ExecContext(ctx, query, session.ID, session.UserID, session.Device, session.IP, session.UserAgent, session.ExpiresAt)
+	if err != nil {
+		return fmt.Errorf("error creating session: %w", err)
+	}
+	return nil
+}
+
+// ListSessions returns the unrevoked, unexpired sessions of a user, most
+// recently used first.
+func ListSessions(ctx context.Context, db *sql.DB, userID int) ([]models.Session, error) {
+	rows, err := db.QueryContext(ctx, `
+	SELECT id, user_id, device, ip, user_agent, created_at, last_seen_at, expires_at
+	FROM sessions
+	WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > NOW()
+	ORDER BY last_seen_at DESC;
+	`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error querying sessions: %w", err)
+	}
+	defer rows.Close()
+
+	sessions := []models.Session{}
+	for rows.Next() {
+		var session models.Session
+		err := rows.Scan(
+			&session.ID,
+			&session.UserID,
+			&session.Device,
+			&session.IP,
+			&session.UserAgent,
+			&session.CreatedAt,
+			&session.LastSeenAt,
+			&session.ExpiresAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning session: %w", err)
+		}
+		sessions = append(sessions, session)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+	return sessions, nil
+}
+
+// RevokeSession ends one session of userID together with its refresh token
+// family. It returns ErrSessionNotFound when the user has no such active
+// session.
+func RevokeSession(ctx context.Context, db *sql.DB, userID int, sessionID string) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `
+	UPDATE sessions SET revoked_at = NOW()
+	WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL;
+	`, sessionID, userID)
+	if err != nil {
+		return fmt.Errorf("error revoking session: %w", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error checking rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return ErrSessionNotFound
+	}
+
+	_, err = tx.ExecContext(ctx, `
+	UPDATE refresh_tokens SET revoked_at = NOW()
+	WHERE family_id = $1 AND revoked_at IS NULL;
+	`, sessionID)
+	if err != nil {
+		return fmt.Errorf("error revoking token family: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %w", err)
+	}
+	return nil
+}
+
+// RevokeUserSessions ends every session and refresh token of a user and
+// returns how many sessions were active.
+func RevokeUserSessions(ctx context.Context, db *sql.DB, userID int) (int, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `
+	UPDATE sessions SET revoked_at = NOW()
+	WHERE user_id = $1 AND revoked_at IS NULL;
+	`, userID)
+	if err != nil {
+		return 0, fmt.Errorf("error revoking sessions: %w", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("error checking rows affected: %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx, `
+	UPDATE refresh_tokens SET revoked_at = NOW()
+	WHERE user_id = $1 AND revoked_at IS NULL;
+	`, userID)
+	if err != nil {
+		return 0, fmt.Errorf("error revoking refresh tokens: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("error committing transaction: %w", err)
+	}
+	return int(rowsAffected), nil
+}
+
+// SessionStore is what Protect needs to reject access tokens whose session
+// has been revoked.
+type SessionStore interface {
+	// Active reports whether the session exists and is neither revoked nor
+	// expired.
+	Active(ctx context.Context, id string) (bool, error)
+	// Touch records that the session was just used.
+	Touch(ctx context.Context, id string) error
+}
+
+type PostgresSessionStore struct {
+	DB *sql.DB
+}
+
+func NewPostgresSessionStore(db *sql.DB) *PostgresSessionStore {
+	return &PostgresSessionStore{
+		DB: db,
+	}
+}
+
+func (s *PostgresSessionStore) Active(ctx context.Context, id string) (bool, error) {
+	var active bool
+	err := s.DB.QueryRowContext(ctx, `
+	SELECT EXISTS (
+		SELECT 1 FROM sessions
+		WHERE id = $1 AND revoked_at IS NULL AND expires_at > NOW()
+	);
+	`, id).Scan(&active)
+	if err != nil {
+		return false, fmt.Errorf("error checking session: %w", err)
+	}
+	return active, nil
+}
+
+// sessionTouchInterval bounds how often last_seen_at is written, so an
+// active browser tab does not update the row on every request.
+const sessionTouchInterval = time.Minute
+
+func (s *PostgresSessionStore) Touch(ctx context.Context, id string) error {
+	_, err := s.DB.ExecContext(ctx, `
+	UPDATE sessions SET last_seen_at = NOW()
+	WHERE id = $1 AND last_seen_at < NOW() - make_interval(secs => $2);
+	`, id, sessionTouchInterval.Seconds())
+	if err != nil {
+		return fmt.Errorf("error updating session last seen: %w", err)
+	}
+	return nil
+}
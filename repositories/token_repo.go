@@ -0,0 +1,153 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Somvaded/assessment/models"
+)
+
+var (
+	ErrInvalidRefreshToken = errors.New("invalid or expired refresh token")
+	ErrRefreshTokenReused  = errors.New("refresh token reuse detected")
+)
+
+func CreateRefreshToken(ctx context.Context, db *sql.DB, userID int, familyID string, tokenHash string, expiresAt time.Time) error {
+	query := `
+	INSERT INTO refresh_tokens (user_id, family_id, token_hash, expires_at)
+	VALUES ($1, $2, $3, $4);
+	`
+	_, err := db.ExecContext(ctx, query, userID, familyID, tokenHash, expiresAt)
+	if err != nil {
+		return fmt.Errorf("error creating refresh token: %w", err)
+	}
+	return nil
+}
+
+// RotateRefreshToken consumes the refresh token identified by tokenHash and
+// stores newTokenHash as its successor in the same family, extending the
+// family's session to expiresAt. It returns the token owner and the family
+// ID. Presenting a token that was already rotated or revoked revokes every
+// token in its family and returns ErrRefreshTokenReused.
+func RotateRefreshToken(ctx context.Context, db *sql.DB, tokenHash string, newTokenHash string, expiresAt time.Time) (*models.User, string, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, "", fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var current models.RefreshToken
+	err = tx.QueryRowContext(ctx, `
+	SELECT id, user_id, family_id, expires_at, used_at, revoked_at
+	FROM refresh_tokens
+	WHERE token_hash = $1
+	FOR UPDATE;
+	`, tokenHash).Scan(
+		&current.ID,
+		&current.UserID,
+		&current.FamilyID,
+		&current.ExpiresAt,
+		&current.UsedAt,
+		&current.RevokedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, "", ErrInvalidRefreshToken
+		}
+		return nil, "", fmt.Errorf("error finding refresh token: %w", err)
+	}
+
+	if current.UsedAt != nil || current.RevokedAt != nil {
+		if _, err := tx.ExecContext(ctx, revokeFamilyQuery, current.FamilyID); err != nil {
+			return nil, "", fmt.Errorf("error revoking token family: %w", err)
+		}
+		if err := tx.Commit(); err != nil {
+			return nil, "", fmt.Errorf("error committing transaction: %w", err)
+		}
+		return nil, "", ErrRefreshTokenReused
+	}
+
+	if time.Now().After(current.ExpiresAt) {
+		return nil, "", ErrInvalidRefreshToken
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE refresh_tokens SET used_at = NOW() WHERE id = $1;`, current.ID)
+	if err != nil {
+		return nil, "", fmt.Errorf("error marking refresh token used: %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx, `
+	INSERT INTO refresh_tokens (user_id, family_id, token_hash, expires_at)
+	VALUES ($1, $2, $3, $4);
+	`, current.UserID, current.FamilyID, newTokenHash, expiresAt)
+	if err != nil {
+		return nil, "", fmt.Errorf("error creating refresh token: %w", err)
+	}
+
+	// Families issued before sessions were recorded get their row here.
+	_, err = tx.ExecContext(ctx, `
+	INSERT INTO sessions (id, user_id, expires_at)
+	VALUES ($1, $2, $3)
+	ON CONFLICT (id) DO UPDATE SET expires_at = EXCLUDED.expires_at, last_seen_at = NOW();
+	`, current.FamilyID, current.UserID, expiresAt)
+	if err != nil {
+		return nil, "", fmt.Errorf("error extending session: %w", err)
+	}
+
+	var user models.User
+	err = tx.QueryRowContext(ctx, `SELECT id, email, role FROM users WHERE id = $1;`, current.UserID).Scan(
+		&user.ID,
+		&user.Email,
+		&user.Role,
+	)
+	if err != nil {
+		return nil, "", fmt.Errorf("error finding refresh token owner: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, "", fmt.Errorf("error committing transaction: %w", err)
+	}
+	return &user, current.FamilyID, nil
+}
+
+// revokeFamilyQuery revokes a refresh token family and the session it
+// belongs to.
+const revokeFamilyQuery = `
+	WITH tokens AS (
+		UPDATE refresh_tokens SET revoked_at = NOW()
+		WHERE family_id = $1 AND revoked_at IS NULL
+	)
+	UPDATE sessions SET revoked_at = NOW()
+	WHERE id = $1 AND revoked_at IS NULL;
+	`
+
+func RevokeRefreshTokenFamily(ctx context.Context, db *sql.DB, familyID string) error {
+	_, err := db.ExecContext(ctx, revokeFamilyQuery, familyID)
+	if err != nil {
+		return fmt.Errorf("error revoking token family: %w", err)
+	}
+	return nil
+}
+
+// RevokeRefreshToken revokes the family of the refresh token identified by
+// tokenHash, ending the session chained from the same login.
+func RevokeRefreshToken(ctx context.Context, db *sql.DB, tokenHash string) error {
+	query := `
+	WITH family AS (
+		SELECT family_id FROM refresh_tokens WHERE token_hash = $1
+	), tokens AS (
+		UPDATE refresh_tokens SET revoked_at = NOW()
+		WHERE family_id IN (SELECT family_id FROM family) AND revoked_at IS NULL
+	)
+	UPDATE sessions SET revoked_at = NOW()
+	WHERE id IN (SELECT family_id FROM family) AND revoked_at IS NULL;
+	`
+	_, err := db.ExecContext(ctx, query, tokenHash)
+	if err != nil {
+		return fmt.Errorf("error revoking refresh token: %w", err)
+	}
+	return nil
+}
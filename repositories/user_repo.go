@@ -5,16 +5,55 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"log"
+	"sync"
 
 	"github.com/Somvaded/assessment/models"
 	"github.com/Somvaded/assessment/utils"
 )
 
+var (
+	ErrAccountInactive    = errors.New("account is not active")
+	ErrInvalidCredentials = errors.New("invalid email or password")
+)
+
+var (
+	dummyHashOnce sync.Once
+	dummyHash     string
+)
+
+// dummyPasswordHash is compared against when no account matches the email so
+// that unknown and known addresses take the same time to reject.
+func dummyPasswordHash() string {
+	dummyHashOnce.Do(func() {
+		dummyHash, _ = utils.HashPassword("dummy-password-for-timing")
+	})
+	return dummyHash
+}
+
+// rehashPassword replaces a legacy or weaker hash with one made by the
+// current hasher. Login goes ahead with the old hash if this fails.
+func rehashPassword(ctx context.Context, db *sql.DB, user *models.User, password string) {
+	hash, err := utils.HashPassword(password)
+	if err != nil {
+		return
+	}
+	_, err = db.ExecContext(ctx, `
+	UPDATE users SET password_hash = $1
+	WHERE id = $2 AND password_hash = $3;
+	`, hash, user.ID, user.PasswordHash)
+	if err != nil {
+		log.Println("Error upgrading password hash:", err)
+		return
+	}
+	user.PasswordHash = hash
+}
+
 func FindUserByEmail(ctx context.Context,db *sql.DB, email string,password string) (*models.User, *models.Doctor, *models.Receptionist, error) {
 	
 	query := `
 	SELECT 
-	u.id, u.email, u.role,u.password_hash,
+	u.id, u.email, u.role, u.status, u.password_hash,
 		d.name, d.specialty, d.emergency_contact, d.license_number, d.experience_years,d.created_at, d.updated_at,
 		r.name, r.phone,r.created_at, r.updated_at
 	FROM users u
@@ -45,6 +84,7 @@ func FindUserByEmail(ctx context.Context,db *sql.DB, email string,password strin
 		&user.ID,
 		&user.Email,
 		&user.Role,
+		&user.Status,
 		&user.PasswordHash,
 
 		&nullDoctorName,
@@ -63,14 +103,21 @@ func FindUserByEmail(ctx context.Context,db *sql.DB, email string,password strin
 
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			return nil, nil, nil, fmt.Errorf("no user found %w",err)
+			utils.ComparePassword(dummyPasswordHash(), password)
+			return nil, nil, nil, ErrInvalidCredentials
 		}
 		return nil, nil, nil, err
 	}
 
 	err = utils.ComparePassword(user.PasswordHash, password)
 	if err != nil {
-		return nil, nil, nil, fmt.Errorf("error comparing password %w", err)
+		return nil, nil, nil, ErrInvalidCredentials
+	}
+	if user.Status != models.StatusActive {
+		return nil, nil, nil, ErrAccountInactive
+	}
+	if utils.PasswordNeedsRehash(user.PasswordHash) {
+		rehashPassword(ctx, db, &user, password)
 	}
 	var doctorProfile *models.Doctor
 	if user.Role == "doctor" {
@@ -102,4 +149,32 @@ func FindUserByEmail(ctx context.Context,db *sql.DB, email string,password strin
 	return &user, doctorProfile, receptionistProfile, nil
 }
 
+// UserStatusStore is what Protect needs to turn away users whose account
+// stopped being active after their access token was issued.
+type UserStatusStore interface {
+	// Status returns the account's status, or ErrStaffNotFound when the
+	// user does not exist.
+	Status(ctx context.Context, userID int) (string, error)
+}
+
+type PostgresUserStatusStore struct {
+	DB *sql.DB
+}
+
+func NewPostgresUserStatusStore(db *sql.DB) *PostgresUserStatusStore {
+	return &PostgresUserStatusStore{
+		DB: db,
+	}
+}
 
+func (s *PostgresUserStatusStore) Status(ctx context.Context, userID int) (string, error) {
+	var status string
+	err := s.DB.QueryRowContext(ctx, `SELECT status FROM users WHERE id = $1;`, userID).Scan(&status)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", ErrStaffNotFound
+		}
+		return "", fmt.Errorf("error fetching user status: %w", err)
+	}
+	return status, nil
+}
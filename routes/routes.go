@@ -2,16 +2,94 @@ package routes
 
 import (
 	"database/sql"
+	"log"
+	"time"
 
+	"github.com/Somvaded/assessment/config"
 	"github.com/Somvaded/assessment/handlers"
+	"github.com/Somvaded/assessment/mailer"
 	"github.com/Somvaded/assessment/middlewares"
+	"github.com/Somvaded/assessment/models"
+	"github.com/Somvaded/assessment/oidc"
+	"github.com/Somvaded/assessment/repositories"
+	"github.com/Somvaded/assessment/utils"
 	"github.com/gin-gonic/gin"
 )
 
-func RegisterRoutes(router *gin.Engine, db *sql.DB){
-	userHandlers := handlers.NewUserHandler(db)
+func RegisterRoutes(router *gin.Engine, db *sql.DB, cfg *config.Config){
+	var revocations repositories.TokenRevocationStore
+	if cfg.TokenRevocationStore == "memory" {
+		revocations = repositories.NewMemoryRevocationStore()
+	} else {
+		revocations = repositories.NewPostgresRevocationStore(db)
+	}
+	permissions := repositories.NewPermissionResolver(db, cfg.PermissionCacheTTL)
+	clinicTZ, err := time.LoadLocation(cfg.ClinicTimezone)
+	if err != nil {
+		log.Fatalf("Invalid CLINIC_TIMEZONE: %v", err)
+	}
+	accessPolicy, err := utils.LoadAccessPolicy(cfg.AccessPolicyFile, clinicTZ)
+	if err != nil {
+		log.Fatalf("Could not load ACCESS_POLICY_FILE: %v", err)
+	}
+	protect := middlewares.Protect(middlewares.ProtectOptions{
+		Revocations:     revocations,
+		TokenSources:    cfg.AuthTokenSources,
+		APIKeys:         repositories.NewPostgresAPIKeyStore(db),
+		Permissions:     permissions,
+		Sessions:        repositories.NewPostgresSessionStore(db),
+		Users:           repositories.NewPostgresUserStatusStore(db),
+		AccessPolicy:    accessPolicy,
+		AccessOverrides: repositories.NewPostgresAccessOverrideStore(db),
+		Audit:           repositories.NewPostgresAuditRecorder(db),
+	})
+	can := middlewares.RequirePermission
+
+	var mail mailer.Mailer
+	if cfg.MailDriver == "smtp" {
+		mail = mailer.NewSMTPMailer(cfg.SMTPHost, cfg.SMTPPort, cfg.SMTPUsername, cfg.SMTPPassword, cfg.MailFrom)
+	} else {
+		mail = mailer.NewOutboxMailer(cfg.MailOutboxDir, cfg.MailFrom)
+	}
+
+	var loginAttempts repositories.LoginAttemptStore
+	if cfg.LoginAttemptStore == "memory" {
+		loginAttempts = repositories.NewMemoryLoginAttemptStore()
+	} else {
+		loginAttempts = repositories.NewPostgresLoginAttemptStore(db)
+	}
+	accountPolicy := utils.ThrottlePolicy{
+		FreeAttempts:     cfg.LoginFreeAttempts,
+		BaseDelay:        cfg.LoginBackoffBase,
+		MaxDelay:         cfg.LoginBackoffMax,
+		LockoutThreshold: cfg.LoginMaxFailures,
+		LockoutDuration:  cfg.LoginLockoutDuration,
+		Window:           cfg.LoginFailureWindow,
+	}
+	ipPolicy := accountPolicy
+	ipPolicy.FreeAttempts = cfg.LoginFreeAttempts * 5
+	ipPolicy.LockoutThreshold = cfg.LoginIPMaxFailures
+	throttle := &handlers.LoginThrottle{
+		Store:   loginAttempts,
+		Account: accountPolicy,
+		IP:      ipPolicy,
+	}
+
+	passwordPolicy := utils.PasswordPolicy{
+		MinLength:       cfg.PasswordMinLength,
+		RequiredClasses: cfg.PasswordRequiredClasses,
+		History:         cfg.PasswordHistory,
+		MaxAge:          cfg.PasswordMaxAge,
+	}
+
+	userHandlers := handlers.NewUserHandler(db, cfg, revocations, throttle, passwordPolicy)
+	passwordHandlers := handlers.NewPasswordHandler(db, mail, cfg, passwordPolicy, throttle)
+	mfaHandlers := handlers.NewMFAHandler(db, cfg)
 	receptionistHandlers := handlers.NewReceptionistHandler(db)
-	doctorHandlers := handlers.NewDoctorHandler(db)
+	doctorHandlers := handlers.NewDoctorHandler(db, mail, cfg)
+	adminHandlers := handlers.NewAdminHandler(db, throttle, permissions, passwordPolicy)
+	sessionHandlers := handlers.NewSessionHandler(db)
+	integrationHandlers := handlers.NewIntegrationHandler(db)
 	
 	router.Use(gin.Logger())
 	router.Use(gin.Recovery())
@@ -20,20 +98,101 @@ func RegisterRoutes(router *gin.Engine, db *sql.DB){
 	router.GET("/health", func(ctx *gin.Context) {
 		ctx.JSON(200, gin.H{"status": "ok"})
 	})
+	router.GET("/.well-known/jwks.json", func(ctx *gin.Context) {
+		ctx.Header("Cache-Control", "public, max-age=300")
+		ctx.JSON(200, utils.JWKS())
+	})
 	
 	// User login 
 	userPath := router.Group("/api")
 	userPath.POST("/login",userHandlers.Login)
+	userPath.POST("/login/mfa",userHandlers.LoginMFA)
+	sessionCSRF := middlewares.RequireCSRFForCookies("auth_token","refresh_token")
+	userPath.POST("/refresh",sessionCSRF,userHandlers.Refresh)
+	userPath.POST("/logout",sessionCSRF,userHandlers.Logout)
+	userPath.POST("/password/forgot",passwordHandlers.ForgotPassword)
+	userPath.POST("/password/reset",passwordHandlers.ResetPassword)
+
+	// Single sign-on
+	if cfg.OIDCIssuer != "" {
+		oidcHandlers := handlers.NewOIDCHandler(userHandlers, oidc.NewProvider(oidc.Config{
+			Issuer:       cfg.OIDCIssuer,
+			ClientID:     cfg.OIDCClientID,
+			ClientSecret: cfg.OIDCClientSecret,
+			RedirectURL:  cfg.OIDCRedirectURL,
+			Scopes:       cfg.OIDCScopes,
+		}))
+		userPath.GET("/auth/oidc/login",oidcHandlers.Login)
+		userPath.GET("/auth/oidc/callback",oidcHandlers.Callback)
+	}
+
+	//signed-in user's own account; reachable with an expired password
+	fresh := middlewares.PasswordNotExpired()
+	csrf := middlewares.RequireCSRF()
+	mePath := router.Group("/api/me",protect,csrf,middlewares.UsersOnly())
+	mePath.GET("/sessions",sessionHandlers.ListSessions)
+	mePath.DELETE("/sessions/:id",sessionHandlers.RevokeSession)
+	mePath.PUT("/password",userHandlers.ChangePassword)
 
 	//recetionist routes
-	receptionistPath := router.Group("/api/receptionist",middlewares.Protect(),middlewares.CheckRole("receptionist"))
-	receptionistPath.POST("/",receptionistHandlers.InsertPatient)
-	receptionistPath.GET("/:aadharid",receptionistHandlers.FindPatient)
-	receptionistPath.PUT("/:patientid",receptionistHandlers.UpdatePatient)
-	receptionistPath.DELETE("/:patientid",receptionistHandlers.DeletePatient)
-
-	//doctor routes
-	doctorPath := router.Group("/api/doctor",middlewares.Protect(),middlewares.CheckRole("doctor"))
-	doctorPath.GET("/myPatients",doctorHandlers.GetAllPatientsAssigned)
-	doctorPath.PATCH("/:patientid",doctorHandlers.UpdatePatientDetail)
-} 
\ No newline at end of file
+	receptionistPath := router.Group("/api/receptionist",protect,csrf,fresh)
+	receptionistPath.POST("/",can(models.PermPatientCreate),receptionistHandlers.InsertPatient)
+	receptionistPath.GET("/patients",can(models.PermPatientRead),receptionistHandlers.SearchPatients)
+	receptionistPath.GET("/patients/:patientid/history",can(models.PermPatientRead),receptionistHandlers.PatientHistory)
+	receptionistPath.GET("/patients/:patientid/history/:rev/diff",can(models.PermPatientRead),receptionistHandlers.PatientRevisionDiff)
+	receptionistPath.GET("/:aadharid",can(models.PermPatientRead),receptionistHandlers.FindPatient)
+	receptionistPath.PUT("/:patientid",can(models.PermPatientUpdate),receptionistHandlers.UpdatePatient)
+	receptionistPath.PATCH("/:patientid",can(models.PermPatientUpdate),receptionistHandlers.PatchPatient)
+	receptionistPath.DELETE("/:patientid",can(models.PermPatientDelete),receptionistHandlers.DeletePatient)
+	receptionistPath.POST("/:patientid/restore",can(models.PermPatientDelete),receptionistHandlers.RestorePatient)
+
+	//doctor routes; they act on the signed-in doctor's patients, so API keys
+	//have no doctor to act as
+	doctorPath := router.Group("/api/doctor",protect,csrf,fresh,middlewares.UsersOnly())
+	doctorPath.GET("/myPatients",can(models.PermMedicalRead),doctorHandlers.GetAllPatientsAssigned)
+	doctorPath.GET("/patients/:patientid",can(models.PermMedicalRead),doctorHandlers.GetPatient)
+	doctorPath.GET("/patients/:patientid/history",can(models.PermMedicalRead),doctorHandlers.PatientHistory)
+	doctorPath.GET("/patients/:patientid/history/:rev/diff",can(models.PermMedicalRead),doctorHandlers.PatientRevisionDiff)
+	doctorPath.PATCH("/:patientid",can(models.PermMedicalUpdate),doctorHandlers.UpdatePatientDetail)
+	doctorPath.POST("/emergency-access",can(models.PermEmergency),doctorHandlers.RequestEmergencyAccess)
+	doctorPath.POST("/delegations",can(models.PermDelegate),doctorHandlers.CreateDelegation)
+	doctorPath.GET("/delegations",can(models.PermDelegate),doctorHandlers.ListDelegations)
+	doctorPath.DELETE("/delegations/:delegationid",can(models.PermDelegate),doctorHandlers.RevokeDelegation)
+
+	//machine integrations such as lab analyzers; API keys only, since these
+	//routes are not limited to a doctor's own patients
+	integrationPath := router.Group("/api/integrations",protect,middlewares.APIKeysOnly())
+	integrationPath.GET("/patients/:patientid",can(models.PermMedicalRead),integrationHandlers.GetPatient)
+	integrationPath.PUT("/patients/:patientid/medical",can(models.PermMedicalUpdate),integrationHandlers.PushMedicalInfo)
+
+	//doctor MFA enrolment
+	mfaPath := router.Group("/api/mfa",protect,csrf,fresh,middlewares.UsersOnly(),can(models.PermMFAManage))
+	mfaPath.POST("/enroll",mfaHandlers.Enroll)
+	mfaPath.POST("/confirm",mfaHandlers.Confirm)
+	mfaPath.POST("/disable",mfaHandlers.Disable)
+
+	//admin routes
+	adminPath := router.Group("/api/admin",protect,csrf,fresh,middlewares.UsersOnly())
+	adminPath.POST("/staff",can(models.PermStaffManage),adminHandlers.CreateStaff)
+	adminPath.GET("/staff",can(models.PermStaffManage),adminHandlers.ListStaff)
+	adminPath.GET("/staff/:userid",can(models.PermStaffManage),adminHandlers.GetStaff)
+	adminPath.PUT("/staff/:userid",can(models.PermStaffManage),adminHandlers.UpdateStaff)
+	adminPath.DELETE("/staff/:userid",can(models.PermStaffManage),adminHandlers.DeactivateStaff)
+	adminPath.PUT("/staff/:userid/status",can(models.PermStaffManage),adminHandlers.SetStaffStatus)
+	adminPath.DELETE("/staff/:userid/sessions",can(models.PermStaffManage),adminHandlers.RevokeStaffSessions)
+	adminPath.POST("/staff/:userid/unlock",can(models.PermLockoutManage),adminHandlers.UnlockStaff)
+	adminPath.DELETE("/lockouts/ip/:ip",can(models.PermLockoutManage),adminHandlers.UnlockIP)
+	adminPath.POST("/api-keys",can(models.PermAPIKeyManage),adminHandlers.CreateAPIKey)
+	adminPath.GET("/api-keys",can(models.PermAPIKeyManage),adminHandlers.ListAPIKeys)
+	adminPath.DELETE("/api-keys/:keyid",can(models.PermAPIKeyManage),adminHandlers.RevokeAPIKey)
+	adminPath.GET("/roles",can(models.PermRoleManage),adminHandlers.ListRoles)
+	adminPath.GET("/permissions",can(models.PermRoleManage),adminHandlers.ListPermissions)
+	adminPath.PUT("/roles/:role/permissions",can(models.PermRoleManage),adminHandlers.SetRolePermissions)
+	adminPath.GET("/staff/:userid/roles",can(models.PermRoleManage),adminHandlers.GetUserRoles)
+	adminPath.PUT("/staff/:userid/roles",can(models.PermRoleManage),adminHandlers.SetUserRoles)
+	adminPath.GET("/audit",can(models.PermAuditRead),adminHandlers.ListAuditLog)
+	adminPath.GET("/emergency-access",can(models.PermAuditRead),adminHandlers.ListEmergencyGrants)
+	adminPath.POST("/access-overrides",can(models.PermAccessPolicy),adminHandlers.CreateAccessOverride)
+	adminPath.GET("/access-overrides",can(models.PermAccessPolicy),adminHandlers.ListAccessOverrides)
+	adminPath.DELETE("/access-overrides/:overrideid",can(models.PermAccessPolicy),adminHandlers.RevokeAccessOverride)
+}
\ No newline at end of file
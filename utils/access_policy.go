@@ -0,0 +1,172 @@
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+var (
+	ErrAccessNetwork = errors.New("role may not be used from this network")
+	ErrAccessHours   = errors.New("role may not be used at this time")
+)
+
+// AccessPolicy restricts roles to network ranges and working hours. Roles
+// without a rule are unrestricted. Times are evaluated in Location.
+type AccessPolicy struct {
+	Location *time.Location
+	Roles    map[string]RoleAccessRule
+}
+
+// RoleAccessRule lists where and when a role may be used. An empty
+// Networks or Windows list places no restriction of that kind.
+type RoleAccessRule struct {
+	Networks []*net.IPNet
+	Windows  []TimeWindow
+}
+
+// TimeWindow is a daily period from Start to End, both measured from
+// midnight, on the listed Days. A window whose End is not after its Start
+// runs past midnight into the next day, as night shifts do.
+type TimeWindow struct {
+	Days  []time.Weekday
+	Start time.Duration
+	End   time.Duration
+}
+
+// accessPolicyFile is the JSON layout read by LoadAccessPolicy, e.g.
+//
+//	{
+//	  "receptionist": {
+//	    "networks": ["10.20.0.0/16"],
+//	    "hours": [{"days": ["mon", "tue", "wed", "thu", "fri"], "from": "08:00", "to": "20:00"}]
+//	  }
+//	}
+type accessPolicyFile map[string]struct {
+	Networks []string `json:"networks"`
+	Hours    []struct {
+		Days []string `json:"days"`
+		From string   `json:"from"`
+		To   string   `json:"to"`
+	} `json:"hours"`
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// LoadAccessPolicy reads the role rules in path, evaluated in loc. An empty
+// path returns a nil policy, which allows everything.
+func LoadAccessPolicy(path string, loc *time.Location) (*AccessPolicy, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading access policy: %w", err)
+	}
+	return ParseAccessPolicy(data, loc)
+}
+
+// ParseAccessPolicy parses the JSON format read by LoadAccessPolicy.
+func ParseAccessPolicy(data []byte, loc *time.Location) (*AccessPolicy, error) {
+	var file accessPolicyFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("error parsing access policy: %w", err)
+	}
+	if loc == nil {
+		loc = time.UTC
+	}
+
+	policy := &AccessPolicy{Location: loc, Roles: map[string]RoleAccessRule{}}
+	for role, raw := range file {
+		var rule RoleAccessRule
+		for _, cidr := range raw.Networks {
+			_, network, err := net.ParseCIDR(cidr)
+			if err != nil {
+				return nil, fmt.Errorf("access policy for %s: invalid network %q", role, cidr)
+			}
+			rule.Networks = append(rule.Networks, network)
+		}
+		for _, hours := range raw.Hours {
+			var window TimeWindow
+			for _, day := range hours.Days {
+				weekday, ok := weekdays[strings.ToLower(day)]
+				if !ok {
+					return nil, fmt.Errorf("access policy for %s: invalid day %q", role, day)
+				}
+				window.Days = append(window.Days, weekday)
+			}
+			if len(window.Days) == 0 {
+				window.Days = []time.Weekday{time.Sunday, time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday, time.Saturday}
+			}
+			var err error
+			if window.Start, err = parseClock(hours.From); err != nil {
+				return nil, fmt.Errorf("access policy for %s: %w", role, err)
+			}
+			if window.End, err = parseClock(hours.To); err != nil {
+				return nil, fmt.Errorf("access policy for %s: %w", role, err)
+			}
+			rule.Windows = append(rule.Windows, window)
+		}
+		policy.Roles[role] = rule
+	}
+	return policy, nil
+}
+
+// parseClock parses "HH:MM" into the time since midnight. "24:00" is
+// accepted as the end of the day.
+func parseClock(clock string) (time.Duration, error) {
+	var hours, minutes int
+	if _, err := fmt.Sscanf(clock, "%d:%d", &hours, &minutes); err != nil ||
+		hours < 0 || minutes < 0 || minutes > 59 || hours > 24 || (hours == 24 && minutes != 0) {
+		return 0, fmt.Errorf("invalid time %q, want HH:MM", clock)
+	}
+	return time.Duration(hours)*time.Hour + time.Duration(minutes)*time.Minute, nil
+}
+
+// Check returns nil when role may be used from ip at now, otherwise
+// ErrAccessNetwork or ErrAccessHours. A nil policy allows everything.
+func (p *AccessPolicy) Check(role string, ip net.IP, now time.Time) error {
+	if p == nil {
+		return nil
+	}
+	rule, ok := p.Roles[role]
+	if !ok {
+		return nil
+	}
+	if len(rule.Networks) > 0 && !slices.ContainsFunc(rule.Networks, func(n *net.IPNet) bool { return ip != nil && n.Contains(ip) }) {
+		return ErrAccessNetwork
+	}
+	if len(rule.Windows) > 0 {
+		local := now.In(p.Location)
+		if !slices.ContainsFunc(rule.Windows, func(w TimeWindow) bool { return w.contains(local) }) {
+			return ErrAccessHours
+		}
+	}
+	return nil
+}
+
+func (w TimeWindow) contains(t time.Time) bool {
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	sinceMidnight := t.Sub(midnight)
+	if w.Start < w.End {
+		return slices.Contains(w.Days, t.Weekday()) && sinceMidnight >= w.Start && sinceMidnight < w.End
+	}
+	// Overnight window: the evening belongs to today's entry, the early
+	// morning to yesterday's.
+	yesterday := (t.Weekday() + 6) % 7
+	return (slices.Contains(w.Days, t.Weekday()) && sinceMidnight >= w.Start) ||
+		(slices.Contains(w.Days, yesterday) && sinceMidnight < w.End)
+}
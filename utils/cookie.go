@@ -0,0 +1,61 @@
+package utils
+
+import (
+	"net/http"
+	"strings"
+)
+
+// CookieOptions holds the attributes shared by every cookie the API sets.
+type CookieOptions struct {
+	Secure   bool
+	SameSite http.SameSite
+	Domain   string
+}
+
+// cookies is applied by SetCookie. Until SetCookieOptions is called cookies
+// are sent over plain HTTP with SameSite=Lax, for local development.
+var cookies = CookieOptions{SameSite: http.SameSiteLaxMode}
+
+// SetCookieOptions replaces the attributes used by SetCookie and returns
+// the previous ones.
+func SetCookieOptions(o CookieOptions) CookieOptions {
+	prev := cookies
+	cookies = o
+	return prev
+}
+
+// Cookies returns the attributes currently used by SetCookie.
+func Cookies() CookieOptions {
+	return cookies
+}
+
+// ParseSameSite maps "strict", "lax" or "none" to its http.SameSite mode.
+// Anything else yields Lax.
+func ParseSameSite(value string) http.SameSite {
+	switch strings.ToLower(value) {
+	case "strict":
+		return http.SameSiteStrictMode
+	case "none":
+		return http.SameSiteNoneMode
+	}
+	return http.SameSiteLaxMode
+}
+
+// Set writes a cookie with o's attributes. A negative maxAge deletes it.
+func (o CookieOptions) Set(w http.ResponseWriter, name string, value string, maxAge int, path string, httpOnly bool) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     name,
+		Value:    value,
+		MaxAge:   maxAge,
+		Path:     path,
+		Domain:   o.Domain,
+		Secure:   o.Secure,
+		HttpOnly: httpOnly,
+		SameSite: o.SameSite,
+	})
+}
+
+// SetCookie writes a cookie with the configured attributes.
+func SetCookie(w http.ResponseWriter, name string, value string, maxAge int, path string, httpOnly bool) {
+	cookies.Set(w, name, value, maxAge, path, httpOnly)
+}
@@ -0,0 +1,55 @@
+package utils
+
+import "strings"
+
+// DeviceName derives a short, human readable label such as "Firefox on
+// Windows" from a User-Agent header, for listing a user's sessions. It
+// returns "Unknown device" when nothing is recognised.
+func DeviceName(userAgent string) string {
+	ua := strings.ToLower(userAgent)
+
+	// Order matters: Edge and Opera also announce Chrome, and Chrome also
+	// announces Safari.
+	browser := ""
+	for _, b := range []struct{ token, name string }{
+		{"edg/", "Edge"},
+		{"opr/", "Opera"},
+		{"firefox/", "Firefox"},
+		{"chrome/", "Chrome"},
+		{"safari/", "Safari"},
+		{"postmanruntime/", "Postman"},
+		{"curl/", "curl"},
+		{"okhttp/", "Android app"},
+	} {
+		if strings.Contains(ua, b.token) {
+			browser = b.name
+			break
+		}
+	}
+
+	platform := ""
+	for _, p := range []struct{ token, name string }{
+		{"android", "Android"},
+		{"iphone", "iOS"},
+		{"ipad", "iOS"},
+		{"windows", "Windows"},
+		{"mac os x", "macOS"},
+		{"cros", "ChromeOS"},
+		{"linux", "Linux"},
+	} {
+		if strings.Contains(ua, p.token) {
+			platform = p.name
+			break
+		}
+	}
+
+	switch {
+	case browser != "" && platform != "":
+		return browser + " on " + platform
+	case browser != "":
+		return browser
+	case platform != "":
+		return platform
+	}
+	return "Unknown device"
+}
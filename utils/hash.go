@@ -1,24 +1,212 @@
 package utils
 
 import (
-	"golang.org/x/crypto/bcrypt"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
 	"log"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	ErrPasswordMismatch    = errors.New("password does not match")
+	ErrUnknownPasswordHash = errors.New("unrecognised password hash format")
 )
 
+// PasswordHasher creates password hashes and checks passwords against them.
+// Verify accepts every supported format, so switching hashers never locks
+// out users whose hash was made by another one.
+type PasswordHasher interface {
+	Hash(password string) (string, error)
+	// Verify returns nil when password matches hash, ErrPasswordMismatch
+	// when it does not.
+	Verify(hash string, password string) error
+	// NeedsRehash reports whether hash was made by another algorithm or
+	// with weaker parameters than this hasher currently uses.
+	NeedsRehash(hash string) bool
+}
+
+// Argon2idHasher hashes with Argon2id and encodes results in the PHC string
+// format: $argon2id$v=19$m=<KiB>,t=<iterations>,p=<threads>$<salt>$<key>.
+type Argon2idHasher struct {
+	Memory     uint32 // KiB
+	Iterations uint32
+	Threads    uint8
+	SaltLength uint32
+	KeyLength  uint32
+}
+
+// NewArgon2idHasher returns a hasher with 16 byte salts and 32 byte keys.
+// Zero cost parameters fall back to 64 MiB, 3 iterations and 2 threads.
+func NewArgon2idHasher(memory uint32, iterations uint32, threads uint8) *Argon2idHasher {
+	if memory == 0 {
+		memory = 64 * 1024
+	}
+	if iterations == 0 {
+		iterations = 3
+	}
+	if threads == 0 {
+		threads = 2
+	}
+	return &Argon2idHasher{
+		Memory:     memory,
+		Iterations: iterations,
+		Threads:    threads,
+		SaltLength: 16,
+		KeyLength:  32,
+	}
+}
+
+func (h *Argon2idHasher) Hash(password string) (string, error) {
+	salt := make([]byte, h.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, h.Iterations, h.Memory, h.Threads, h.KeyLength)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, h.Memory, h.Iterations, h.Threads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+func (h *Argon2idHasher) Verify(hash string, password string) error {
+	return verifyPassword(hash, password)
+}
+
+func (h *Argon2idHasher) NeedsRehash(hash string) bool {
+	params, err := parseArgon2id(hash)
+	if err != nil {
+		return true
+	}
+	return params.memory < h.Memory || params.iterations < h.Iterations || params.threads < h.Threads ||
+		uint32(len(params.key)) < h.KeyLength
+}
+
+// BcryptHasher hashes with bcrypt. bcrypt only reads the first 72 bytes of
+// a password; it is kept for deployments that must stay on it.
+type BcryptHasher struct {
+	Cost int
+}
+
+func NewBcryptHasher(cost int) *BcryptHasher {
+	if cost == 0 {
+		cost = bcrypt.DefaultCost
+	}
+	return &BcryptHasher{
+		Cost: cost,
+	}
+}
+
+func (h *BcryptHasher) Hash(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), h.Cost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+func (h *BcryptHasher) Verify(hash string, password string) error {
+	return verifyPassword(hash, password)
+}
+
+func (h *BcryptHasher) NeedsRehash(hash string) bool {
+	cost, err := bcrypt.Cost([]byte(hash))
+	return err != nil || cost < h.Cost
+}
+
+// verifyPassword checks password against an Argon2id or bcrypt hash,
+// whichever format hash is in.
+func verifyPassword(hash string, password string) error {
+	switch {
+	case strings.HasPrefix(hash, "$argon2id$"):
+		params, err := parseArgon2id(hash)
+		if err != nil {
+			return err
+		}
+		key := argon2.IDKey([]byte(password), params.salt, params.iterations, params.memory, params.threads, uint32(len(params.key)))
+		if subtle.ConstantTimeCompare(key, params.key) != 1 {
+			return ErrPasswordMismatch
+		}
+		return nil
+	case strings.HasPrefix(hash, "$2"):
+		err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return ErrPasswordMismatch
+		}
+		return err
+	}
+	return ErrUnknownPasswordHash
+}
+
+type argon2idParams struct {
+	memory     uint32
+	iterations uint32
+	threads    uint8
+	salt       []byte
+	key        []byte
+}
+
+func parseArgon2id(hash string) (*argon2idParams, error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return nil, ErrUnknownPasswordHash
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return nil, ErrUnknownPasswordHash
+	}
+	var params argon2idParams
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.memory, &params.iterations, &params.threads); err != nil {
+		return nil, ErrUnknownPasswordHash
+	}
+	var err error
+	if params.salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return nil, ErrUnknownPasswordHash
+	}
+	if params.key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil || len(params.key) == 0 {
+		return nil, ErrUnknownPasswordHash
+	}
+	return &params, nil
+}
+
+// hasher makes every hash produced by HashPassword. Until SetPasswordHasher
+// is called it uses Argon2id with the default parameters.
+var hasher PasswordHasher = NewArgon2idHasher(0, 0, 0)
+
+// SetPasswordHasher replaces the hasher used by HashPassword and
+// PasswordNeedsRehash and returns the previous one.
+func SetPasswordHasher(h PasswordHasher) PasswordHasher {
+	prev := hasher
+	hasher = h
+	return prev
+}
+
 func HashPassword(password string) (string, error) {
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	hashedPassword, err := hasher.Hash(password)
 	if err != nil {
 		log.Println("Error hashing password:", err)
 		return "", err
 	}
-	return string(hashedPassword), nil
+	return hashedPassword, nil
 }
 
 
 func ComparePassword(hashedPassword, password string) error {
-	err := bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password))
+	err := hasher.Verify(hashedPassword, password)
 	if err != nil {
 		log.Println("Error comparing password:", err)
 	}
 	return err
 }
+
+// PasswordNeedsRehash reports whether a hash that just verified should be
+// replaced with one made by the current hasher.
+func PasswordNeedsRehash(hashedPassword string) bool {
+	return hasher.NeedsRehash(hashedPassword)
+}
@@ -1,7 +1,6 @@
 package utils
 
 import (
-	"errors"
 	"os"
 	"time"
 
@@ -9,36 +8,72 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 )
 
-var jwtSecret = []byte(os.Getenv("JWT_SECRET"))
+// keys signs and verifies every token issued by this package. Until
+// SetKeyManager is called it signs with HS256 using JWT_SECRET.
+var keys = &KeyManager{opts: KeyManagerOptions{
+	Algorithm:    AlgHS256,
+	LegacySecret: []byte(os.Getenv("JWT_SECRET")),
+}}
 
-func GenerateJWT(userID int, role string) (string, error) {
+// SetKeyManager replaces the key manager used by GenerateJWT and VerifyJWT
+// and returns the previous one.
+func SetKeyManager(m *KeyManager) *KeyManager {
+	prev := keys
+	keys = m
+	return prev
+}
 
-	claims := &models.Claims{
-		UserID: userID,
-		Role:   role,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-		},
-	}
+// JWKS returns the public keys tokens can currently be verified with.
+func JWKS() JWKSet {
+	return keys.JWKS()
+}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(jwtSecret)
+// AccessTokenTTL is the lifetime of tokens issued by GenerateJWT. Access
+// tokens are kept short-lived; sessions are extended with refresh tokens.
+var AccessTokenTTL = 15 * time.Minute
+
+// MFATokenTTL bounds how long a user has to complete the second login step
+// after their password was accepted.
+var MFATokenTTL = 5 * time.Minute
+
+// GenerateJWT issues an access token. roles lists every role the user
+// holds; when omitted the token carries only the primary role.
+func GenerateJWT(userID int, role string, roles ...string) (string, error) {
+	return signToken(&models.Claims{UserID: userID, Role: role, Roles: roles}, AccessTokenTTL)
 }
 
-func VerifyJWT(tokenString string) (*models.Claims, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &models.Claims{}, func(token *jwt.Token) (interface{}, error) {
-		return jwtSecret, nil
-	})
+// GenerateSessionJWT issues an access token from claims, which name the
+// user, their roles and the session the token is bound to. The token stops
+// being accepted once that session is revoked.
+func GenerateSessionJWT(claims models.Claims) (string, error) {
+	claims.Purpose = ""
+	return signToken(&claims, AccessTokenTTL)
+}
+
+// GenerateMFAToken issues the intermediate token returned by the password
+// step of an MFA login. Its purpose claim keeps Protect from accepting it
+// as an access token.
+func GenerateMFAToken(userID int, role string) (string, error) {
+	return signToken(&models.Claims{UserID: userID, Role: role, Purpose: models.PurposeMFA}, MFATokenTTL)
+}
 
+// signToken assigns claims a fresh jti and a lifetime of ttl and signs them.
+func signToken(claims *models.Claims, ttl time.Duration) (string, error) {
+	jti, err := GenerateOpaqueToken(16)
 	if err != nil {
-		return nil, err
+		return "", err
 	}
 
-	claims, ok := token.Claims.(*models.Claims)
-	if !ok || !token.Valid {
-		return nil, errors.New("invalid token")
+	claims.RegisteredClaims = jwt.RegisteredClaims{
+		ID:        jti,
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(ttl)),
+		IssuedAt:  jwt.NewNumericDate(time.Now()),
 	}
+	return keys.Sign(claims)
+}
 
-	return claims, nil
+// VerifyJWT checks tokenString against the key named by its kid header, or
+// against the HS256 secret during the migration window.
+func VerifyJWT(tokenString string) (*models.Claims, error) {
+	return keys.Verify(tokenString)
 }
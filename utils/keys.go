@@ -0,0 +1,418 @@
+package utils
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Somvaded/assessment/models"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	AlgHS256 = "HS256"
+	AlgRS256 = "RS256"
+	AlgEdDSA = "EdDSA"
+)
+
+// SigningKey is one asymmetric key known to a KeyManager. Only the newest
+// key signs; older keys stay available for verification until every token
+// they signed has expired.
+type SigningKey struct {
+	ID        string
+	Algorithm string
+	Private   crypto.Signer
+	CreatedAt time.Time
+}
+
+func (k *SigningKey) public() crypto.PublicKey {
+	return k.Private.Public()
+}
+
+// KeyManagerOptions configures NewKeyManager.
+type KeyManagerOptions struct {
+	// Algorithm used for new tokens: AlgRS256, AlgEdDSA or AlgHS256.
+	Algorithm string
+	// LegacySecret verifies (and, with AlgHS256, signs) HS256 tokens.
+	LegacySecret []byte
+	// LegacyUntil is the end of the migration window during which HS256
+	// tokens are still accepted when Algorithm is asymmetric.
+	LegacyUntil time.Time
+	// Dir, when set, is where keys are loaded from and rotated keys are
+	// written to as PKCS#8 PEM files named <kid>.pem. Instances sharing the
+	// directory share their keys.
+	Dir string
+	// Retention is how long a key is kept for verification after a newer
+	// key replaced it. It must exceed the longest token lifetime.
+	Retention time.Duration
+}
+
+// KeyManager signs and verifies JWTs with a set of rotating keys and
+// publishes the public halves as a JWKS document.
+type KeyManager struct {
+	mu         sync.RWMutex
+	opts       KeyManagerOptions
+	keys       []*SigningKey
+	lastReload time.Time
+}
+
+// NewKeyManager loads existing keys from opts.Dir and generates a first key
+// when an asymmetric algorithm is configured and none is found.
+func NewKeyManager(opts KeyManagerOptions) (*KeyManager, error) {
+	switch opts.Algorithm {
+	case AlgHS256, AlgRS256, AlgEdDSA:
+	default:
+		return nil, fmt.Errorf("unsupported JWT signing algorithm %q", opts.Algorithm)
+	}
+
+	m := &KeyManager{opts: opts}
+	if opts.Algorithm == AlgHS256 {
+		return m, nil
+	}
+
+	if err := m.Reload(); err != nil {
+		return nil, err
+	}
+	if m.signingKey() == nil {
+		if _, err := m.Rotate(); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// Rotate generates a new signing key. Previously active keys remain valid
+// for verification for the configured retention period.
+func (m *KeyManager) Rotate() (*SigningKey, error) {
+	if m.opts.Algorithm == AlgHS256 {
+		return nil, errors.New("HS256 keys cannot be rotated")
+	}
+
+	kid, err := GenerateOpaqueToken(12)
+	if err != nil {
+		return nil, err
+	}
+
+	var signer crypto.Signer
+	switch m.opts.Algorithm {
+	case AlgRS256:
+		signer, err = rsa.GenerateKey(rand.Reader, 2048)
+	case AlgEdDSA:
+		_, signer, err = ed25519.GenerateKey(rand.Reader)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error generating signing key: %w", err)
+	}
+
+	key := &SigningKey{
+		ID:        kid,
+		Algorithm: m.opts.Algorithm,
+		Private:   signer,
+		CreatedAt: time.Now(),
+	}
+
+	if m.opts.Dir != "" {
+		if err := writeKeyFile(m.opts.Dir, key); err != nil {
+			return nil, err
+		}
+	}
+
+	m.mu.Lock()
+	m.keys = append(m.keys, key)
+	m.pruneLocked()
+	m.mu.Unlock()
+	return key, nil
+}
+
+// Reload re-reads the key directory so keys rotated by another instance are
+// picked up. It is a no-op without a directory.
+func (m *KeyManager) Reload() error {
+	if m.opts.Dir == "" {
+		return nil
+	}
+
+	loaded, err := readKeyDir(m.opts.Dir)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	known := make(map[string]bool, len(m.keys))
+	for _, key := range m.keys {
+		known[key.ID] = true
+	}
+	for _, key := range loaded {
+		if !known[key.ID] {
+			m.keys = append(m.keys, key)
+		}
+	}
+	sort.Slice(m.keys, func(i, j int) bool { return m.keys[i].CreatedAt.Before(m.keys[j].CreatedAt) })
+	m.pruneLocked()
+	m.lastReload = time.Now()
+	return nil
+}
+
+// StartRotation reloads keys and rotates the signing key once it is older
+// than interval, checking every minute until ctx is cancelled.
+func (m *KeyManager) StartRotation(ctx context.Context, interval time.Duration) {
+	if m.opts.Algorithm == AlgHS256 || interval <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(time.Minute)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := m.Reload(); err != nil {
+					log.Println("Error reloading signing keys:", err)
+				}
+				if current := m.signingKey(); current == nil || time.Since(current.CreatedAt) >= interval {
+					if _, err := m.Rotate(); err != nil {
+						log.Println("Error rotating signing key:", err)
+					}
+				}
+			}
+		}
+	}()
+}
+
+// pruneLocked drops keys that were superseded longer than the retention
+// period ago. The caller must hold m.mu.
+func (m *KeyManager) pruneLocked() {
+	if m.opts.Retention <= 0 || len(m.keys) < 2 {
+		return
+	}
+	kept := m.keys[:0]
+	for i, key := range m.keys {
+		if i < len(m.keys)-1 && time.Since(m.keys[i+1].CreatedAt) > m.opts.Retention {
+			if m.opts.Dir != "" {
+				os.Remove(filepath.Join(m.opts.Dir, key.ID+".pem"))
+			}
+			continue
+		}
+		kept = append(kept, key)
+	}
+	m.keys = kept
+}
+
+func (m *KeyManager) signingKey() *SigningKey {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if len(m.keys) == 0 {
+		return nil
+	}
+	return m.keys[len(m.keys)-1]
+}
+
+func (m *KeyManager) lookup(kid string) *SigningKey {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, key := range m.keys {
+		if key.ID == kid {
+			return key
+		}
+	}
+	return nil
+}
+
+// Sign serialises claims as a JWT with the current signing key.
+func (m *KeyManager) Sign(claims *models.Claims) (string, error) {
+	if m.opts.Algorithm == AlgHS256 {
+		return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(m.opts.LegacySecret)
+	}
+
+	key := m.signingKey()
+	if key == nil {
+		return "", errors.New("no signing key available")
+	}
+
+	var method jwt.SigningMethod = jwt.SigningMethodRS256
+	if key.Algorithm == AlgEdDSA {
+		method = jwt.SigningMethodEdDSA
+	}
+	token := jwt.NewWithClaims(method, claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.Private)
+}
+
+// Verify parses tokenString and checks its signature with the key named by
+// its kid header. HS256 tokens are accepted only while the legacy window is
+// open, or always when the manager itself signs with HS256.
+func (m *KeyManager) Verify(tokenString string) (*models.Claims, error) {
+	token, err := jwt.ParseWithClaims(tokenString, &models.Claims{}, m.keyFunc,
+		jwt.WithValidMethods([]string{AlgRS256, AlgEdDSA, AlgHS256}))
+	if err != nil {
+		return nil, err
+	}
+
+	claims, ok := token.Claims.(*models.Claims)
+	if !ok || !token.Valid {
+		return nil, errors.New("invalid token")
+	}
+	return claims, nil
+}
+
+func (m *KeyManager) keyFunc(token *jwt.Token) (interface{}, error) {
+	alg := token.Method.Alg()
+	if alg == AlgHS256 {
+		if m.opts.Algorithm == AlgHS256 || time.Now().Before(m.opts.LegacyUntil) {
+			return m.opts.LegacySecret, nil
+		}
+		return nil, errors.New("HS256 tokens are no longer accepted")
+	}
+
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		return nil, errors.New("token has no kid header")
+	}
+
+	key := m.lookup(kid)
+	if key == nil && m.canReload() {
+		if err := m.Reload(); err != nil {
+			return nil, err
+		}
+		key = m.lookup(kid)
+	}
+	if key == nil {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	if key.Algorithm != alg {
+		return nil, errors.New("token algorithm does not match its key")
+	}
+	return key.public(), nil
+}
+
+// canReload rate-limits directory reloads triggered by unknown kids so that
+// garbage tokens cannot make every request hit the filesystem.
+func (m *KeyManager) canReload() bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.opts.Dir != "" && time.Since(m.lastReload) > 10*time.Second
+}
+
+// JWK is the public part of a signing key in RFC 7517 form.
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS returns every key that can currently verify tokens. HS256 secrets are
+// never published.
+func (m *KeyManager) JWKS() JWKSet {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	set := JWKSet{Keys: []JWK{}}
+	for _, key := range m.keys {
+		jwk := JWK{Kid: key.ID, Use: "sig", Alg: key.Algorithm}
+		switch pub := key.public().(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+		default:
+			continue
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	return set
+}
+
+func writeKeyFile(dir string, key *SigningKey) error {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return fmt.Errorf("error creating key directory: %w", err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key.Private)
+	if err != nil {
+		return fmt.Errorf("error encoding signing key: %w", err)
+	}
+	data := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	path := filepath.Join(dir, key.ID+".pem")
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		return fmt.Errorf("error writing signing key: %w", err)
+	}
+	return os.Chtimes(path, key.CreatedAt, key.CreatedAt)
+}
+
+// readKeyDir loads every <kid>.pem in dir. A key's creation time is taken
+// from the file's modification time.
+func readKeyDir(dir string) ([]*SigningKey, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []*SigningKey
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("error reading %s: %w", path, err)
+		}
+		block, _ := pem.Decode(data)
+		if block == nil {
+			return nil, fmt.Errorf("%s is not a PEM file", path)
+		}
+		parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing %s: %w", path, err)
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+
+		key := &SigningKey{
+			ID:        strings.TrimSuffix(filepath.Base(path), ".pem"),
+			CreatedAt: info.ModTime(),
+		}
+		switch private := parsed.(type) {
+		case *rsa.PrivateKey:
+			key.Algorithm = AlgRS256
+			key.Private = private
+		case ed25519.PrivateKey:
+			key.Algorithm = AlgEdDSA
+			key.Private = private
+		default:
+			return nil, fmt.Errorf("%s: unsupported key type %T", path, parsed)
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
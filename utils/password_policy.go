@@ -0,0 +1,110 @@
+package utils
+
+import (
+	_ "embed"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Character classes a PasswordPolicy can require.
+const (
+	PasswordClassUpper  = "upper"
+	PasswordClassLower  = "lower"
+	PasswordClassDigit  = "digit"
+	PasswordClassSymbol = "symbol"
+)
+
+var ErrPasswordPolicy = errors.New("password does not meet the password policy")
+
+// PasswordPolicy describes what new passwords must look like. History and
+// MaxAge are enforced by the callers that know the user's past passwords
+// and when the current one was set.
+type PasswordPolicy struct {
+	MinLength int
+	// RequiredClasses lists the PasswordClass* values that must each
+	// appear at least once.
+	RequiredClasses []string
+	// History is how many recent passwords, including the current one,
+	// cannot be reused. Zero disables the check.
+	History int
+	// MaxAge forces a change once a password is older than this. Zero
+	// disables expiry.
+	MaxAge time.Duration
+}
+
+//go:embed common_passwords.txt
+var commonPasswordList string
+
+var commonPasswords = func() map[string]bool {
+	set := map[string]bool{}
+	for _, line := range strings.Split(commonPasswordList, "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "#") {
+			set[line] = true
+		}
+	}
+	return set
+}()
+
+// IsCommonPassword reports whether password is on the bundled list of
+// frequently used passwords, ignoring case.
+func IsCommonPassword(password string) bool {
+	return commonPasswords[strings.ToLower(password)]
+}
+
+// Validate returns nil when password satisfies the length, character class
+// and common password rules, or an error wrapping ErrPasswordPolicy that
+// lists every rule it breaks.
+func (p PasswordPolicy) Validate(password string) error {
+	var problems []string
+	if n := len([]rune(password)); n < p.MinLength {
+		problems = append(problems, fmt.Sprintf("must be at least %d characters long", p.MinLength))
+	}
+
+	present := map[string]bool{}
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			present[PasswordClassUpper] = true
+		case unicode.IsLower(r):
+			present[PasswordClassLower] = true
+		case unicode.IsDigit(r):
+			present[PasswordClassDigit] = true
+		default:
+			present[PasswordClassSymbol] = true
+		}
+	}
+	for _, class := range p.RequiredClasses {
+		if !present[class] {
+			problems = append(problems, "must contain a "+class+" character")
+		}
+	}
+
+	if IsCommonPassword(password) {
+		problems = append(problems, "is too common")
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("%w: password %s", ErrPasswordPolicy, strings.Join(problems, ", "))
+	}
+	return nil
+}
+
+// Expired reports whether a password set at changedAt must be changed.
+func (p PasswordPolicy) Expired(changedAt time.Time) bool {
+	return p.MaxAge > 0 && time.Since(changedAt) > p.MaxAge
+}
+
+// PasswordReused reports whether password matches any of hashes, the
+// user's current and recent password hashes.
+func PasswordReused(password string, hashes []string) bool {
+	for _, hash := range hashes {
+		if ComparePassword(hash, password) == nil {
+			return true
+		}
+	}
+	return false
+}
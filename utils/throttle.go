@@ -0,0 +1,40 @@
+package utils
+
+import "time"
+
+// ThrottlePolicy describes how repeated login failures for one key (an
+// email address or a client IP) are slowed down and eventually locked out.
+type ThrottlePolicy struct {
+	// FreeAttempts failures are allowed before any delay is imposed.
+	FreeAttempts int
+	// BaseDelay is the wait after the first failure past FreeAttempts; it
+	// doubles with every further failure up to MaxDelay.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// LockoutThreshold failures lock the key for LockoutDuration.
+	LockoutThreshold int
+	LockoutDuration  time.Duration
+	// Window is how long a failure is remembered. A failure after a quiet
+	// period longer than Window starts counting from one again.
+	Window time.Duration
+}
+
+// BlockDuration returns how long the key must wait after its latest failure,
+// given the number of consecutive failures recorded so far.
+func (p ThrottlePolicy) BlockDuration(failures int) time.Duration {
+	if p.LockoutThreshold > 0 && failures >= p.LockoutThreshold {
+		return p.LockoutDuration
+	}
+	if failures <= p.FreeAttempts {
+		return 0
+	}
+
+	delay := p.BaseDelay
+	for i := p.FreeAttempts + 1; i < failures; i++ {
+		delay *= 2
+		if p.MaxDelay > 0 && delay >= p.MaxDelay {
+			return p.MaxDelay
+		}
+	}
+	return delay
+}
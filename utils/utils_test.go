@@ -1,6 +1,8 @@
 package utils_test
 
 import (
+	"net"
+	"strings"
 	"testing"
 	"time"
 
@@ -56,8 +58,9 @@ func TestGenerateAndVerifyJWT(t *testing.T) {
 	assert.NotNil(t, claims)
 	assert.Equal(t, userID, claims.UserID)
 	assert.Equal(t, role, claims.Role)
-	assert.WithinDuration(t, time.Now().Add(24*time.Hour), claims.ExpiresAt.Time, time.Minute)
+	assert.WithinDuration(t, time.Now().Add(utils.AccessTokenTTL), claims.ExpiresAt.Time, time.Minute)
 	assert.WithinDuration(t, time.Now(), claims.IssuedAt.Time, time.Minute)
+	assert.NotEmpty(t, claims.ID, "Token should carry a jti")
 }
 
 func TestVerifyJWT_InvalidToken(t *testing.T) {
@@ -81,3 +84,290 @@ func TestVerifyJWT_TamperedToken(t *testing.T) {
 	_, err := utils.VerifyJWT(tamperedToken)
 	assert.Error(t, err)
 }
+
+func TestGenerateOpaqueToken_Unique(t *testing.T) {
+	first, err := utils.GenerateOpaqueToken(32)
+	assert.NoError(t, err)
+	second, err := utils.GenerateOpaqueToken(32)
+	assert.NoError(t, err)
+
+	assert.Len(t, first, 43)
+	assert.NotEqual(t, first, second)
+}
+
+func TestHashToken_Deterministic(t *testing.T) {
+	assert.Equal(t, utils.HashToken("refresh"), utils.HashToken("refresh"))
+	assert.NotEqual(t, utils.HashToken("refresh"), utils.HashToken("refresh2"))
+	assert.Len(t, utils.HashToken("refresh"), 64)
+}
+
+func TestTOTPCode_RFC6238Vectors(t *testing.T) {
+	// RFC 6238 appendix B SHA1 seed "12345678901234567890", truncated to 6 digits.
+	secret := "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+	vectors := map[int64]string{
+		59:         "287082",
+		1111111109: "081804",
+		1234567890: "005924",
+		2000000000: "279037",
+	}
+	for unix, want := range vectors {
+		code, err := utils.TOTPCode(secret, utils.TOTPStep(time.Unix(unix, 0)))
+		assert.NoError(t, err)
+		assert.Equal(t, want, code, "time %d", unix)
+	}
+}
+
+func TestValidateTOTP_AcceptsAdjacentStep(t *testing.T) {
+	secret, err := utils.GenerateTOTPSecret()
+	assert.NoError(t, err)
+
+	now := time.Now()
+	previous, err := utils.TOTPCode(secret, utils.TOTPStep(now)-1)
+	assert.NoError(t, err)
+
+	step, ok := utils.ValidateTOTP(secret, previous, now)
+	assert.True(t, ok)
+	assert.Equal(t, utils.TOTPStep(now)-1, step)
+
+	stale, err := utils.TOTPCode(secret, utils.TOTPStep(now)-5)
+	assert.NoError(t, err)
+	_, ok = utils.ValidateTOTP(secret, stale, now)
+	assert.False(t, ok)
+}
+
+func TestRecoveryCodes_Normalize(t *testing.T) {
+	codes, err := utils.GenerateRecoveryCodes(3)
+	assert.NoError(t, err)
+	assert.Len(t, codes, 3)
+
+	for _, code := range codes {
+		assert.Len(t, code, 11)
+		assert.Equal(t, code, utils.NormalizeRecoveryCode(" "+strings.ToUpper(strings.ReplaceAll(code, "-", ""))+" "))
+	}
+}
+
+func TestMFAToken_HasPurpose(t *testing.T) {
+	tokenStr, err := utils.GenerateMFAToken(7, "doctor")
+	assert.NoError(t, err)
+
+	claims, err := utils.VerifyJWT(tokenStr)
+	assert.NoError(t, err)
+	assert.Equal(t, models.PurposeMFA, claims.Purpose)
+}
+
+func TestThrottlePolicy_BlockDuration(t *testing.T) {
+	policy := utils.ThrottlePolicy{
+		FreeAttempts:     3,
+		BaseDelay:        time.Second,
+		MaxDelay:         10 * time.Second,
+		LockoutThreshold: 10,
+		LockoutDuration:  15 * time.Minute,
+	}
+
+	assert.Equal(t, time.Duration(0), policy.BlockDuration(3))
+	assert.Equal(t, time.Second, policy.BlockDuration(4))
+	assert.Equal(t, 2*time.Second, policy.BlockDuration(5))
+	assert.Equal(t, 8*time.Second, policy.BlockDuration(7))
+	assert.Equal(t, 10*time.Second, policy.BlockDuration(9), "Backoff is capped at MaxDelay")
+	assert.Equal(t, 15*time.Minute, policy.BlockDuration(10), "Reaching the threshold locks the key")
+}
+
+func TestBearerToken(t *testing.T) {
+	assert.Equal(t, "abc.def.ghi", utils.BearerToken("Bearer abc.def.ghi"))
+	assert.Equal(t, "abc.def.ghi", utils.BearerToken("bearer   abc.def.ghi "))
+	assert.Equal(t, "", utils.BearerToken("Basic dXNlcjpwYXNz"))
+	assert.Equal(t, "", utils.BearerToken(""))
+}
+
+func useKeyManager(t *testing.T, opts utils.KeyManagerOptions) *utils.KeyManager {
+	t.Helper()
+	m, err := utils.NewKeyManager(opts)
+	assert.NoError(t, err)
+	prev := utils.SetKeyManager(m)
+	t.Cleanup(func() { utils.SetKeyManager(prev) })
+	return m
+}
+
+func TestKeyManager_AsymmetricRoundTrip(t *testing.T) {
+	for _, alg := range []string{utils.AlgRS256, utils.AlgEdDSA} {
+		t.Run(alg, func(t *testing.T) {
+			useKeyManager(t, utils.KeyManagerOptions{Algorithm: alg})
+
+			tokenStr, err := utils.GenerateJWT(5, "doctor")
+			assert.NoError(t, err)
+
+			parsed, _, err := jwt.NewParser().ParseUnverified(tokenStr, &models.Claims{})
+			assert.NoError(t, err)
+			assert.Equal(t, alg, parsed.Method.Alg())
+			assert.NotEmpty(t, parsed.Header["kid"])
+
+			claims, err := utils.VerifyJWT(tokenStr)
+			assert.NoError(t, err)
+			assert.Equal(t, 5, claims.UserID)
+
+			jwks := utils.JWKS()
+			assert.Len(t, jwks.Keys, 1)
+			assert.Equal(t, parsed.Header["kid"], jwks.Keys[0].Kid)
+		})
+	}
+}
+
+func TestKeyManager_RotationKeepsOldKeys(t *testing.T) {
+	m := useKeyManager(t, utils.KeyManagerOptions{Algorithm: utils.AlgEdDSA, Retention: time.Hour})
+
+	oldToken, err := utils.GenerateJWT(1, "doctor")
+	assert.NoError(t, err)
+
+	_, err = m.Rotate()
+	assert.NoError(t, err)
+
+	newToken, err := utils.GenerateJWT(1, "doctor")
+	assert.NoError(t, err)
+
+	_, err = utils.VerifyJWT(oldToken)
+	assert.NoError(t, err, "Tokens signed before rotation should still verify")
+	_, err = utils.VerifyJWT(newToken)
+	assert.NoError(t, err)
+	assert.Len(t, utils.JWKS().Keys, 2)
+}
+
+func TestKeyManager_LegacyHS256Window(t *testing.T) {
+	secret := []byte("legacy-secret")
+	legacy := jwt.NewWithClaims(jwt.SigningMethodHS256, &models.Claims{
+		UserID: 1,
+		Role:   "doctor",
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		},
+	})
+	legacyToken, err := legacy.SignedString(secret)
+	assert.NoError(t, err)
+
+	useKeyManager(t, utils.KeyManagerOptions{
+		Algorithm:    utils.AlgRS256,
+		LegacySecret: secret,
+		LegacyUntil:  time.Now().Add(time.Hour),
+	})
+	_, err = utils.VerifyJWT(legacyToken)
+	assert.NoError(t, err, "HS256 tokens should verify during the migration window")
+
+	useKeyManager(t, utils.KeyManagerOptions{
+		Algorithm:    utils.AlgRS256,
+		LegacySecret: secret,
+		LegacyUntil:  time.Now().Add(-time.Minute),
+	})
+	_, err = utils.VerifyJWT(legacyToken)
+	assert.Error(t, err, "HS256 tokens should be rejected once the window has closed")
+}
+
+func TestKeyManager_LoadsKeysFromDir(t *testing.T) {
+	dir := t.TempDir()
+	useKeyManager(t, utils.KeyManagerOptions{Algorithm: utils.AlgRS256, Dir: dir})
+
+	tokenStr, err := utils.GenerateJWT(3, "receptionist")
+	assert.NoError(t, err)
+
+	// A second instance sharing the directory verifies the same tokens.
+	useKeyManager(t, utils.KeyManagerOptions{Algorithm: utils.AlgRS256, Dir: dir})
+	claims, err := utils.VerifyJWT(tokenStr)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, claims.UserID)
+}
+
+func TestDeviceName(t *testing.T) {
+	cases := map[string]string{
+		"Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:128.0) Gecko/20100101 Firefox/128.0":                                            "Firefox on Windows",
+		"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0 Safari/537.36 Edg/126.0": "Edge on macOS",
+		"Mozilla/5.0 (iPhone; CPU iPhone OS 17_5 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.5 Safari/604.1":   "Safari on iOS",
+		"curl/8.5.0": "curl",
+		"":           "Unknown device",
+	}
+	for userAgent, want := range cases {
+		assert.Equal(t, want, utils.DeviceName(userAgent), userAgent)
+	}
+}
+
+func TestPasswordPolicy_Validate(t *testing.T) {
+	policy := utils.PasswordPolicy{
+		MinLength:       12,
+		RequiredClasses: []string{utils.PasswordClassUpper, utils.PasswordClassLower, utils.PasswordClassDigit},
+	}
+
+	assert.NoError(t, policy.Validate("Ward7-Night-Shift"))
+
+	err := policy.Validate("short")
+	assert.ErrorIs(t, err, utils.ErrPasswordPolicy)
+	assert.Contains(t, err.Error(), "at least 12 characters")
+	assert.Contains(t, err.Error(), "upper")
+	assert.Contains(t, err.Error(), "digit")
+
+	assert.ErrorIs(t, utils.PasswordPolicy{}.Validate("Password123"), utils.ErrPasswordPolicy, "Common passwords are rejected regardless of case")
+}
+
+func TestPasswordPolicy_Expired(t *testing.T) {
+	policy := utils.PasswordPolicy{MaxAge: 90 * 24 * time.Hour}
+	assert.False(t, policy.Expired(time.Now().Add(-24*time.Hour)))
+	assert.True(t, policy.Expired(time.Now().Add(-91*24*time.Hour)))
+	assert.False(t, utils.PasswordPolicy{}.Expired(time.Time{}), "Expiry is disabled without a MaxAge")
+}
+
+func TestArgon2idHasher_PHCFormat(t *testing.T) {
+	hasher := utils.NewArgon2idHasher(8*1024, 1, 1)
+
+	hash, err := hasher.Hash("a passphrase longer than seventy-two bytes, which bcrypt would silently truncate")
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(hash, "$argon2id$v=19$m=8192,t=1,p=1$"), hash)
+
+	assert.NoError(t, hasher.Verify(hash, "a passphrase longer than seventy-two bytes, which bcrypt would silently truncate"))
+	assert.ErrorIs(t, hasher.Verify(hash, "a passphrase longer than seventy-two bytes, which bcrypt would silently truncatE"), utils.ErrPasswordMismatch)
+	assert.False(t, hasher.NeedsRehash(hash))
+	assert.True(t, utils.NewArgon2idHasher(16*1024, 1, 1).NeedsRehash(hash), "Hashes with less memory than configured are upgraded")
+}
+
+func TestArgon2idHasher_VerifiesLegacyBcrypt(t *testing.T) {
+	legacy, err := utils.NewBcryptHasher(4).Hash("legacyPassword")
+	assert.NoError(t, err)
+
+	hasher := utils.NewArgon2idHasher(8*1024, 1, 1)
+	assert.NoError(t, hasher.Verify(legacy, "legacyPassword"))
+	assert.ErrorIs(t, hasher.Verify(legacy, "wrongPassword"), utils.ErrPasswordMismatch)
+	assert.True(t, hasher.NeedsRehash(legacy))
+	assert.ErrorIs(t, hasher.Verify("plaintext", "plaintext"), utils.ErrUnknownPasswordHash)
+}
+
+func TestAccessPolicy_NetworksAndHours(t *testing.T) {
+	kolkata, err := time.LoadLocation("Asia/Kolkata")
+	assert.NoError(t, err)
+	policy, err := utils.ParseAccessPolicy([]byte(`{
+		"receptionist": {
+			"networks": ["10.20.0.0/16"],
+			"hours": [
+				{"days": ["mon", "tue", "wed", "thu", "fri"], "from": "08:00", "to": "20:00"},
+				{"days": ["sat"], "from": "22:00", "to": "06:00"}
+			]
+		}
+	}`), kolkata)
+	assert.NoError(t, err)
+
+	clinic := net.ParseIP("10.20.3.4")
+	monday10am := time.Date(2026, 10, 19, 10, 0, 0, 0, kolkata)
+	assert.NoError(t, policy.Check("receptionist", clinic, monday10am))
+	assert.NoError(t, policy.Check("doctor", net.ParseIP("203.0.113.9"), monday10am), "Roles without a rule are unrestricted")
+	assert.ErrorIs(t, policy.Check("receptionist", net.ParseIP("203.0.113.9"), monday10am), utils.ErrAccessNetwork)
+	assert.ErrorIs(t, policy.Check("receptionist", clinic, monday10am.Add(11*time.Hour)), utils.ErrAccessHours)
+	// 04:30 UTC on Monday is 10:00 in the clinic.
+	assert.NoError(t, policy.Check("receptionist", clinic, time.Date(2026, 10, 19, 4, 30, 0, 0, time.UTC)))
+
+	sundayEarly := time.Date(2026, 10, 18, 3, 0, 0, 0, kolkata)
+	assert.NoError(t, policy.Check("receptionist", clinic, sundayEarly), "Saturday's night shift runs into Sunday morning")
+	assert.ErrorIs(t, policy.Check("receptionist", clinic, sundayEarly.Add(19*time.Hour)), utils.ErrAccessHours)
+}
+
+func TestParseAccessPolicy_RejectsInvalidRules(t *testing.T) {
+	_, err := utils.ParseAccessPolicy([]byte(`{"receptionist": {"networks": ["10.20.0.0"]}}`), time.UTC)
+	assert.Error(t, err)
+	_, err = utils.ParseAccessPolicy([]byte(`{"receptionist": {"hours": [{"days": ["someday"], "from": "08:00", "to": "20:00"}]}}`), time.UTC)
+	assert.Error(t, err)
+	_, err = utils.ParseAccessPolicy([]byte(`{"receptionist": {"hours": [{"from": "8am", "to": "20:00"}]}}`), time.UTC)
+	assert.Error(t, err)
+}